@@ -11,13 +11,29 @@ import (
 	"time"
 
 	"golang.org/x/sync/errgroup"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/cli"
 
 	"github.com/joelanford/workshop/cmd/workshop-controller/app/glogshim"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/client/workshop"
 	"github.com/joelanford/workshop/pkg/workshop/controller"
+	"github.com/joelanford/workshop/pkg/workshop/leaderelection"
+	"github.com/joelanford/workshop/pkg/workshop/leaderelection/resourcelock"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+	"github.com/joelanford/workshop/pkg/workshop/webhook"
 )
 
 var (
@@ -57,7 +73,12 @@ func Run() error {
 		cli.IntFlag{
 			Name:  "healthz-port, p",
 			Value: 8081,
-			Usage: "port on which to serve a workshop-controller readiness probe.",
+			Usage: "port on which to serve workshop-controller readiness and liveness probes and metrics.",
+		},
+		cli.IntFlag{
+			Name:  "liveness-missed-heartbeats",
+			Value: 4,
+			Usage: "number of missed reconcile heartbeats or informer resyncs after which the liveness probe fails.",
 		},
 		cli.DurationFlag{
 			Name:  "initial-sync-timeout, t",
@@ -68,6 +89,131 @@ func Run() error {
 			Name:  "domain, d",
 			Usage: "if set, will use as domain suffix for workshop services.",
 		},
+		cli.IntFlag{
+			Name:  "workers, w",
+			Value: 4,
+			Usage: "number of desks to reconcile in parallel.",
+		},
+		cli.BoolFlag{
+			Name:  "leader-elect",
+			Usage: "acquire a leader lease before reconciling desks, so that multiple replicas can run.",
+		},
+		cli.DurationFlag{
+			Name:  "leader-elect-lease-duration",
+			Value: 15 * time.Second,
+			Usage: "duration that standby replicas wait after the leader's last renewal before taking over.",
+		},
+		cli.DurationFlag{
+			Name:  "leader-elect-renew-deadline",
+			Value: 10 * time.Second,
+			Usage: "duration that the leader retries renewing its lease before giving up leadership.",
+		},
+		cli.DurationFlag{
+			Name:  "leader-elect-retry-period",
+			Value: 2 * time.Second,
+			Usage: "duration between attempts to acquire or renew the leader lease.",
+		},
+		cli.StringFlag{
+			Name:   "leader-elect-namespace",
+			EnvVar: "POD_NAMESPACE",
+			Value:  "default",
+			Usage:  "namespace of the leader lease configmap.",
+		},
+		cli.StringFlag{
+			Name:  "leader-elect-name",
+			Value: "workshop-controller",
+			Usage: "name of the leader lease configmap.",
+		},
+		cli.BoolFlag{
+			Name:  "webhook",
+			Usage: "serve and register a validating admission webhook for desks.",
+		},
+		cli.IntFlag{
+			Name:  "webhook-port",
+			Value: 8443,
+			Usage: "port on which to serve the desk admission webhook.",
+		},
+		cli.StringFlag{
+			Name:   "webhook-service-namespace",
+			EnvVar: "POD_NAMESPACE",
+			Value:  "default",
+			Usage:  "namespace of the service through which the apiserver reaches the webhook.",
+		},
+		cli.StringFlag{
+			Name:  "webhook-service-name",
+			Value: "workshop-controller",
+			Usage: "name of the service through which the apiserver reaches the webhook.",
+		},
+		cli.StringFlag{
+			Name:  "webhook-controller-user",
+			Usage: "`USER` as which the controller writes desks, whose writes the webhook does not review. Defaults to the service account named --webhook-service-name in --webhook-service-namespace.",
+		},
+		cli.StringFlag{
+			Name:  "desk-quota",
+			Value: "pods=20,requests.cpu=2,requests.memory=4Gi,limits.cpu=4,limits.memory=8Gi",
+			Usage: "hard limits of the resource quota of each desk namespace, as comma separated `NAME=QUANTITY` pairs.",
+		},
+		cli.StringFlag{
+			Name:  "desk-default-limits",
+			Value: "cpu=500m,memory=512Mi",
+			Usage: "limits of containers in desk namespaces that do not set their own, as comma separated `NAME=QUANTITY` pairs.",
+		},
+		cli.StringFlag{
+			Name:  "desk-default-requests",
+			Value: "cpu=100m,memory=128Mi",
+			Usage: "requests of containers in desk namespaces that do not set their own, as comma separated `NAME=QUANTITY` pairs.",
+		},
+		cli.StringFlag{
+			Name:  "desk-max-limits",
+			Usage: "largest limits of a single container in desk namespaces, as comma separated `NAME=QUANTITY` pairs.",
+		},
+		cli.StringFlag{
+			Name:  "ingress-namespace-selector",
+			Value: "!" + apiv1.DeskNamespaceLabel,
+			Usage: "label `SELECTOR` of the namespaces, e.g. that of the ingress controller, from which the kubeshells of desks can be reached. By default all namespaces that are not desk namespaces.",
+		},
+		cli.BoolFlag{
+			Name:  "suspend-workloads",
+			Usage: "also scale the deployments and statefulsets in the working namespace of suspended desks to zero.",
+		},
+		cli.DurationFlag{
+			Name:  "idle-timeout",
+			Usage: "time without activity after which desks are suspended, 0 to never suspend idle desks.",
+		},
+		cli.StringFlag{
+			Name:  "max-desk-lifespan",
+			Value: "2w",
+			Usage: "longest `DURATION` from the creation or renewal of a desk to its expiration, e.g. \"3d\" or \"2w\", unless its desk class overrides it. Empty for no limit.",
+		},
+		cli.IntFlag{
+			Name:  "max-desk-renewals",
+			Value: -1,
+			Usage: "largest number of times the expiration of a desk may be extended, unless its desk class overrides it. -1 for no limit.",
+		},
+		cli.StringFlag{
+			Name:  "max-desk-lifetime",
+			Usage: "longest `DURATION` from the creation of a desk to its expiration including renewals, e.g. \"4w\", unless its desk class overrides it. Empty for no limit.",
+		},
+		cli.IntFlag{
+			Name:  "max-desks-per-owner",
+			Usage: "maximum number of active desks per owner. 0 for no limit.",
+		},
+		cli.StringFlag{
+			Name:  "max-resources-per-owner",
+			Usage: "largest total of the resource quotas of the namespaces of the active desks of each owner, as comma separated `NAME=QUANTITY` pairs, e.g. \"requests.cpu=8\".",
+		},
+		cli.StringFlag{
+			Name:  "self-service-group",
+			Usage: "`GROUP` whose members may create desks, but only with themselves as owner. Requires --webhook.",
+		},
+		cli.StringFlag{
+			Name:  "desk-kubeconfig-server",
+			Usage: "`URL` of the apiserver in the kubeconfigs published for desks, e.g. one that is reachable from outside of the cluster. By default the apiserver that the controller connects to.",
+		},
+		cli.BoolFlag{
+			Name:  "bind-desk-users",
+			Usage: "also bind the owner of each desk as a user, and the collaborators of the desk, to the roles of the desk, so that they can use kubectl with their own credentials.",
+		},
 	}
 	app.Flags = append(app.Flags, glogshim.Flags...)
 
@@ -79,11 +225,60 @@ func Run() error {
 		initialSyncTimeout := c.Duration("initial-sync-timeout")
 		healthzPort := c.Int("healthz-port")
 		clean := c.IsSet("clean")
+		workers := c.Int("workers")
+		missedHeartbeats := c.Int("liveness-missed-heartbeats")
+
+		if workers < 1 {
+			return fmt.Errorf("Invalid number of workers: %d", workers)
+		}
+		if missedHeartbeats < 1 {
+			return fmt.Errorf("Invalid number of missed heartbeats: %d", missedHeartbeats)
+		}
+
+		// Metrics must be registered before the controller creates its
+		// clients and workqueues, so that those get instrumented.
+		metrics.Register()
 
-		wc, err := controller.NewWorkshopController(kubeconfig, domain, initialSyncTimeout)
+		resourceLimits, err := newResourceLimits(c)
+		if err != nil {
+			return err
+		}
+		expirationPolicy, err := newExpirationPolicy(c)
 		if err != nil {
 			return err
 		}
+		ownerLimits, err := newOwnerLimits(c)
+		if err != nil {
+			return err
+		}
+		selfServiceGroup := c.String("self-service-group")
+		if selfServiceGroup != "" && !c.Bool("webhook") {
+			return fmt.Errorf("--self-service-group requires --webhook")
+		}
+		ingressNamespaceSelector, err := metav1.ParseToLabelSelector(c.String("ingress-namespace-selector"))
+		if err != nil {
+			return fmt.Errorf("Invalid --ingress-namespace-selector: %s", err)
+		}
+
+		wc, err := controller.NewWorkshopController(kubeconfig, controller.Config{
+			Domain:             domain,
+			InitialSyncTimeout: initialSyncTimeout,
+			Workers:            workers,
+			ResourceLimits:     resourceLimits,
+
+			IngressNamespaceSelector: ingressNamespaceSelector,
+			SuspendWorkloads:         c.Bool("suspend-workloads"),
+			IdleTimeout:              c.Duration("idle-timeout"),
+			ExpirationPolicy:         expirationPolicy,
+			OwnerLimits:              ownerLimits,
+			SelfServiceGroup:         selfServiceGroup,
+			BindDeskUsers:            c.Bool("bind-desk-users"),
+			KubeconfigServer:         c.String("desk-kubeconfig-server"),
+		})
+		if err != nil {
+			return err
+		}
+		prometheus.MustRegister(wc.DeskCollector())
 
 		if clean {
 			glog.V(0).Infof("Cleaning workshop resources and exiting.")
@@ -100,28 +295,98 @@ func Run() error {
 			glog.V(0).Infof("FLAG --%s=%q", flagName, c.Generic(flagName))
 		}
 
+		runController := func(ctx context.Context) error {
+			if err := wc.Start(ctx); err != nil {
+				return err
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		}
+
+		var election *leaderElection
+		var elector *leaderelection.LeaderElector
+		if c.Bool("leader-elect") {
+			election, err = newLeaderElection(c, kubeconfig)
+			if err != nil {
+				return err
+			}
+			elector = election.elector
+		}
+
+		var webhookServer *webhook.Server
+		if c.Bool("webhook") {
+			webhookServer, err = newWebhookServer(c, kubeconfig, webhook.Config{
+				OwnerLimits:      ownerLimits,
+				ResourceLimits:   resourceLimits,
+				ExpirationPolicy: expirationPolicy,
+				SelfServiceGroup: selfServiceGroup,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
 		ctx, cancel := context.WithCancel(context.Background())
 		wg, ctx := errgroup.WithContext(ctx)
 
 		mux := http.NewServeMux()
 		mux.HandleFunc("/readiness", func(w http.ResponseWriter, req *http.Request) {
+			if elector != nil && !elector.IsLeader() {
+				fmt.Fprintf(w, "ok (standby, leader is %q)\n", elector.GetLeader())
+				return
+			}
+			if err := wc.Ready(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			if elector != nil {
+				fmt.Fprintf(w, "ok (leader)\n")
+				return
+			}
 			fmt.Fprintf(w, "ok\n")
 		})
 
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, req *http.Request) {
+			if elector != nil && !elector.IsLeader() {
+				fmt.Fprintf(w, "ok (standby)\n")
+				return
+			}
+			if err := wc.Healthy(missedHeartbeats); err != nil {
+				glog.Errorf("Liveness check failed: %s", err)
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintf(w, "ok\n")
+		})
+
+		mux.Handle("/metrics", promhttp.Handler())
+
 		healthzServer := &http.Server{
 			Addr:    fmt.Sprintf(":%d", healthzPort),
 			Handler: mux,
 		}
 
 		wg.Go(func() error {
-			if err := wc.Start(ctx); err != nil {
-				return err
-			}
-			glog.V(0).Infof("Starting healthz server at %v with readiness handler at \"/readiness\"", healthzPort)
+			glog.V(0).Infof("Starting healthz server at %v with readiness handler at \"/readiness\", liveness handler at \"/healthz\" and metrics at \"/metrics\"", healthzPort)
 			return healthzServer.ListenAndServe()
 		})
 
-		sigChan := make(chan os.Signal)
+		if webhookServer != nil {
+			// The webhook is served by every replica, not only the
+			// leader, since the service balances across all of them.
+			wg.Go(func() error {
+				return webhookServer.Run(ctx)
+			})
+		}
+
+		wg.Go(func() error {
+			if election != nil {
+				return election.run(ctx, runController)
+			}
+			return runController(ctx)
+		})
+
+		sigChan := make(chan os.Signal, 1)
 		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 		select {
@@ -130,7 +395,9 @@ func Run() error {
 		case <-ctx.Done():
 		}
 
-		// Cancel the context used to run the workshop controller
+		// Cancel the context used to run the workshop controller. When
+		// leader election is enabled, this also releases the leader lease
+		// so that a standby replica can take over immediately.
 		cancel()
 
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Second*5)
@@ -155,6 +422,221 @@ func printVersion(c *cli.Context) {
 	fmt.Printf("Version:     %s\nBuild Time:  %s\nBuild User:  %s\nGit Hash:    %s\n", version, buildTime, buildUser, gitHash)
 }
 
+// leaderElection runs the controller only while this replica holds the
+// leader lease.
+type leaderElection struct {
+	elector *leaderelection.LeaderElector
+
+	// lease is a lock of the same lease for this replica, separate from the
+	// lock of the elector, with which the lease is released on shutdown.
+	lease resourcelock.Interface
+
+	// started receives the stop channel of each term of leadership.
+	started chan (<-chan struct{})
+}
+
+func newLeaderElection(c *cli.Context, kubeconfig string) (*leaderElection, error) {
+	config, err := controller.BuildConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(rest.AddUserAgent(config, "leader-election"))
+	if err != nil {
+		return nil, err
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: kubeClient.CoreV1().Events("")})
+	lockConfig := resourcelock.ResourceLockConfig{
+		Identity:      fmt.Sprintf("%s_%s", hostname, rand.String(8)),
+		EventRecorder: broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "workshop-controller"}),
+	}
+	namespace, name := c.String("leader-elect-namespace"), c.String("leader-elect-name")
+	lock, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, name, kubeClient, lockConfig)
+	if err != nil {
+		return nil, err
+	}
+	lease, err := resourcelock.New(resourcelock.ConfigMapsResourceLock, namespace, name, kubeClient, lockConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	le := &leaderElection{lease: lease, started: make(chan (<-chan struct{}), 1)}
+	le.elector, err = leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: c.Duration("leader-elect-lease-duration"),
+		RenewDeadline: c.Duration("leader-elect-renew-deadline"),
+		RetryPeriod:   c.Duration("leader-elect-retry-period"),
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(stop <-chan struct{}) {
+				le.started <- stop
+			},
+			OnStoppedLeading: func() {
+				glog.V(0).Infof("Stopped leading as %s", lockConfig.Identity)
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return le, nil
+}
+
+// run waits for the leader lease and runs the controller until the lease is
+// lost or ctx is cancelled. When ctx is cancelled, the lease is released so
+// that a standby replica can take over immediately instead of waiting for
+// the lease to expire.
+func (le *leaderElection) run(ctx context.Context, run func(context.Context) error) error {
+	go le.elector.Run()
+
+	var stop <-chan struct{}
+	select {
+	case stop = <-le.started:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-leadCtx.Done():
+		}
+	}()
+	err := run(leadCtx)
+
+	select {
+	case <-stop:
+		return fmt.Errorf("lost leader lease %s", le.lease.Describe())
+	default:
+	}
+	if ctx.Err() != nil {
+		if err := le.release(); err != nil {
+			glog.Errorf("Could not release leader lease %s: %s", le.lease.Describe(), err)
+		} else {
+			glog.V(0).Infof("Released leader lease %s", le.lease.Describe())
+		}
+	}
+	return err
+}
+
+// release gives up the lease if this replica holds it.
+func (le *leaderElection) release() error {
+	record, err := le.lease.Get()
+	if err != nil {
+		return err
+	}
+	if record.HolderIdentity != le.lease.Identity() {
+		return nil
+	}
+	record.HolderIdentity = ""
+	record.LeaseDurationSeconds = 1
+	record.RenewTime = metav1.Now()
+	return le.lease.Update(*record)
+}
+
+// newWebhookServer returns a webhook server with the policies of the given
+// config, which are the same as those of the controller.
+func newWebhookServer(c *cli.Context, kubeconfig string, policies webhook.Config) (*webhook.Server, error) {
+	config, err := controller.BuildConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	config = rest.AddUserAgent(config, "webhook")
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	workshopClient, err := workshop.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+
+	policies.KubeClient = kubeClient
+	policies.WorkshopClient = workshopClient
+	policies.ServiceNamespace = c.String("webhook-service-namespace")
+	policies.ServiceName = c.String("webhook-service-name")
+	policies.Port = c.Int("webhook-port")
+	policies.ControllerUsername = c.String("webhook-controller-user")
+	if policies.ControllerUsername == "" {
+		policies.ControllerUsername = fmt.Sprintf("system:serviceaccount:%s:%s", policies.ServiceNamespace, policies.ServiceName)
+	}
+	return webhook.NewServer(policies)
+}
+
+func newResourceLimits(c *cli.Context) (apiv1.DeskResourceLimits, error) {
+	var limits apiv1.DeskResourceLimits
+	lists := []struct {
+		flag string
+		list *v1.ResourceList
+	}{
+		{"desk-quota", &limits.Quota},
+		{"desk-default-limits", &limits.DefaultLimits},
+		{"desk-default-requests", &limits.DefaultRequests},
+		{"desk-max-limits", &limits.MaxLimits},
+	}
+	for _, l := range lists {
+		list, err := apiv1.ParseResourceList(c.String(l.flag))
+		if err != nil {
+			return limits, fmt.Errorf("Invalid --%s: %s", l.flag, err)
+		}
+		*l.list = list
+	}
+	if err := apiv1.ValidateDeskResourceLimits(&limits); err != nil {
+		return limits, fmt.Errorf("Invalid desk resource limits: %s", err)
+	}
+	return limits, nil
+}
+
+func newExpirationPolicy(c *cli.Context) (apiv1.DeskExpirationPolicy, error) {
+	var policy apiv1.DeskExpirationPolicy
+	durations := []struct {
+		flag     string
+		duration **metav1.Duration
+	}{
+		{"max-desk-lifespan", &policy.MaxLifespan},
+		{"max-desk-lifetime", &policy.MaxLifetime},
+	}
+	for _, d := range durations {
+		value := c.String(d.flag)
+		if value == "" {
+			continue
+		}
+		duration, err := apiv1.ParseDuration(value)
+		if err != nil {
+			return policy, fmt.Errorf("Invalid --%s: %s", d.flag, err)
+		}
+		*d.duration = &metav1.Duration{Duration: duration}
+	}
+	if renewals := c.Int("max-desk-renewals"); renewals >= 0 {
+		n := int32(renewals)
+		policy.MaxRenewals = &n
+	}
+	if err := apiv1.ValidateDeskExpirationPolicy(&policy); err != nil {
+		return policy, fmt.Errorf("Invalid desk expiration policy: %s", err)
+	}
+	return policy, nil
+}
+
+func newOwnerLimits(c *cli.Context) (apiv1.DeskOwnerLimits, error) {
+	limits := apiv1.DeskOwnerLimits{MaxDesks: c.Int("max-desks-per-owner")}
+	resources, err := apiv1.ParseResourceList(c.String("max-resources-per-owner"))
+	if err != nil {
+		return limits, fmt.Errorf("Invalid --max-resources-per-owner: %s", err)
+	}
+	limits.MaxResources = resources
+	if err := apiv1.ValidateDeskOwnerLimits(&limits); err != nil {
+		return limits, fmt.Errorf("Invalid desk owner limits: %s", err)
+	}
+	return limits, nil
+}
+
 func isDomainName(domain string) bool {
 	// TODO: fix this
 	return true
@@ -53,15 +53,39 @@ func Run() error {
 					Name:    "desk",
 					Aliases: []string{"desks", "d"},
 					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "owner",
+							Usage: "create desk owned by user `OWNER` instead of the user named like the desk",
+						},
 						cli.StringFlag{
 							Name:  "version, v",
 							Value: workshopv1.DeskDefaultVersion,
 							Usage: "create desk with version `VERSION`",
 						},
+						cli.StringFlag{
+							Name:  "class, c",
+							Usage: "create desk from desk class `CLASS` instead of the default class",
+						},
+						cli.BoolFlag{
+							Name:  "disable-network-isolation",
+							Usage: "allow traffic to the desk from other desks",
+						},
 						cli.StringFlag{
 							Name:  "expiration, e",
-							Value: workshopv1.DeskMaxLifespan.String(),
-							Usage: "duration of desk lifespan",
+							Value: "2w",
+							Usage: "expire the desk after `DURATION`, e.g. \"90m\", \"3d\" or \"2w\"",
+						},
+						cli.StringFlag{
+							Name:  "expires-at",
+							Usage: "expire the desk at RFC 3339 `TIME` instead of after --expiration",
+						},
+						cli.StringSliceFlag{
+							Name:  "collaborator",
+							Usage: "also give `USER` access to the namespaces of the desk, if the controller binds the users of desks",
+						},
+						cli.StringSliceFlag{
+							Name:  "collaborator-group",
+							Usage: "also give `GROUP` access to the namespaces of the desk, if the controller binds the users of desks",
 						},
 					},
 					Action: workshopctl.CreateDesk,
@@ -75,7 +99,50 @@ func Run() error {
 				{
 					Name:    "desk",
 					Aliases: []string{"desks", "d"},
-					Action:  workshopctl.GetDesk,
+					Usage:   "list desks, or get a desk by name",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "print desks as `FORMAT`, one of json, yaml, wide, name, jsonpath=TEMPLATE, go-template=TEMPLATE or custom-columns=HEADER:FIELD,...",
+						},
+						cli.StringFlag{
+							Name:  "sort-by",
+							Usage: "sort desks by the jsonpath `FIELD`, e.g. \".metadata.creationTimestamp\" or \".spec.owner\"",
+						},
+						cli.BoolFlag{
+							Name:  "watch, w",
+							Usage: "after printing the desks, print changes of them as they happen",
+						},
+						cli.BoolFlag{
+							Name:  "watch-only",
+							Usage: "print changes of the desks as they happen, without printing them first",
+						},
+					},
+					Action: workshopctl.GetDesk,
+				},
+				{
+					Name:    "class",
+					Aliases: []string{"classes", "c"},
+					Usage:   "list the desk classes that desks can be created from",
+					Action:  workshopctl.GetDeskClass,
+				},
+				{
+					Name:    "version",
+					Aliases: []string{"versions", "v"},
+					Usage:   "list the desk versions that desks can be created with",
+					Action:  workshopctl.GetDeskVersion,
+				},
+			},
+		},
+		{
+			Name:  "describe",
+			Usage: "show details of a workshop resource",
+			Subcommands: cli.Commands{
+				{
+					Name:    "desk",
+					Aliases: []string{"desks", "d"},
+					Usage:   "show the state and conditions of a desk, the resources built for it and their recent events",
+					Action:  workshopctl.DescribeDesk,
 				},
 			},
 		},
@@ -91,10 +158,114 @@ func Run() error {
 							Name:  "all",
 							Usage: "delete all desks`",
 						},
+						cli.StringFlag{
+							Name:  "selector, l",
+							Usage: "delete the desks matching label `SELECTOR`",
+						},
 					},
 					Action: workshopctl.DeleteDesk,
 				},
 			}},
+		{
+			Name:  "renew",
+			Usage: "extend the expiration of a workshop resource",
+			Subcommands: cli.Commands{
+				{
+					Name:    "desk",
+					Aliases: []string{"desks", "d"},
+					Usage:   "extend the expiration of a desk, subject to its expiration policy",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "by",
+							Usage: "extend the expiration by `DURATION`, e.g. \"3d\" or \"1w\"",
+						},
+						cli.StringFlag{
+							Name:  "until",
+							Usage: "extend the expiration to RFC 3339 `TIME`",
+						},
+					},
+					Action: workshopctl.RenewDesk,
+				},
+			},
+		},
+		{
+			Name:  "suspend",
+			Usage: "scale a workshop resource down while keeping it",
+			Subcommands: cli.Commands{
+				{
+					Name:    "desk",
+					Aliases: []string{"desks", "d"},
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "suspend all desks",
+						},
+						cli.StringFlag{
+							Name:  "selector, l",
+							Usage: "suspend the desks matching label `SELECTOR`",
+						},
+					},
+					Action: workshopctl.SuspendDesk,
+				},
+			},
+		},
+		{
+			Name:  "resume",
+			Usage: "scale a suspended workshop resource back up",
+			Subcommands: cli.Commands{
+				{
+					Name:    "desk",
+					Aliases: []string{"desks", "d"},
+					Flags: []cli.Flag{
+						cli.BoolFlag{
+							Name:  "all",
+							Usage: "resume all desks",
+						},
+						cli.StringFlag{
+							Name:  "selector, l",
+							Usage: "resume the desks matching label `SELECTOR`",
+						},
+					},
+					Action: workshopctl.ResumeDesk,
+				},
+			},
+		},
+		{
+			Name:  "shell",
+			Usage: "open a shell in a workshop resource",
+			Subcommands: cli.Commands{
+				{
+					Name:    "desk",
+					Aliases: []string{"desks", "d"},
+					Usage:   "open an interactive shell in the kubeshell of a desk",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "command, c",
+							Usage: "run `COMMAND` in the kubeshell instead of an interactive shell",
+						},
+					},
+					Action: workshopctl.ShellDesk,
+				},
+			},
+		},
+		{
+			Name:  "kubeconfig",
+			Usage: "print the kubeconfig of a workshop resource",
+			Subcommands: cli.Commands{
+				{
+					Name:    "desk",
+					Aliases: []string{"desks", "d"},
+					Usage:   "print the kubeconfig with the credentials of the serviceaccount of a desk",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "output, o",
+							Usage: "write the kubeconfig to `FILE` instead of standard output",
+						},
+					},
+					Action: workshopctl.KubeconfigDesk,
+				},
+			},
+		},
 	}
 
 	sort.Sort(cli.FlagsByName(app.Flags))
@@ -0,0 +1,46 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SetDeskDefaults defaults the version of the desk to DeskDefaultVersion and
+// its expiration to DeskMaxLifespan after creation. Expirations beyond what
+// the expiration policy of the desk allows are shortened by the controller.
+// It returns whether the desk changed.
+func SetDeskDefaults(desk *Desk) bool {
+	changed := false
+	if desk.Spec.Version == "" {
+		desk.Spec.Version = DeskDefaultVersion
+		changed = true
+	}
+	if !desk.CreationTimestamp.IsZero() && desk.Spec.ExpirationTimestamp.IsZero() {
+		desk.Spec.ExpirationTimestamp = metav1.NewTime(desk.CreationTimestamp.Add(DeskMaxLifespan))
+		changed = true
+	}
+	return changed
+}
+
+// SetDeskClassDefaults defaults the shell of the desk class to run in the
+// first namespace, to use the last namespace as working namespace and to be
+// served on DeskShellDefaultPort, and the shell to be exposed by an ingress
+// at "/kubeshell".
+func SetDeskClassDefaults(class *DeskClass) {
+	if n := len(class.Spec.Namespaces); n > 0 {
+		if class.Spec.Shell.Namespace == "" {
+			class.Spec.Shell.Namespace = class.Spec.Namespaces[0].Name
+		}
+		if class.Spec.Shell.WorkingNamespace == "" {
+			class.Spec.Shell.WorkingNamespace = class.Spec.Namespaces[n-1].Name
+		}
+	}
+	if class.Spec.Shell.Port == 0 {
+		class.Spec.Shell.Port = DeskShellDefaultPort
+	}
+	if class.Spec.Exposure.Type == "" {
+		class.Spec.Exposure.Type = DeskExposureIngress
+	}
+	if class.Spec.Exposure.Path == "" {
+		class.Spec.Exposure.Path = "/kubeshell"
+	}
+}
@@ -25,10 +25,42 @@ import (
 
 type DeskState string
 
+type DeskConditionType string
+
+type ConditionStatus string
+
 const (
 	DeskKind           string = "Desk"
 	DeskResourcePlural string = "desks"
 	DeskCRDName        string = DeskResourcePlural + "." + GroupName
+	DeskFinalizer      string = GroupName + "/teardown"
+
+	// Label of desk namespaces whose value is the name of their desk.
+	DeskNamespaceLabel string = GroupName + "/desk"
+
+	// Annotation of the workloads of a suspended desk whose value is their
+	// replica count before the desk was suspended.
+	DeskSuspendedReplicasAnnotation string = GroupName + "/suspended-replicas"
+
+	// Annotation of desks and of the pods in desk namespaces whose value is
+	// the RFC 3339 time of the latest activity in the desk, e.g. reported
+	// by a proxy or by a heartbeat of the shell.
+	DeskLastActivityAnnotation string = GroupName + "/last-activity"
+
+	// Name of the secret in the shell namespace of a desk that holds a
+	// kubeconfig with the credentials of the serviceaccount of the desk,
+	// and the key of the kubeconfig in the secret.
+	DeskKubeconfigSecretName string = "desk-kubeconfig"
+	DeskKubeconfigSecretKey  string = "kubeconfig"
+
+	// Annotation of the token secret of a desk whose value is the accepted
+	// expiration of the desk when the token was issued. The token is
+	// rotated whenever the desk is renewed.
+	DeskTokenRotationAnnotation string = GroupName + "/token-rotation"
+
+	// Kinds of the collaborators of desks.
+	DeskSubjectUser  string = "User"
+	DeskSubjectGroup string = "Group"
 
 	DeskDefaultVersion string        = "latest"
 	DeskMaxLifespan    time.Duration = time.Hour * 24 * 14
@@ -37,6 +69,20 @@ const (
 	DeskStateReady        DeskState = "Ready"
 	DeskStateExpired      DeskState = "Expired"
 	DeskStateTerminating  DeskState = "Terminating"
+	DeskStateInvalid      DeskState = "Invalid"
+	DeskStateFailed       DeskState = "Failed"
+	DeskStateSuspended    DeskState = "Suspended"
+
+	DeskConditionNamespacesReady          DeskConditionType = "NamespacesReady"
+	DeskConditionRBACReady                DeskConditionType = "RBACReady"
+	DeskConditionShellDeploymentAvailable DeskConditionType = "ShellDeploymentAvailable"
+	DeskConditionIngressReady             DeskConditionType = "IngressReady"
+	DeskConditionNetworkIsolated          DeskConditionType = "NetworkIsolated"
+	DeskConditionKubeconfigReady          DeskConditionType = "KubeconfigReady"
+
+	ConditionTrue    ConditionStatus = "True"
+	ConditionFalse   ConditionStatus = "False"
+	ConditionUnknown ConditionStatus = "Unknown"
 )
 
 type DeskSpec struct {
@@ -46,12 +92,108 @@ type DeskSpec struct {
 	// Owner of the desk (required)
 	Owner string `json:"owner"`
 
-	// Time after which desk will be auto-deleted. (optional; default - 2 weeks after creation)
+	// Time after which desk will be auto-deleted. Setting a later time renews
+	// the desk, subject to its expiration policy. (optional; default - the
+	// maximum lifespan of the expiration policy after creation)
 	ExpirationTimestamp metav1.Time `json:"expirationTimestamp,omitempty"`
+
+	// Name of the desk class that the resources of the desk are rendered
+	// from. (optional; default - the default desk class)
+	DeskClassName string `json:"deskClassName,omitempty"`
+
+	// Resource limits of the namespaces of the desk. Entries override the
+	// limits that the controller is configured with for the same
+	// resources. (optional)
+	Limits *DeskResourceLimits `json:"limits,omitempty"`
+
+	// Whether the pods of the desk can be reached from anywhere instead of
+	// only from the desk itself and, for the shell, from the ingress
+	// controller. (optional; default false)
+	DisableNetworkIsolation bool `json:"disableNetworkIsolation,omitempty"`
+
+	// Whether the shell of the desk is scaled to zero while the resources
+	// of the desk are kept. (optional; default false)
+	Suspended bool `json:"suspended,omitempty"`
+
+	// Users and groups that are bound to the roles of the desk along with
+	// its owner, if the controller binds the users of desks. (optional)
+	Collaborators []DeskSubject `json:"collaborators,omitempty"`
+}
+
+// DeskSubject is a user or group of the Kubernetes cluster.
+type DeskSubject struct {
+	// Kind of the subject, either "User" or "Group".
+	Kind string `json:"kind"`
+
+	// Name of the user or group as authenticated by the apiserver.
+	Name string `json:"name"`
 }
 
 type DeskStatus struct {
+	// Current lifecycle state of the desk.
 	State DeskState `json:"state,omitempty"`
+
+	// Human-readable explanation of the current state.
+	Message string `json:"message,omitempty"`
+
+	// Most recent desk generation observed by the controller.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Observations of the resources that make up the desk.
+	Conditions []DeskCondition `json:"conditions,omitempty"`
+
+	// Time of the latest observed activity in the desk.
+	LastActivityTime metav1.Time `json:"lastActivityTime,omitempty"`
+
+	// Time at which the controller first reported the desk as ready.
+	FirstReadyTime metav1.Time `json:"firstReadyTime,omitempty"`
+
+	// Expiration of the desk that the controller accepted under the
+	// expiration policy of the desk.
+	AcceptedExpirationTimestamp metav1.Time `json:"acceptedExpirationTimestamp,omitempty"`
+
+	// Renewals of the desk, oldest first.
+	Renewals []DeskRenewal `json:"renewals,omitempty"`
+
+	// URL of the kubeshell of the desk, if it is exposed by an ingress.
+	URL string `json:"url,omitempty"`
+
+	// Secret that holds the kubeconfig of the desk, once it is published.
+	KubeconfigSecret *DeskSecretReference `json:"kubeconfigSecret,omitempty"`
+}
+
+// DeskSecretReference refers to a secret in one of the namespaces of a desk.
+type DeskSecretReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+type DeskCondition struct {
+	// Type of the condition, e.g. NamespacesReady.
+	Type DeskConditionType `json:"type"`
+
+	// Status of the condition, one of True, False or Unknown.
+	Status ConditionStatus `json:"status"`
+
+	// Last time the condition transitioned from one status to another.
+	LastTransitionTime metav1.Time `json:"lastTransitionTime,omitempty"`
+
+	// One-word CamelCase reason for the condition's last transition.
+	Reason string `json:"reason,omitempty"`
+
+	// Human-readable message with details about the last transition.
+	Message string `json:"message,omitempty"`
+}
+
+// Condition returns the condition of the given type, or nil if the desk
+// status does not have one.
+func (s *DeskStatus) Condition(t DeskConditionType) *DeskCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == t {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
 }
 
 type Desk struct {
@@ -61,8 +203,39 @@ type Desk struct {
 	Status            DeskStatus `json:"status,omitempty"`
 }
 
+// IsActive returns whether the desk counts against the limits of its owner,
+// which it does until it expires or is deleted.
+func (d *Desk) IsActive() bool {
+	return d.DeletionTimestamp == nil && d.Status.State != DeskStateExpired
+}
+
+// NamespaceName returns the name of the namespace of the desk created from
+// the namespace template with the given name.
+func (d *Desk) NamespaceName(template string) string {
+	return d.Name + "-desk-" + template
+}
+
 func (d *Desk) DeepCopyObject() runtime.Object {
 	dCopy := *d
+	if d.Spec.Limits != nil {
+		dCopy.Spec.Limits = d.Spec.Limits.DeepCopy()
+	}
+	if d.Spec.Collaborators != nil {
+		dCopy.Spec.Collaborators = make([]DeskSubject, len(d.Spec.Collaborators))
+		copy(dCopy.Spec.Collaborators, d.Spec.Collaborators)
+	}
+	if d.Status.Conditions != nil {
+		dCopy.Status.Conditions = make([]DeskCondition, len(d.Status.Conditions))
+		copy(dCopy.Status.Conditions, d.Status.Conditions)
+	}
+	if d.Status.Renewals != nil {
+		dCopy.Status.Renewals = make([]DeskRenewal, len(d.Status.Renewals))
+		copy(dCopy.Status.Renewals, d.Status.Renewals)
+	}
+	if d.Status.KubeconfigSecret != nil {
+		ref := *d.Status.KubeconfigSecret
+		dCopy.Status.KubeconfigSecret = &ref
+	}
 	return &dCopy
 }
 
@@ -76,7 +249,9 @@ func (dl *DeskList) DeepCopyObject() runtime.Object {
 	dlCopy := *dl
 
 	items := make([]Desk, len(dl.Items))
-	copy(items, dl.Items)
+	for i := range dl.Items {
+		items[i] = *dl.Items[i].DeepCopyObject().(*Desk)
+	}
 	dlCopy.Items = items
 
 	return &dlCopy
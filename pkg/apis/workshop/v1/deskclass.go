@@ -0,0 +1,216 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/client-go/pkg/api/v1"
+)
+
+type DeskExposureType string
+
+const (
+	DeskClassKind           string = "DeskClass"
+	DeskClassResourcePlural string = "deskclasses"
+	DeskClassCRDName        string = DeskClassResourcePlural + "." + GroupName
+
+	// DeskClassDefaultAnnotation marks the desk class that is used for desks
+	// that do not name one, when set to "true".
+	DeskClassDefaultAnnotation string = GroupName + "/is-default-class"
+
+	DeskDefaultClass string = "default"
+
+	DeskShellDefaultPort int32 = 4200
+
+	// The shell is exposed by an ingress when the controller has a domain,
+	// and by a service otherwise.
+	DeskExposureIngress DeskExposureType = "Ingress"
+	// The shell is only exposed by a service.
+	DeskExposureService DeskExposureType = "Service"
+
+	DeskConditionClassResolved    DeskConditionType = "ClassResolved"
+	DeskConditionManifestsCreated DeskConditionType = "ManifestsCreated"
+)
+
+type DeskClassSpec struct {
+	// Human-readable description of the class. (optional)
+	Description string `json:"description,omitempty"`
+
+	// Namespaces created for each desk of the class. (required)
+	Namespaces []DeskNamespaceTemplate `json:"namespaces"`
+
+	// Shell run for each desk of the class.
+	Shell DeskShellTemplate `json:"shell"`
+
+	// How the shell is exposed.
+	Exposure DeskExposure `json:"exposure,omitempty"`
+
+	// Additional namespaced objects created for each desk of the class.
+	// (optional)
+	Manifests []DeskManifest `json:"manifests,omitempty"`
+
+	// Expiration policy of the desks of the class. Fields that are set
+	// override the policy that the controller is configured with.
+	// (optional)
+	ExpirationPolicy *DeskExpirationPolicy `json:"expirationPolicy,omitempty"`
+
+	// Expiration policies of the desks of particular owners, by owner.
+	// Fields that are set override the expiration policy of the class.
+	// (optional)
+	OwnerExpirationPolicies map[string]DeskExpirationPolicy `json:"ownerExpirationPolicies,omitempty"`
+}
+
+type DeskNamespaceTemplate struct {
+	// Name of the namespace template. The namespace of a desk is named
+	// "<desk>-desk-<name>". (required)
+	Name string `json:"name"`
+
+	// ClusterRoles bound to the desk serviceaccount in the namespace.
+	// (optional)
+	ClusterRoles []string `json:"clusterRoles,omitempty"`
+}
+
+type DeskShellTemplate struct {
+	// Namespace template in which the shell and the desk serviceaccount are
+	// created. (optional; default - the first namespace)
+	Namespace string `json:"namespace,omitempty"`
+
+	// Namespace template that kubectl uses by default in the shell.
+	// (optional; default - the last namespace)
+	WorkingNamespace string `json:"workingNamespace,omitempty"`
+
+	// Image of the shell container, overriding the image of the desk
+	// version. (optional)
+	Image string `json:"image,omitempty"`
+
+	// Environment variables set in the shell container after the ones of
+	// the desk version. (optional)
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Compute resources of the shell container, overriding the resources of
+	// the desk version when set. (optional)
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Port on which the shell is served. (optional; default 4200)
+	Port int32 `json:"port,omitempty"`
+}
+
+type DeskExposure struct {
+	// Type of exposure, one of Ingress or Service. (optional; default Ingress)
+	Type DeskExposureType `json:"type,omitempty"`
+
+	// Path of the shell on the desk host. (optional; default "/kubeshell")
+	Path string `json:"path,omitempty"`
+
+	// Annotations added to the ingress, e.g. for the ingress class or TLS.
+	// (optional)
+	IngressAnnotations map[string]string `json:"ingressAnnotations,omitempty"`
+}
+
+type DeskManifest struct {
+	// Namespace template in which the object is created. (required)
+	Namespace string `json:"namespace"`
+
+	// The object, which must be of one of the supported namespaced kinds.
+	// (required)
+	Object runtime.RawExtension `json:"object"`
+}
+
+// DeskClass is a cluster scoped template for the resources of a desk.
+type DeskClass struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DeskClassSpec `json:"spec"`
+}
+
+// IsDefault returns whether the desk class is the default desk class.
+func (dc *DeskClass) IsDefault() bool {
+	return dc.Annotations[DeskClassDefaultAnnotation] == "true"
+}
+
+// Namespace returns the namespace template with the given name.
+func (s *DeskClassSpec) Namespace(name string) *DeskNamespaceTemplate {
+	for i := range s.Namespaces {
+		if s.Namespaces[i].Name == name {
+			return &s.Namespaces[i]
+		}
+	}
+	return nil
+}
+
+func (dc *DeskClass) DeepCopyObject() runtime.Object {
+	dcCopy := *dc
+	if dc.Annotations != nil {
+		dcCopy.Annotations = make(map[string]string, len(dc.Annotations))
+		for k, v := range dc.Annotations {
+			dcCopy.Annotations[k] = v
+		}
+	}
+	if dc.Spec.Namespaces != nil {
+		dcCopy.Spec.Namespaces = make([]DeskNamespaceTemplate, len(dc.Spec.Namespaces))
+		for i, ns := range dc.Spec.Namespaces {
+			dcCopy.Spec.Namespaces[i] = ns
+			dcCopy.Spec.Namespaces[i].ClusterRoles = append([]string(nil), ns.ClusterRoles...)
+		}
+	}
+	if dc.Spec.Shell.Env != nil {
+		dcCopy.Spec.Shell.Env = make([]corev1.EnvVar, len(dc.Spec.Shell.Env))
+		for i := range dc.Spec.Shell.Env {
+			corev1.DeepCopy_v1_EnvVar(&dc.Spec.Shell.Env[i], &dcCopy.Spec.Shell.Env[i], nil)
+		}
+	}
+	corev1.DeepCopy_v1_ResourceRequirements(&dc.Spec.Shell.Resources, &dcCopy.Spec.Shell.Resources, nil)
+	if dc.Spec.Exposure.IngressAnnotations != nil {
+		dcCopy.Spec.Exposure.IngressAnnotations = make(map[string]string, len(dc.Spec.Exposure.IngressAnnotations))
+		for k, v := range dc.Spec.Exposure.IngressAnnotations {
+			dcCopy.Spec.Exposure.IngressAnnotations[k] = v
+		}
+	}
+	if dc.Spec.Manifests != nil {
+		dcCopy.Spec.Manifests = make([]DeskManifest, len(dc.Spec.Manifests))
+		for i, m := range dc.Spec.Manifests {
+			dcCopy.Spec.Manifests[i] = DeskManifest{
+				Namespace: m.Namespace,
+				Object:    runtime.RawExtension{Raw: append([]byte(nil), m.Object.Raw...)},
+			}
+		}
+	}
+	if dc.Spec.ExpirationPolicy != nil {
+		dcCopy.Spec.ExpirationPolicy = dc.Spec.ExpirationPolicy.DeepCopy()
+	}
+	if dc.Spec.OwnerExpirationPolicies != nil {
+		dcCopy.Spec.OwnerExpirationPolicies = make(map[string]DeskExpirationPolicy, len(dc.Spec.OwnerExpirationPolicies))
+		for owner, policy := range dc.Spec.OwnerExpirationPolicies {
+			dcCopy.Spec.OwnerExpirationPolicies[owner] = *policy.DeepCopy()
+		}
+	}
+	return &dcCopy
+}
+
+// ExpirationPolicy returns the expiration policy of the desks of the owner:
+// the given policy, overridden by the policy of the class and then by the
+// policy of the owner.
+func (dc *DeskClass) ExpirationPolicy(policy *DeskExpirationPolicy, owner string) *DeskExpirationPolicy {
+	merged := policy.Merge(dc.Spec.ExpirationPolicy)
+	if ownerPolicy, ok := dc.Spec.OwnerExpirationPolicies[owner]; ok {
+		merged = merged.Merge(&ownerPolicy)
+	}
+	return merged
+}
+
+type DeskClassList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DeskClass `json:"items"`
+}
+
+func (dcl *DeskClassList) DeepCopyObject() runtime.Object {
+	dclCopy := *dcl
+
+	items := make([]DeskClass, len(dcl.Items))
+	for i := range dcl.Items {
+		items[i] = *dcl.Items[i].DeepCopyObject().(*DeskClass)
+	}
+	dclCopy.Items = items
+
+	return &dclCopy
+}
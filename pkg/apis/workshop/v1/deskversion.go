@@ -0,0 +1,72 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	DeskVersionKind           string = "DeskVersion"
+	DeskVersionResourcePlural string = "deskversions"
+	DeskVersionCRDName        string = DeskVersionResourcePlural + "." + GroupName
+
+	DeskConditionVersionResolved DeskConditionType = "VersionResolved"
+)
+
+type DeskVersionSpec struct {
+	// Human-readable description of the version. (optional)
+	Description string `json:"description,omitempty"`
+
+	// Image of the desk shell container. (required)
+	Image string `json:"image"`
+
+	// Environment variables set in the desk shell container, in addition
+	// to the ones set by the controller. (optional)
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// Compute resources of the desk shell container. (optional)
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Version of kubectl used in the desk shell when the image provides
+	// more than one. (optional)
+	KubectlVersion string `json:"kubectlVersion,omitempty"`
+}
+
+// DeskVersion is a cluster scoped catalog entry that maps the version of a
+// desk, which is the name of the DeskVersion, to the shell it runs.
+type DeskVersion struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DeskVersionSpec `json:"spec"`
+}
+
+func (dv *DeskVersion) DeepCopyObject() runtime.Object {
+	dvCopy := *dv
+	if dv.Spec.Env != nil {
+		dvCopy.Spec.Env = make([]corev1.EnvVar, len(dv.Spec.Env))
+		for i := range dv.Spec.Env {
+			corev1.DeepCopy_v1_EnvVar(&dv.Spec.Env[i], &dvCopy.Spec.Env[i], nil)
+		}
+	}
+	corev1.DeepCopy_v1_ResourceRequirements(&dv.Spec.Resources, &dvCopy.Spec.Resources, nil)
+	return &dvCopy
+}
+
+type DeskVersionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DeskVersion `json:"items"`
+}
+
+func (dvl *DeskVersionList) DeepCopyObject() runtime.Object {
+	dvlCopy := *dvl
+
+	items := make([]DeskVersion, len(dvl.Items))
+	for i := range dvl.Items {
+		items[i] = *dvl.Items[i].DeepCopyObject().(*DeskVersion)
+	}
+	dvlCopy.Items = items
+
+	return &dvlCopy
+}
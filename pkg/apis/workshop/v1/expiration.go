@@ -0,0 +1,189 @@
+package v1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	DeskConditionRenewalAccepted DeskConditionType = "RenewalAccepted"
+)
+
+// DeskExpirationPolicy constrains how far into the future the expiration of
+// a desk may be set, both when the desk is created and when it is renewed.
+type DeskExpirationPolicy struct {
+	// Longest time from the creation or the renewal of a desk to its
+	// expiration. (optional; default - no limit)
+	MaxLifespan *metav1.Duration `json:"maxLifespan,omitempty"`
+
+	// Largest number of times the expiration of a desk may be extended.
+	// (optional; default - no limit)
+	MaxRenewals *int32 `json:"maxRenewals,omitempty"`
+
+	// Longest time from the creation of a desk to its expiration, including
+	// all renewals. (optional; default - no limit)
+	MaxLifetime *metav1.Duration `json:"maxLifetime,omitempty"`
+}
+
+// DeskRenewal records an extension of the expiration of a desk.
+type DeskRenewal struct {
+	// Time at which the controller accepted the renewal.
+	Time metav1.Time `json:"time"`
+
+	// Expiration of the desk before the renewal.
+	PreviousExpirationTimestamp metav1.Time `json:"previousExpirationTimestamp"`
+
+	// Expiration of the desk after the renewal.
+	ExpirationTimestamp metav1.Time `json:"expirationTimestamp"`
+
+	// Whether the requested expiration was shortened to the latest one the
+	// expiration policy allows.
+	Clamped bool `json:"clamped,omitempty"`
+}
+
+// DefaultDeskExpirationPolicy returns the policy of desks for which no other
+// policy is configured: a lifespan of DeskMaxLifespan and unlimited renewals.
+func DefaultDeskExpirationPolicy() *DeskExpirationPolicy {
+	return &DeskExpirationPolicy{
+		MaxLifespan: &metav1.Duration{Duration: DeskMaxLifespan},
+	}
+}
+
+// Merge returns a copy of the policy in which the fields that are set in
+// override replace its own.
+func (p *DeskExpirationPolicy) Merge(override *DeskExpirationPolicy) *DeskExpirationPolicy {
+	merged := p.DeepCopy()
+	if override == nil {
+		return merged
+	}
+	if override.MaxLifespan != nil {
+		merged.MaxLifespan = &metav1.Duration{Duration: override.MaxLifespan.Duration}
+	}
+	if override.MaxRenewals != nil {
+		n := *override.MaxRenewals
+		merged.MaxRenewals = &n
+	}
+	if override.MaxLifetime != nil {
+		merged.MaxLifetime = &metav1.Duration{Duration: override.MaxLifetime.Duration}
+	}
+	return merged
+}
+
+func (p *DeskExpirationPolicy) DeepCopy() *DeskExpirationPolicy {
+	pCopy := &DeskExpirationPolicy{}
+	if p.MaxLifespan != nil {
+		pCopy.MaxLifespan = &metav1.Duration{Duration: p.MaxLifespan.Duration}
+	}
+	if p.MaxRenewals != nil {
+		n := *p.MaxRenewals
+		pCopy.MaxRenewals = &n
+	}
+	if p.MaxLifetime != nil {
+		pCopy.MaxLifetime = &metav1.Duration{Duration: p.MaxLifetime.Duration}
+	}
+	return pCopy
+}
+
+// MaxExpiration returns the latest expiration that the policy allows for the
+// desk when its expiration is set at the given time, or the zero time if the
+// policy does not limit it.
+func (p *DeskExpirationPolicy) MaxExpiration(desk *Desk, at time.Time) time.Time {
+	var max time.Time
+	limit := func(t time.Time) {
+		if max.IsZero() || t.Before(max) {
+			max = t
+		}
+	}
+	if p.MaxLifespan != nil {
+		limit(at.Add(p.MaxLifespan.Duration))
+	}
+	if p.MaxLifetime != nil && !desk.CreationTimestamp.IsZero() {
+		limit(desk.CreationTimestamp.Add(p.MaxLifetime.Duration))
+	}
+	return max
+}
+
+// Renew returns the expiration to which the desk may be extended at the
+// given time when the requested expiration is asked for. Requests beyond the
+// limits of the policy are clamped to them. It returns an error if the desk
+// cannot be renewed at all, either because it was renewed as many times as
+// the policy allows or because the policy does not allow its expiration to
+// be any later than it is.
+func (p *DeskExpirationPolicy) Renew(desk *Desk, requested, at time.Time) (time.Time, error) {
+	if p.MaxRenewals != nil && int32(len(desk.Status.Renewals)) >= *p.MaxRenewals {
+		return time.Time{}, fmt.Errorf("desk was renewed %d times, which is the maximum", len(desk.Status.Renewals))
+	}
+	allowed := requested
+	if max := p.MaxExpiration(desk, at); !max.IsZero() && allowed.After(max) {
+		allowed = max
+	}
+	current := desk.Status.AcceptedExpirationTimestamp
+	if !allowed.After(current.Time) {
+		return time.Time{}, fmt.Errorf("desk cannot be renewed beyond %s", current.UTC().Format(time.RFC3339))
+	}
+	return allowed, nil
+}
+
+// ValidateDeskExpirationPolicy returns an error listing every invalid field
+// of the policy.
+func ValidateDeskExpirationPolicy(policy *DeskExpirationPolicy) error {
+	return validateDeskExpirationPolicy(policy, field.NewPath("expirationPolicy")).ToAggregate()
+}
+
+func validateDeskExpirationPolicy(policy *DeskExpirationPolicy, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	if policy.MaxLifespan != nil && policy.MaxLifespan.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxLifespan"), policy.MaxLifespan.Duration.String(), "must be positive"))
+	}
+	if policy.MaxRenewals != nil && *policy.MaxRenewals < 0 {
+		errs = append(errs, field.Invalid(path.Child("maxRenewals"), *policy.MaxRenewals, "must not be negative"))
+	}
+	if policy.MaxLifetime != nil && policy.MaxLifetime.Duration <= 0 {
+		errs = append(errs, field.Invalid(path.Child("maxLifetime"), policy.MaxLifetime.Duration.String(), "must be positive"))
+	}
+	return errs
+}
+
+// ParseDuration parses a duration like time.ParseDuration does, but also
+// accepts the units "d" for days and "w" for weeks, e.g. "3d" or "1w2d12h".
+func ParseDuration(s string) (time.Duration, error) {
+	rest := strings.TrimSpace(s)
+	var total time.Duration
+	for _, unit := range []struct {
+		suffix string
+		length time.Duration
+	}{
+		{"w", 7 * 24 * time.Hour},
+		{"d", 24 * time.Hour},
+	} {
+		i := strings.Index(rest, unit.suffix)
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseUint(rest[:i], 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration \"%s\"", s)
+		}
+		total += time.Duration(n) * unit.length
+		rest = rest[i+1:]
+	}
+	if rest == "" {
+		if total == 0 && strings.TrimSpace(s) == "" {
+			return 0, fmt.Errorf("invalid duration \"%s\"", s)
+		}
+		return total, nil
+	}
+	d, err := time.ParseDuration(rest)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration \"%s\"", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid duration \"%s\"", s)
+	}
+	return total + d, nil
+}
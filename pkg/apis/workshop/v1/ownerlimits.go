@@ -0,0 +1,77 @@
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	DeskConditionWithinOwnerLimits DeskConditionType = "WithinOwnerLimits"
+)
+
+// DeskOwnerLimits constrains the active desks of each owner, see
+// Desk.IsActive.
+type DeskOwnerLimits struct {
+	// Largest number of active desks of an owner. Zero means no limit.
+	MaxDesks int
+
+	// Largest total of the hard limits of the resource quotas of the
+	// namespaces of the active desks of an owner, e.g. of "requests.cpu".
+	// Resources that are not listed are not limited. (optional)
+	MaxResources corev1.ResourceList
+}
+
+// IsZero returns whether the limits do not limit anything.
+func (l *DeskOwnerLimits) IsZero() bool {
+	return l.MaxDesks == 0 && len(l.MaxResources) == 0
+}
+
+func (l *DeskOwnerLimits) DeepCopy() *DeskOwnerLimits {
+	return &DeskOwnerLimits{
+		MaxDesks:     l.MaxDesks,
+		MaxResources: copyResourceList(l.MaxResources),
+	}
+}
+
+// Check returns an error if another desk with the given footprint would
+// exceed the limits of the owner, who has the given number of active desks
+// with the given total footprint. See DeskResourceLimits.Footprint.
+func (l *DeskOwnerLimits) Check(owner string, desks int, used, footprint corev1.ResourceList) error {
+	if l.MaxDesks > 0 && desks >= l.MaxDesks {
+		return fmt.Errorf("owner \"%s\" already has %d active desks, which is the maximum", owner, desks)
+	}
+	total := AddResourceLists(copyResourceList(used), footprint)
+	var exceeded []string
+	for name, max := range l.MaxResources {
+		if quantity, ok := total[name]; ok && quantity.Cmp(max) > 0 {
+			exceeded = append(exceeded, fmt.Sprintf("%s (%s of at most %s)", name, quantity.String(), max.String()))
+		}
+	}
+	if len(exceeded) > 0 {
+		sort.Strings(exceeded)
+		return fmt.Errorf("desks of owner \"%s\" would exceed the resources per owner for %s", owner, strings.Join(exceeded, ", "))
+	}
+	return nil
+}
+
+// ValidateDeskOwnerLimits returns an error listing every invalid field of
+// the limits.
+func ValidateDeskOwnerLimits(limits *DeskOwnerLimits) error {
+	var errs []string
+	if limits.MaxDesks < 0 {
+		errs = append(errs, fmt.Sprintf("maxDesks: %d must not be negative", limits.MaxDesks))
+	}
+	for name, quantity := range limits.MaxResources {
+		if quantity.Sign() < 0 {
+			errs = append(errs, fmt.Sprintf("maxResources[%s]: %s must not be negative", name, quantity.String()))
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	return nil
+}
@@ -43,6 +43,10 @@ func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
 		&Desk{},
 		&DeskList{},
+		&DeskVersion{},
+		&DeskVersionList{},
+		&DeskClass{},
+		&DeskClassList{},
 	)
 	return nil
 }
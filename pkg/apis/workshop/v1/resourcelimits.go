@@ -0,0 +1,175 @@
+package v1
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	corev1 "k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	DeskConditionResourceLimitsReady DeskConditionType = "ResourceLimitsReady"
+)
+
+// DeskResourceLimits constrains the compute resources that can be used in
+// each namespace of a desk.
+type DeskResourceLimits struct {
+	// Hard limits of the resource quota of each namespace, e.g. of "pods",
+	// "requests.cpu" or "limits.memory". (optional)
+	Quota corev1.ResourceList `json:"quota,omitempty"`
+
+	// Limits of containers that do not set their own. (optional)
+	DefaultLimits corev1.ResourceList `json:"defaultLimits,omitempty"`
+
+	// Requests of containers that do not set their own. (optional)
+	DefaultRequests corev1.ResourceList `json:"defaultRequests,omitempty"`
+
+	// Largest limits that a single container may set. (optional)
+	MaxLimits corev1.ResourceList `json:"maxLimits,omitempty"`
+}
+
+// HasQuota returns whether the limits call for a resource quota.
+func (l *DeskResourceLimits) HasQuota() bool {
+	return len(l.Quota) > 0
+}
+
+// HasLimitRange returns whether the limits call for a limit range.
+func (l *DeskResourceLimits) HasLimitRange() bool {
+	return len(l.DefaultLimits) > 0 || len(l.DefaultRequests) > 0 || len(l.MaxLimits) > 0
+}
+
+// Merge returns a copy of the limits in which the entries of override
+// replace the entries for the same resources.
+func (l *DeskResourceLimits) Merge(override *DeskResourceLimits) *DeskResourceLimits {
+	merged := l.DeepCopy()
+	if override == nil {
+		return merged
+	}
+	merged.Quota = mergeResourceLists(merged.Quota, override.Quota)
+	merged.DefaultLimits = mergeResourceLists(merged.DefaultLimits, override.DefaultLimits)
+	merged.DefaultRequests = mergeResourceLists(merged.DefaultRequests, override.DefaultRequests)
+	merged.MaxLimits = mergeResourceLists(merged.MaxLimits, override.MaxLimits)
+	return merged
+}
+
+// Footprint returns the total of the hard limits of the resource quotas of a
+// desk with the given number of namespaces.
+func (l *DeskResourceLimits) Footprint(namespaces int) corev1.ResourceList {
+	footprint := make(corev1.ResourceList, len(l.Quota))
+	for name, quantity := range l.Quota {
+		total := resource.Quantity{Format: quantity.Format}
+		for i := 0; i < namespaces; i++ {
+			total.Add(quantity)
+		}
+		footprint[name] = total
+	}
+	return footprint
+}
+
+func (l *DeskResourceLimits) DeepCopy() *DeskResourceLimits {
+	return &DeskResourceLimits{
+		Quota:           copyResourceList(l.Quota),
+		DefaultLimits:   copyResourceList(l.DefaultLimits),
+		DefaultRequests: copyResourceList(l.DefaultRequests),
+		MaxLimits:       copyResourceList(l.MaxLimits),
+	}
+}
+
+func copyResourceList(list corev1.ResourceList) corev1.ResourceList {
+	if list == nil {
+		return nil
+	}
+	listCopy := make(corev1.ResourceList, len(list))
+	for name, quantity := range list {
+		listCopy[name] = quantity.DeepCopy()
+	}
+	return listCopy
+}
+
+// AddResourceLists adds the quantities of add to list, which it returns.
+func AddResourceLists(list, add corev1.ResourceList) corev1.ResourceList {
+	if list == nil {
+		list = make(corev1.ResourceList, len(add))
+	}
+	for name, quantity := range add {
+		total := list[name]
+		total.Add(quantity)
+		list[name] = total
+	}
+	return list
+}
+
+func mergeResourceLists(list, override corev1.ResourceList) corev1.ResourceList {
+	if len(override) == 0 {
+		return list
+	}
+	if list == nil {
+		list = make(corev1.ResourceList, len(override))
+	}
+	for name, quantity := range override {
+		list[name] = quantity.DeepCopy()
+	}
+	return list
+}
+
+// ParseResourceList parses a comma separated list of resource quantities,
+// e.g. "cpu=500m,memory=1Gi". The empty string is parsed as an empty list.
+func ParseResourceList(s string) (corev1.ResourceList, error) {
+	list := corev1.ResourceList{}
+	if strings.TrimSpace(s) == "" {
+		return list, nil
+	}
+	for _, entry := range strings.Split(s, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid resource quantity \"%s\", expected NAME=QUANTITY", entry)
+		}
+		quantity, err := resource.ParseQuantity(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid quantity of resource \"%s\": %s", parts[0], err)
+		}
+		list[corev1.ResourceName(parts[0])] = quantity
+	}
+	return list, nil
+}
+
+// ValidateDeskResourceLimits returns an error listing every invalid field of
+// the limits.
+func ValidateDeskResourceLimits(limits *DeskResourceLimits) error {
+	return validateDeskResourceLimits(limits, field.NewPath("limits")).ToAggregate()
+}
+
+func validateDeskResourceLimits(limits *DeskResourceLimits, path *field.Path) field.ErrorList {
+	var errs field.ErrorList
+	lists := []struct {
+		name string
+		list corev1.ResourceList
+	}{
+		{"quota", limits.Quota},
+		{"defaultLimits", limits.DefaultLimits},
+		{"defaultRequests", limits.DefaultRequests},
+		{"maxLimits", limits.MaxLimits},
+	}
+	for _, l := range lists {
+		for name, quantity := range l.list {
+			if quantity.Sign() < 0 {
+				errs = append(errs, field.Invalid(path.Child(l.name).Key(string(name)), quantity.String(), "must not be negative"))
+			}
+		}
+	}
+
+	// Defaults that the limit range itself rejects.
+	for name, request := range limits.DefaultRequests {
+		if limit, ok := limits.DefaultLimits[name]; ok && request.Cmp(limit) > 0 {
+			errs = append(errs, field.Invalid(path.Child("defaultRequests").Key(string(name)), request.String(), fmt.Sprintf("must not be greater than the default limit %s", limit.String())))
+		}
+	}
+	for name, limit := range limits.DefaultLimits {
+		if max, ok := limits.MaxLimits[name]; ok && limit.Cmp(max) > 0 {
+			errs = append(errs, field.Invalid(path.Child("defaultLimits").Key(string(name)), limit.String(), fmt.Sprintf("must not be greater than the maximum limit %s", max.String())))
+		}
+	}
+	return errs
+}
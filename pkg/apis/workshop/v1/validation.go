@@ -0,0 +1,240 @@
+package v1
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// DeskNamePattern matches DNS-1123 labels, because desk names are used
+	// in namespace names. Owners are any username, and DeskServiceAccountName
+	// maps them to the name of their serviceaccount.
+	DeskNamePattern string = "^[a-z0-9]([-a-z0-9]*[a-z0-9])?$"
+
+	// DeskVersionPattern matches valid container image tags, which desk
+	// versions were before they named DeskVersions. Desks keep accepting
+	// them, and DeskVersionName maps them to the name of a DeskVersion.
+	DeskVersionPattern   string = "^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$"
+	DeskVersionMaxLength int    = 128
+
+	// DeskVersionNamePattern and DeskClassNamePattern match DNS-1123
+	// subdomains, because they are the names of cluster scoped resources.
+	DeskVersionNamePattern   string = "^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$"
+	DeskVersionNameMaxLength int    = validation.DNS1123SubdomainMaxLength
+	DeskClassNamePattern     string = DeskVersionNamePattern
+	DeskClassNameMaxLength   int    = validation.DNS1123SubdomainMaxLength
+
+	// Longest desk name for which "<name>-desk-trusted" is still a valid
+	// namespace name.
+	DeskNameMaxLength int = validation.DNS1123LabelMaxLength - len("-desk-trusted")
+
+	// Longest desk class namespace name for which "<desk>-desk-<name>" is
+	// still a valid namespace name for desks with the longest name.
+	DeskNamespaceNameMaxLength int = validation.DNS1123LabelMaxLength - DeskNameMaxLength - len("-desk-")
+)
+
+var (
+	deskVersionRegexp = regexp.MustCompile(DeskVersionPattern)
+
+	// Runs of characters that may not appear in DNS-1123 labels.
+	notDNS1123LabelRegexp = regexp.MustCompile("[^-a-z0-9]+")
+)
+
+// Length of the hash of the owner in the names of serviceaccounts.
+const deskServiceAccountHashLength = 8
+
+// DeskServiceAccountName returns the name of the serviceaccount of the desk
+// owner. Owners that are DNS-1123 labels name their serviceaccount
+// themselves, while other usernames, such as "alice@example.com" or
+// "oidc:alice", are lowercased with dashes for invalid characters and
+// suffixed with a short hash of the username, such as
+// "alice-example-com-ff8d9819", so that owners that only differ in such
+// characters get distinct serviceaccounts.
+func DeskServiceAccountName(owner string) string {
+	if len(validation.IsDNS1123Label(owner)) == 0 {
+		return owner
+	}
+	sum := sha256.Sum256([]byte(owner))
+	hash := hex.EncodeToString(sum[:])[:deskServiceAccountHashLength]
+
+	name := notDNS1123LabelRegexp.ReplaceAllString(strings.ToLower(owner), "-")
+	if maxLength := validation.DNS1123LabelMaxLength - len(hash) - 1; len(name) > maxLength {
+		name = name[:maxLength]
+	}
+	name = strings.Trim(name, "-")
+	if name == "" {
+		return "user-" + hash
+	}
+	return name + "-" + hash
+}
+
+// DeskVersionName returns the name of the DeskVersion that a desk version
+// refers to. Versions that are DNS-1123 subdomains are names themselves,
+// while image tag style versions of desks created before DeskVersions
+// existed, such as "V1_7", refer to the DeskVersion named after them in
+// lower case with dashes for underscores, such as "v1-7".
+func DeskVersionName(version string) string {
+	return strings.Replace(strings.ToLower(version), "_", "-", -1)
+}
+
+// ValidateDesk returns an error listing every invalid field of the desk. It
+// expects defaults to have been set with SetDeskDefaults.
+func ValidateDesk(desk *Desk) error {
+	var errs field.ErrorList
+
+	namePath := field.NewPath("metadata", "name")
+	if len(desk.Name) > DeskNameMaxLength {
+		errs = append(errs, field.TooLong(namePath, desk.Name, DeskNameMaxLength))
+	}
+	for _, msg := range validation.IsDNS1123Label(desk.Name) {
+		errs = append(errs, field.Invalid(namePath, desk.Name, msg))
+	}
+
+	ownerPath := field.NewPath("spec", "owner")
+	if desk.Spec.Owner == "" {
+		errs = append(errs, field.Required(ownerPath, ""))
+	}
+
+	versionPath := field.NewPath("spec", "version")
+	if !deskVersionRegexp.MatchString(desk.Spec.Version) {
+		errs = append(errs, field.Invalid(versionPath, desk.Spec.Version, validation.RegexError("must be a valid image tag", DeskVersionPattern, DeskDefaultVersion, "v1.7.0")))
+	}
+
+	if desk.Spec.DeskClassName != "" {
+		classPath := field.NewPath("spec", "deskClassName")
+		for _, msg := range validation.IsDNS1123Subdomain(desk.Spec.DeskClassName) {
+			errs = append(errs, field.Invalid(classPath, desk.Spec.DeskClassName, msg))
+		}
+	}
+
+	if desk.Spec.Limits != nil {
+		errs = append(errs, validateDeskResourceLimits(desk.Spec.Limits, field.NewPath("spec", "limits"))...)
+	}
+
+	collaboratorsPath := field.NewPath("spec", "collaborators")
+	for i, subject := range desk.Spec.Collaborators {
+		path := collaboratorsPath.Index(i)
+		if subject.Kind != DeskSubjectUser && subject.Kind != DeskSubjectGroup {
+			errs = append(errs, field.NotSupported(path.Child("kind"), subject.Kind, []string{DeskSubjectUser, DeskSubjectGroup}))
+		}
+		if subject.Name == "" {
+			errs = append(errs, field.Required(path.Child("name"), ""))
+		}
+	}
+
+	return errs.ToAggregate()
+}
+
+// ValidateDeskVersion returns an error listing every invalid field of the
+// desk version.
+func ValidateDeskVersion(version *DeskVersion) error {
+	var errs field.ErrorList
+
+	namePath := field.NewPath("metadata", "name")
+	for _, msg := range validation.IsDNS1123Subdomain(version.Name) {
+		errs = append(errs, field.Invalid(namePath, version.Name, msg))
+	}
+
+	if version.Spec.Image == "" {
+		errs = append(errs, field.Required(field.NewPath("spec", "image"), ""))
+	}
+
+	envPath := field.NewPath("spec", "env")
+	for i, env := range version.Spec.Env {
+		if env.Name == "" {
+			errs = append(errs, field.Required(envPath.Index(i).Child("name"), ""))
+		}
+	}
+
+	return errs.ToAggregate()
+}
+
+// ValidateDeskClass returns an error listing every invalid field of the desk
+// class. It expects defaults to have been set with SetDeskClassDefaults.
+func ValidateDeskClass(class *DeskClass) error {
+	var errs field.ErrorList
+
+	namePath := field.NewPath("metadata", "name")
+	for _, msg := range validation.IsDNS1123Subdomain(class.Name) {
+		errs = append(errs, field.Invalid(namePath, class.Name, msg))
+	}
+
+	namespacesPath := field.NewPath("spec", "namespaces")
+	if len(class.Spec.Namespaces) == 0 {
+		errs = append(errs, field.Required(namespacesPath, "at least one namespace is required"))
+	}
+	names := make(map[string]bool)
+	for i, ns := range class.Spec.Namespaces {
+		nsNamePath := namespacesPath.Index(i).Child("name")
+		if len(ns.Name) > DeskNamespaceNameMaxLength {
+			errs = append(errs, field.TooLong(nsNamePath, ns.Name, DeskNamespaceNameMaxLength))
+		}
+		for _, msg := range validation.IsDNS1123Label(ns.Name) {
+			errs = append(errs, field.Invalid(nsNamePath, ns.Name, msg))
+		}
+		if names[ns.Name] {
+			errs = append(errs, field.Duplicate(nsNamePath, ns.Name))
+		}
+		names[ns.Name] = true
+		for j, role := range ns.ClusterRoles {
+			for _, msg := range validation.IsDNS1123Subdomain(role) {
+				errs = append(errs, field.Invalid(namespacesPath.Index(i).Child("clusterRoles").Index(j), role, msg))
+			}
+		}
+	}
+
+	shellPath := field.NewPath("spec", "shell")
+	if !names[class.Spec.Shell.Namespace] {
+		errs = append(errs, field.NotFound(shellPath.Child("namespace"), class.Spec.Shell.Namespace))
+	}
+	if !names[class.Spec.Shell.WorkingNamespace] {
+		errs = append(errs, field.NotFound(shellPath.Child("workingNamespace"), class.Spec.Shell.WorkingNamespace))
+	}
+	for _, msg := range validation.IsValidPortNum(int(class.Spec.Shell.Port)) {
+		errs = append(errs, field.Invalid(shellPath.Child("port"), class.Spec.Shell.Port, msg))
+	}
+	for i, env := range class.Spec.Shell.Env {
+		if env.Name == "" {
+			errs = append(errs, field.Required(shellPath.Child("env").Index(i).Child("name"), ""))
+		}
+	}
+
+	exposurePath := field.NewPath("spec", "exposure")
+	switch class.Spec.Exposure.Type {
+	case DeskExposureIngress, DeskExposureService:
+	default:
+		errs = append(errs, field.NotSupported(exposurePath.Child("type"), class.Spec.Exposure.Type, []string{string(DeskExposureIngress), string(DeskExposureService)}))
+	}
+	if !strings.HasPrefix(class.Spec.Exposure.Path, "/") {
+		errs = append(errs, field.Invalid(exposurePath.Child("path"), class.Spec.Exposure.Path, "must be an absolute path"))
+	}
+
+	manifestsPath := field.NewPath("spec", "manifests")
+	for i, manifest := range class.Spec.Manifests {
+		if !names[manifest.Namespace] {
+			errs = append(errs, field.NotFound(manifestsPath.Index(i).Child("namespace"), manifest.Namespace))
+		}
+		if len(manifest.Object.Raw) == 0 {
+			errs = append(errs, field.Required(manifestsPath.Index(i).Child("object"), ""))
+		}
+	}
+
+	if class.Spec.ExpirationPolicy != nil {
+		errs = append(errs, validateDeskExpirationPolicy(class.Spec.ExpirationPolicy, field.NewPath("spec", "expirationPolicy"))...)
+	}
+	ownerPoliciesPath := field.NewPath("spec", "ownerExpirationPolicies")
+	for owner, policy := range class.Spec.OwnerExpirationPolicies {
+		if owner == "" {
+			errs = append(errs, field.Required(ownerPoliciesPath.Key(owner), ""))
+		}
+		policy := policy
+		errs = append(errs, validateDeskExpirationPolicy(&policy, ownerPoliciesPath.Key(owner))...)
+	}
+
+	return errs.ToAggregate()
+}
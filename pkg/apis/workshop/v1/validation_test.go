@@ -0,0 +1,476 @@
+package v1
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1 "k8s.io/client-go/pkg/api/v1"
+)
+
+func TestValidateDesk(t *testing.T) {
+	created := metav1.NewTime(time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name    string
+		mutate  func(desk *Desk)
+		wantErr string
+	}{
+		{
+			name:   "valid desk",
+			mutate: func(desk *Desk) {},
+		},
+		{
+			name:    "empty owner",
+			mutate:  func(desk *Desk) { desk.Spec.Owner = "" },
+			wantErr: "spec.owner: Required value",
+		},
+		{
+			name:    "uppercase name",
+			mutate:  func(desk *Desk) { desk.Name = "Alice" },
+			wantErr: "metadata.name: Invalid value",
+		},
+		{
+			name:    "name too long for namespace names",
+			mutate:  func(desk *Desk) { desk.Name = strings.Repeat("a", DeskNameMaxLength+1) },
+			wantErr: "metadata.name: Too long",
+		},
+		{
+			name:   "longest name",
+			mutate: func(desk *Desk) { desk.Name = strings.Repeat("a", DeskNameMaxLength) },
+		},
+		{
+			name:   "email address owner",
+			mutate: func(desk *Desk) { desk.Spec.Owner = "alice@example.com" },
+		},
+		{
+			name:   "prefixed owner",
+			mutate: func(desk *Desk) { desk.Spec.Owner = "oidc:Alice_Smith" },
+		},
+		{
+			name:    "version with colon",
+			mutate:  func(desk *Desk) { desk.Spec.Version = "v1:latest" },
+			wantErr: "spec.version: Invalid value",
+		},
+		{
+			name:   "image tag style version",
+			mutate: func(desk *Desk) { desk.Spec.Version = "V1_7.0" },
+		},
+		{
+			name: "collaborators",
+			mutate: func(desk *Desk) {
+				desk.Spec.Collaborators = []DeskSubject{{Kind: DeskSubjectUser, Name: "bob@example.com"}, {Kind: DeskSubjectGroup, Name: "instructors"}}
+			},
+		},
+		{
+			name:    "collaborator of unsupported kind",
+			mutate:  func(desk *Desk) { desk.Spec.Collaborators = []DeskSubject{{Kind: "ServiceAccount", Name: "bob"}} },
+			wantErr: "spec.collaborators[0].kind: Unsupported value",
+		},
+		{
+			name:    "collaborator without name",
+			mutate:  func(desk *Desk) { desk.Spec.Collaborators = []DeskSubject{{Kind: DeskSubjectGroup}} },
+			wantErr: "spec.collaborators[0].name: Required value",
+		},
+		{
+			// Renewed desks expire later, within their expiration policy.
+			name: "expiration beyond max lifespan",
+			mutate: func(desk *Desk) {
+				desk.Spec.ExpirationTimestamp = metav1.NewTime(created.Add(DeskMaxLifespan + time.Hour))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desk := &Desk{
+				ObjectMeta: metav1.ObjectMeta{Name: "alice", CreationTimestamp: created},
+				Spec: DeskSpec{
+					Owner:               "alice",
+					Version:             DeskDefaultVersion,
+					ExpirationTimestamp: metav1.NewTime(created.Add(time.Hour)),
+				},
+			}
+			test.mutate(desk)
+
+			err := ValidateDesk(desk)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSetDeskDefaults(t *testing.T) {
+	created := metav1.NewTime(time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC))
+	maxExpiration := created.Add(DeskMaxLifespan)
+
+	tests := []struct {
+		name           string
+		version        string
+		expiration     time.Time
+		wantVersion    string
+		wantExpiration time.Time
+		wantChanged    bool
+	}{
+		{"unset fields", "", time.Time{}, DeskDefaultVersion, maxExpiration, true},
+		{"expiration beyond max lifespan", "v1", maxExpiration.Add(time.Hour), "v1", maxExpiration.Add(time.Hour), false},
+		{"set fields", "v1", created.Add(time.Hour), "v1", created.Add(time.Hour), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desk := &Desk{
+				ObjectMeta: metav1.ObjectMeta{Name: "alice", CreationTimestamp: created},
+				Spec:       DeskSpec{Owner: "alice", Version: test.version},
+			}
+			if !test.expiration.IsZero() {
+				desk.Spec.ExpirationTimestamp = metav1.NewTime(test.expiration)
+			}
+
+			if changed := SetDeskDefaults(desk); changed != test.wantChanged {
+				t.Errorf("Expected changed %v, got %v", test.wantChanged, changed)
+			}
+			if desk.Spec.Version != test.wantVersion {
+				t.Errorf("Expected version %q, got %q", test.wantVersion, desk.Spec.Version)
+			}
+			if !desk.Spec.ExpirationTimestamp.Time.Equal(test.wantExpiration) {
+				t.Errorf("Expected expiration %s, got %s", test.wantExpiration, desk.Spec.ExpirationTimestamp)
+			}
+		})
+	}
+}
+
+func TestDeskVersionName(t *testing.T) {
+	for version, want := range map[string]string{
+		DeskDefaultVersion: DeskDefaultVersion,
+		"v1.7.0":           "v1.7.0",
+		"V1_7_0-rc.1":      "v1-7-0-rc.1",
+	} {
+		if got := DeskVersionName(version); got != want {
+			t.Errorf("Expected name of version %q to be %q, got %q", version, want, got)
+		}
+	}
+}
+
+func TestDeskServiceAccountName(t *testing.T) {
+	for owner, want := range map[string]string{
+		"alice":             "alice",
+		"alice@example.com": "alice-example-com-ff8d9819",
+		"oidc:alice":        "oidc-alice-edbcc36c",
+		"@@":                "user-3330e5ba",
+	} {
+		if got := DeskServiceAccountName(owner); got != want {
+			t.Errorf("Expected serviceaccount name of owner %q to be %q, got %q", owner, want, got)
+		}
+	}
+
+	long := DeskServiceAccountName(strings.Repeat("a", validation.DNS1123LabelMaxLength) + "@example.com")
+	if msgs := validation.IsDNS1123Label(long); len(msgs) != 0 {
+		t.Errorf("Expected serviceaccount name %q of long owner to be a DNS-1123 label: %v", long, msgs)
+	}
+	if other := DeskServiceAccountName(strings.Repeat("a", validation.DNS1123LabelMaxLength) + "@example.org"); other == long {
+		t.Errorf("Expected distinct long owners to have distinct serviceaccount names, got %q", long)
+	}
+}
+
+func TestValidateDeskVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(version *DeskVersion)
+		wantErr string
+	}{
+		{
+			name:   "valid version",
+			mutate: func(version *DeskVersion) {},
+		},
+		{
+			name:    "uppercase name",
+			mutate:  func(version *DeskVersion) { version.Name = "V1.7.0" },
+			wantErr: "metadata.name: Invalid value",
+		},
+		{
+			name:    "empty image",
+			mutate:  func(version *DeskVersion) { version.Spec.Image = "" },
+			wantErr: "spec.image: Required value",
+		},
+		{
+			name:    "unnamed env var",
+			mutate:  func(version *DeskVersion) { version.Spec.Env[0].Name = "" },
+			wantErr: "spec.env[0].name: Required value",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			version := &DeskVersion{
+				ObjectMeta: metav1.ObjectMeta{Name: "v1.7.0"},
+				Spec: DeskVersionSpec{
+					Image: "joelanford/kubeshell:v1.7.0",
+					Env:   []corev1.EnvVar{{Name: "EDITOR", Value: "vim"}},
+				},
+			}
+			test.mutate(version)
+
+			err := ValidateDeskVersion(version)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateDeskClass(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(class *DeskClass)
+		wantErr string
+	}{
+		{
+			name:   "valid class",
+			mutate: func(class *DeskClass) {},
+		},
+		{
+			name:    "no namespaces",
+			mutate:  func(class *DeskClass) { class.Spec.Namespaces = nil },
+			wantErr: "spec.namespaces: Required value",
+		},
+		{
+			name:    "namespace name too long for namespace names",
+			mutate:  func(class *DeskClass) { class.Spec.Namespaces[1].Name = "workspace" },
+			wantErr: "spec.namespaces[1].name: Too long",
+		},
+		{
+			name:    "duplicate namespace",
+			mutate:  func(class *DeskClass) { class.Spec.Namespaces[1].Name = "trusted" },
+			wantErr: "spec.namespaces[1].name: Duplicate value",
+		},
+		{
+			name:    "shell in unknown namespace",
+			mutate:  func(class *DeskClass) { class.Spec.Shell.Namespace = "lab" },
+			wantErr: "spec.shell.namespace: Not found",
+		},
+		{
+			name:    "unknown exposure",
+			mutate:  func(class *DeskClass) { class.Spec.Exposure.Type = "NodePort" },
+			wantErr: "spec.exposure.type: Unsupported value",
+		},
+		{
+			name: "manifest in unknown namespace",
+			mutate: func(class *DeskClass) {
+				class.Spec.Manifests = []DeskManifest{{Namespace: "lab", Object: runtime.RawExtension{Raw: []byte("{}")}}}
+			},
+			wantErr: "spec.manifests[0].namespace: Not found",
+		},
+		{
+			name: "negative owner renewals",
+			mutate: func(class *DeskClass) {
+				n := int32(-1)
+				class.Spec.OwnerExpirationPolicies = map[string]DeskExpirationPolicy{"alice": {MaxRenewals: &n}}
+			},
+			wantErr: "spec.ownerExpirationPolicies[alice].maxRenewals: Invalid value",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			class := &DeskClass{
+				ObjectMeta: metav1.ObjectMeta{Name: "course"},
+				Spec: DeskClassSpec{
+					Namespaces: []DeskNamespaceTemplate{
+						{Name: "trusted", ClusterRoles: []string{"view"}},
+						{Name: "default", ClusterRoles: []string{"edit"}},
+					},
+				},
+			}
+			test.mutate(class)
+			SetDeskClassDefaults(class)
+
+			err := ValidateDeskClass(class)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseResourceList(t *testing.T) {
+	list, err := ParseResourceList("cpu=500m, memory=1Gi")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if cpu := list[corev1.ResourceCPU]; cpu.String() != "500m" {
+		t.Errorf("Expected cpu 500m, got %s", cpu.String())
+	}
+	if memory := list[corev1.ResourceMemory]; memory.String() != "1Gi" {
+		t.Errorf("Expected memory 1Gi, got %s", memory.String())
+	}
+
+	for _, s := range []string{"cpu", "=1", "cpu=lots"} {
+		if _, err := ParseResourceList(s); err == nil {
+			t.Errorf("Expected error parsing %q", s)
+		}
+	}
+}
+
+func TestDeskResourceLimitsMerge(t *testing.T) {
+	limits := &DeskResourceLimits{
+		DefaultLimits:   corev1.ResourceList{corev1.ResourceCPU: resource.MustParse("1"), corev1.ResourceMemory: resource.MustParse("1Gi")},
+		DefaultRequests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("512Mi")},
+	}
+	merged := limits.Merge(&DeskResourceLimits{
+		DefaultLimits: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+	})
+
+	if cpu := merged.DefaultLimits[corev1.ResourceCPU]; cpu.String() != "1" {
+		t.Errorf("Expected cpu limit 1 to be kept, got %s", cpu.String())
+	}
+	if memory := merged.DefaultLimits[corev1.ResourceMemory]; memory.String() != "256Mi" {
+		t.Errorf("Expected memory limit 256Mi from the override, got %s", memory.String())
+	}
+	if memory := limits.DefaultLimits[corev1.ResourceMemory]; memory.String() != "1Gi" {
+		t.Errorf("Expected merge to leave the limits unchanged, got memory limit %s", memory.String())
+	}
+	if err := ValidateDeskResourceLimits(merged); err == nil || !strings.Contains(err.Error(), "limits.defaultRequests[memory]") {
+		t.Errorf("Expected default memory request above the limit to be invalid, got %v", err)
+	}
+}
+
+func TestDeskOwnerLimitsCheck(t *testing.T) {
+	resourceLimits := &DeskResourceLimits{
+		Quota: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("500m")},
+	}
+	footprint := resourceLimits.Footprint(2)
+	if cpu := footprint[corev1.ResourceRequestsCPU]; cpu.String() != "1" {
+		t.Fatalf("Expected footprint of 1 cpu for 2 namespaces, got %s", cpu.String())
+	}
+
+	limits := &DeskOwnerLimits{
+		MaxDesks:     3,
+		MaxResources: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("2")},
+	}
+	tests := []struct {
+		name    string
+		desks   int
+		used    corev1.ResourceList
+		wantErr string
+	}{
+		{name: "first desk", desks: 0, used: corev1.ResourceList{}},
+		{name: "up to the resources", desks: 1, used: footprint},
+		{name: "beyond the resources", desks: 2, used: corev1.ResourceList{corev1.ResourceRequestsCPU: resource.MustParse("1500m")}, wantErr: "requests.cpu (2500m of at most 2)"},
+		{name: "beyond the desks", desks: 3, used: corev1.ResourceList{}, wantErr: "owner \"alice\" already has 3 active desks"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := limits.Check("alice", test.desks, test.used, footprint)
+			if test.wantErr == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %s", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "90m", want: 90 * time.Minute},
+		{in: "3d", want: 72 * time.Hour},
+		{in: "2w", want: 14 * 24 * time.Hour},
+		{in: "1w2d12h", want: 9*24*time.Hour + 12*time.Hour},
+		{in: "", wantErr: true},
+		{in: "3days", wantErr: true},
+		{in: "-1d", wantErr: true},
+		{in: "2d1w", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseDuration(test.in)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("Expected error parsing %q, got %s", test.in, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error parsing %q: %s", test.in, err)
+		} else if got != test.want {
+			t.Errorf("Expected %q to parse as %s, got %s", test.in, test.want, got)
+		}
+	}
+}
+
+func TestDeskExpirationPolicyRenew(t *testing.T) {
+	created := time.Date(2017, 7, 1, 0, 0, 0, 0, time.UTC)
+	now := created.Add(10 * 24 * time.Hour)
+	one := int32(1)
+	policy := DefaultDeskExpirationPolicy().Merge(&DeskExpirationPolicy{
+		MaxRenewals: &one,
+		MaxLifetime: &metav1.Duration{Duration: 20 * 24 * time.Hour},
+	})
+
+	tests := []struct {
+		name      string
+		requested time.Time
+		renewals  int
+		want      time.Time
+		wantErr   string
+	}{
+		{name: "within policy", requested: now.Add(3 * 24 * time.Hour), want: now.Add(3 * 24 * time.Hour)},
+		{name: "clamped to lifetime", requested: now.Add(14 * 24 * time.Hour), want: created.Add(20 * 24 * time.Hour)},
+		{name: "too many renewals", requested: now.Add(24 * time.Hour), renewals: 1, wantErr: "renewed 1 times"},
+		{name: "not after accepted expiration", requested: created.Add(12 * 24 * time.Hour), wantErr: "cannot be renewed beyond"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desk := &Desk{ObjectMeta: metav1.ObjectMeta{Name: "alice", CreationTimestamp: metav1.NewTime(created)}}
+			desk.Status.AcceptedExpirationTimestamp = metav1.NewTime(created.Add(12 * 24 * time.Hour))
+			desk.Status.Renewals = make([]DeskRenewal, test.renewals)
+
+			got, err := policy.Renew(desk, test.requested, now)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			if !got.Equal(test.want) {
+				t.Errorf("Expected expiration %s, got %s", test.want, got)
+			}
+		})
+	}
+}
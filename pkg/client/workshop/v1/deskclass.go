@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+type DeskClassesGetter interface {
+	DeskClasses() DeskClassInterface
+}
+
+type DeskClassInterface interface {
+	Create(*v1.DeskClass) (*v1.DeskClass, error)
+	Update(*v1.DeskClass) (*v1.DeskClass, error)
+	Delete(name string, options *metav1.DeleteOptions) error
+	DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error
+	Get(name string, options metav1.GetOptions) (*v1.DeskClass, error)
+	List(opts metav1.ListOptions) (*v1.DeskClassList, error)
+	Watch(opts metav1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.DeskClass, err error)
+}
+
+// deskClasses implements DeskClassInterface
+type deskClasses struct {
+	client rest.Interface
+}
+
+// newDeskClasses returns a DeskClasses
+func newDeskClasses(c *WorkshopV1Client) *deskClasses {
+	return &deskClasses{
+		client: c.RESTClient(),
+	}
+}
+
+// Create takes the representation of a desk class and creates it.  Returns the server's representation of the desk class, and an error, if there is any.
+func (c *deskClasses) Create(deskClass *v1.DeskClass) (result *v1.DeskClass, err error) {
+	result = &v1.DeskClass{}
+	err = c.client.Post().
+		Resource("deskclasses").
+		Body(deskClass).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a desk class and updates it. Returns the server's representation of the desk class, and an error, if there is any.
+func (c *deskClasses) Update(deskClass *v1.DeskClass) (result *v1.DeskClass, err error) {
+	result = &v1.DeskClass{}
+	err = c.client.Put().
+		Resource("deskclasses").
+		Name(deskClass.Name).
+		Body(deskClass).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the desk class and deletes it. Returns an error if one occurs.
+func (c *deskClasses) Delete(name string, options *metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("deskclasses").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *deskClasses) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	return c.client.Delete().
+		Resource("deskclasses").
+		VersionedParams(&listOptions, metav1.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Get takes name of the desk class, and returns the corresponding desk class object, and an error if there is any.
+func (c *deskClasses) Get(name string, options metav1.GetOptions) (result *v1.DeskClass, err error) {
+	result = &v1.DeskClass{}
+	err = c.client.Get().
+		Resource("deskclasses").
+		Name(name).
+		VersionedParams(&options, metav1.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of DeskClasses that match those selectors.
+func (c *deskClasses) List(opts metav1.ListOptions) (result *v1.DeskClassList, err error) {
+	result = &v1.DeskClassList{}
+	err = c.client.Get().
+		Resource("deskclasses").
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested desk classes.
+func (c *deskClasses) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Resource("deskclasses").
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Watch()
+}
+
+// Patch applies the patch and returns the patched desk class.
+func (c *deskClasses) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.DeskClass, err error) {
+	result = &v1.DeskClass{}
+	err = c.client.Patch(pt).
+		Resource("deskclasses").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
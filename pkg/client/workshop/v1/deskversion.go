@@ -0,0 +1,141 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	"github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+type DeskVersionsGetter interface {
+	DeskVersions() DeskVersionInterface
+}
+
+type DeskVersionInterface interface {
+	Create(*v1.DeskVersion) (*v1.DeskVersion, error)
+	Update(*v1.DeskVersion) (*v1.DeskVersion, error)
+	Delete(name string, options *metav1.DeleteOptions) error
+	DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error
+	Get(name string, options metav1.GetOptions) (*v1.DeskVersion, error)
+	List(opts metav1.ListOptions) (*v1.DeskVersionList, error)
+	Watch(opts metav1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.DeskVersion, err error)
+}
+
+// deskVersions implements DeskVersionInterface
+type deskVersions struct {
+	client rest.Interface
+}
+
+// newDeskVersions returns a DeskVersions
+func newDeskVersions(c *WorkshopV1Client) *deskVersions {
+	return &deskVersions{
+		client: c.RESTClient(),
+	}
+}
+
+// Create takes the representation of a desk version and creates it.  Returns the server's representation of the desk version, and an error, if there is any.
+func (c *deskVersions) Create(deskVersion *v1.DeskVersion) (result *v1.DeskVersion, err error) {
+	result = &v1.DeskVersion{}
+	err = c.client.Post().
+		Resource("deskversions").
+		Body(deskVersion).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a desk version and updates it. Returns the server's representation of the desk version, and an error, if there is any.
+func (c *deskVersions) Update(deskVersion *v1.DeskVersion) (result *v1.DeskVersion, err error) {
+	result = &v1.DeskVersion{}
+	err = c.client.Put().
+		Resource("deskversions").
+		Name(deskVersion.Name).
+		Body(deskVersion).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the desk version and deletes it. Returns an error if one occurs.
+func (c *deskVersions) Delete(name string, options *metav1.DeleteOptions) error {
+	return c.client.Delete().
+		Resource("deskversions").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *deskVersions) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	return c.client.Delete().
+		Resource("deskversions").
+		VersionedParams(&listOptions, metav1.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Get takes name of the desk version, and returns the corresponding desk version object, and an error if there is any.
+func (c *deskVersions) Get(name string, options metav1.GetOptions) (result *v1.DeskVersion, err error) {
+	result = &v1.DeskVersion{}
+	err = c.client.Get().
+		Resource("deskversions").
+		Name(name).
+		VersionedParams(&options, metav1.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of DeskVersions that match those selectors.
+func (c *deskVersions) List(opts metav1.ListOptions) (result *v1.DeskVersionList, err error) {
+	result = &v1.DeskVersionList{}
+	err = c.client.Get().
+		Resource("deskversions").
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested desk versions.
+func (c *deskVersions) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Resource("deskversions").
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Watch()
+}
+
+// Patch applies the patch and returns the patched desk version.
+func (c *deskVersions) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.DeskVersion, err error) {
+	result = &v1.DeskVersion{}
+	err = c.client.Patch(pt).
+		Resource("deskversions").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
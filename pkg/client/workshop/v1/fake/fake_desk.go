@@ -0,0 +1,122 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/testing"
+
+	v1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// FakeDesks implements DeskInterface
+type FakeDesks struct {
+	Fake *FakeWorkshopV1
+}
+
+var desksResource = schema.GroupVersionResource{Group: "workshop.lanford.io", Version: "v1", Resource: "desks"}
+
+var desksKind = schema.GroupVersionKind{Group: "workshop.lanford.io", Version: "v1", Kind: "Desk"}
+
+func (c *FakeDesks) Create(desk *v1.Desk) (result *v1.Desk, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(desksResource, desk), &v1.Desk{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.Desk), err
+}
+
+func (c *FakeDesks) Update(desk *v1.Desk) (result *v1.Desk, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(desksResource, desk), &v1.Desk{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.Desk), err
+}
+
+func (c *FakeDesks) UpdateStatus(desk *v1.Desk) (*v1.Desk, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(desksResource, "status", desk), &v1.Desk{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.Desk), err
+}
+
+func (c *FakeDesks) Delete(name string, options *metav1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(desksResource, name), &v1.Desk{})
+	return err
+}
+
+func (c *FakeDesks) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(desksResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1.DeskList{})
+	return err
+}
+
+func (c *FakeDesks) Get(name string, options metav1.GetOptions) (result *v1.Desk, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(desksResource, name), &v1.Desk{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.Desk), err
+}
+
+func (c *FakeDesks) List(opts metav1.ListOptions) (result *v1.DeskList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(desksResource, desksKind, opts), &v1.DeskList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1.DeskList{}
+	for _, item := range obj.(*v1.DeskList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested desks.
+func (c *FakeDesks) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(desksResource, opts))
+}
+
+// Patch applies the patch and returns the patched desk.
+func (c *FakeDesks) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.Desk, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(desksResource, name, data, subresources...), &v1.Desk{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.Desk), err
+}
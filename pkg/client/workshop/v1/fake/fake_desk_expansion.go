@@ -0,0 +1,32 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"k8s.io/client-go/testing"
+
+	v1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+func (c *FakeDesks) Finalize(desk *v1.Desk) (*v1.Desk, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateSubresourceAction(desksResource, "finalize", desk), &v1.Desk{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.Desk), err
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/testing"
+
+	v1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// FakeDeskClasses implements DeskClassInterface
+type FakeDeskClasses struct {
+	Fake *FakeWorkshopV1
+}
+
+var deskclassesResource = schema.GroupVersionResource{Group: "workshop.lanford.io", Version: "v1", Resource: "deskclasses"}
+
+var deskclassesKind = schema.GroupVersionKind{Group: "workshop.lanford.io", Version: "v1", Kind: "DeskClass"}
+
+func (c *FakeDeskClasses) Create(deskClass *v1.DeskClass) (result *v1.DeskClass, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(deskclassesResource, deskClass), &v1.DeskClass{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskClass), err
+}
+
+func (c *FakeDeskClasses) Update(deskClass *v1.DeskClass) (result *v1.DeskClass, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(deskclassesResource, deskClass), &v1.DeskClass{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskClass), err
+}
+
+func (c *FakeDeskClasses) Delete(name string, options *metav1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(deskclassesResource, name), &v1.DeskClass{})
+	return err
+}
+
+func (c *FakeDeskClasses) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(deskclassesResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1.DeskClassList{})
+	return err
+}
+
+func (c *FakeDeskClasses) Get(name string, options metav1.GetOptions) (result *v1.DeskClass, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(deskclassesResource, name), &v1.DeskClass{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskClass), err
+}
+
+func (c *FakeDeskClasses) List(opts metav1.ListOptions) (result *v1.DeskClassList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(deskclassesResource, deskclassesKind, opts), &v1.DeskClassList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1.DeskClassList{}
+	for _, item := range obj.(*v1.DeskClassList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested desk classes.
+func (c *FakeDeskClasses) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(deskclassesResource, opts))
+}
+
+// Patch applies the patch and returns the patched desk class.
+func (c *FakeDeskClasses) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.DeskClass, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(deskclassesResource, name, data, subresources...), &v1.DeskClass{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskClass), err
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/testing"
+
+	v1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// FakeDeskVersions implements DeskVersionInterface
+type FakeDeskVersions struct {
+	Fake *FakeWorkshopV1
+}
+
+var deskversionsResource = schema.GroupVersionResource{Group: "workshop.lanford.io", Version: "v1", Resource: "deskversions"}
+
+var deskversionsKind = schema.GroupVersionKind{Group: "workshop.lanford.io", Version: "v1", Kind: "DeskVersion"}
+
+func (c *FakeDeskVersions) Create(deskVersion *v1.DeskVersion) (result *v1.DeskVersion, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootCreateAction(deskversionsResource, deskVersion), &v1.DeskVersion{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskVersion), err
+}
+
+func (c *FakeDeskVersions) Update(deskVersion *v1.DeskVersion) (result *v1.DeskVersion, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootUpdateAction(deskversionsResource, deskVersion), &v1.DeskVersion{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskVersion), err
+}
+
+func (c *FakeDeskVersions) Delete(name string, options *metav1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewRootDeleteAction(deskversionsResource, name), &v1.DeskVersion{})
+	return err
+}
+
+func (c *FakeDeskVersions) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	action := testing.NewRootDeleteCollectionAction(deskversionsResource, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1.DeskVersionList{})
+	return err
+}
+
+func (c *FakeDeskVersions) Get(name string, options metav1.GetOptions) (result *v1.DeskVersion, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootGetAction(deskversionsResource, name), &v1.DeskVersion{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskVersion), err
+}
+
+func (c *FakeDeskVersions) List(opts metav1.ListOptions) (result *v1.DeskVersionList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootListAction(deskversionsResource, deskversionsKind, opts), &v1.DeskVersionList{})
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1.DeskVersionList{}
+	for _, item := range obj.(*v1.DeskVersionList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested desk versions.
+func (c *FakeDeskVersions) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewRootWatchAction(deskversionsResource, opts))
+}
+
+// Patch applies the patch and returns the patched desk version.
+func (c *FakeDeskVersions) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1.DeskVersion, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewRootPatchSubresourceAction(deskversionsResource, name, data, subresources...), &v1.DeskVersion{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1.DeskVersion), err
+}
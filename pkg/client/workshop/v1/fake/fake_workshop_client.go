@@ -0,0 +1,47 @@
+/*
+Copyright 2017 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/testing"
+
+	v1 "github.com/joelanford/workshop/pkg/client/workshop/v1"
+)
+
+type FakeWorkshopV1 struct {
+	*testing.Fake
+}
+
+func (c *FakeWorkshopV1) Desks() v1.DeskInterface {
+	return &FakeDesks{c}
+}
+
+func (c *FakeWorkshopV1) DeskVersions() v1.DeskVersionInterface {
+	return &FakeDeskVersions{c}
+}
+
+func (c *FakeWorkshopV1) DeskClasses() v1.DeskClassInterface {
+	return &FakeDeskClasses{c}
+}
+
+// RESTClient returns a RESTClient that is used to communicate
+// with API server by this client implementation.
+func (c *FakeWorkshopV1) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
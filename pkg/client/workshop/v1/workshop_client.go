@@ -11,6 +11,8 @@ import (
 type WorkshopV1Interface interface {
 	RESTClient() rest.Interface
 	DesksGetter
+	DeskVersionsGetter
+	DeskClassesGetter
 }
 
 type WorkshopV1Client struct {
@@ -21,6 +23,14 @@ func (c *WorkshopV1Client) Desks() DeskInterface {
 	return newDesks(c)
 }
 
+func (c *WorkshopV1Client) DeskVersions() DeskVersionInterface {
+	return newDeskVersions(c)
+}
+
+func (c *WorkshopV1Client) DeskClasses() DeskClassInterface {
+	return newDeskClasses(c)
+}
+
 func NewForConfig(c *rest.Config) (*WorkshopV1Client, error) {
 	config := *c
 	if err := setConfigDefaults(&config); err != nil {
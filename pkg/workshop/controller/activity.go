@@ -0,0 +1,114 @@
+package controller
+
+import (
+	"time"
+
+	"k8s.io/client-go/pkg/api/v1"
+	kcache "k8s.io/client-go/tools/cache"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+// deskLastActivity returns the time of the latest activity recorded for the
+// desk. Desks without recorded activity were last active at their creation,
+// and desks that were just resumed are active now.
+func deskLastActivity(desk *apiv1.Desk, now time.Time) time.Time {
+	if desk.Status.State == apiv1.DeskStateSuspended && !desk.Spec.Suspended {
+		return now
+	}
+	if !desk.Status.LastActivityTime.IsZero() {
+		return desk.Status.LastActivityTime.Time
+	}
+	return desk.CreationTimestamp.Time
+}
+
+// observeDeskActivity returns the time of the latest activity in the desk.
+// Only what people did in the desk counts as activity, as reported by the
+// last activity annotation of the desk or of the pods in its namespaces, e.g.
+// by a heartbeat of the shell while it is in use. Events are not activity,
+// because most of them are recorded by the cluster itself, e.g. for pulling
+// images or restarting a crashing container. Reported times in the future
+// are taken as now, so that a desk cannot be kept active by reporting a time
+// far ahead once.
+func (c *WorkshopController) observeDeskActivity(desk *apiv1.Desk) time.Time {
+	now := time.Now()
+	latest := deskLastActivity(desk, now)
+	observe := func(t time.Time) {
+		if t.After(latest) {
+			latest = t
+		}
+	}
+	if t, ok := parseLastActivity(desk.Annotations, now); ok {
+		observe(t)
+	}
+
+	namespaces, err := getOwnedObjects(c.namespacesInformer, desk.Name)
+	if err != nil {
+		glog.Errorf("Could not get namespaces of desk \"%s\" for activity: %s", desk.Name, err)
+	}
+	for _, namespace := range namespaces {
+		pods, err := c.podsInformer.GetIndexer().ByIndex(kcache.NamespaceIndex, namespace.GetName())
+		if err != nil {
+			glog.Errorf("Could not get pods in namespace \"%s\" of desk \"%s\" for activity: %s", namespace.GetName(), desk.Name, err)
+			continue
+		}
+		for _, obj := range pods {
+			if pod, ok := obj.(*v1.Pod); ok {
+				if t, ok := parseLastActivity(pod.Annotations, now); ok {
+					observe(t)
+				}
+			}
+		}
+	}
+
+	// Times are stored with a precision of seconds, so truncate them to
+	// keep the status from changing on every reconcile.
+	return latest.Truncate(time.Second)
+}
+
+// parseLastActivity returns the time of the last activity annotation, or now
+// if the annotation is later than now.
+func parseLastActivity(annotations map[string]string, now time.Time) (time.Time, bool) {
+	value, ok := annotations[apiv1.DeskLastActivityAnnotation]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if t.After(now) {
+		return now, true
+	}
+	return t, true
+}
+
+// suspendIdleDesk suspends the desk if it has been idle since lastActivity
+// for longer than the idle timeout, and otherwise schedules it to be checked
+// again when it would be. It returns the possibly updated desk.
+func (c *WorkshopController) suspendIdleDesk(desk *apiv1.Desk, lastActivity time.Time) (*apiv1.Desk, error) {
+	if c.idleTimeout == 0 || desk.Spec.Suspended {
+		c.idler.Cancel(desk.Name)
+		return desk, nil
+	}
+
+	deadline := lastActivity.Add(c.idleTimeout)
+	if time.Now().Before(deadline) {
+		c.idler.Schedule(desk.Name, deadline)
+		return desk, nil
+	}
+
+	c.idler.Cancel(desk.Name)
+	updated := desk.DeepCopyObject().(*apiv1.Desk)
+	updated.Spec.Suspended = true
+	updated, err := c.workshopClient.WorkshopV1().Desks().Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	metrics.DesksIdleSuspended.Inc()
+	c.recordDeskEvent(updated, v1.EventTypeNormal, deskEventIdleSuspended, "Suspended desk, which has been idle since %s", lastActivity)
+	glog.V(0).Infof("Suspended desk \"%s\", which has been idle since %s", desk.Name, lastActivity)
+	return updated, nil
+}
@@ -2,6 +2,7 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"time"
@@ -9,12 +10,18 @@ import (
 	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	kcache "k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 
 	"github.com/golang/glog"
+	"golang.org/x/sync/errgroup"
+
 	workshopv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
 	"github.com/joelanford/workshop/pkg/client/workshop"
 )
@@ -22,8 +29,6 @@ import (
 //
 // TODO:
 //   - Create a new struct type to store shared desk information.
-//   - Automatically re-create deleted resources owned by a desk
-//     (e.g. namespace, role binding, serviceaccount, deployment, etc.)
 //
 
 const (
@@ -31,41 +36,184 @@ const (
 	resyncPeriod = 5 * time.Minute
 )
 
+// Config holds the settings of a WorkshopController.
+type Config struct {
+	// Domain suffix of desk ingresses. Desks are not exposed by ingress if
+	// it is empty.
+	Domain string
+
+	// Timeout for the initial listing of desks and the resources they own.
+	InitialSyncTimeout time.Duration
+
+	// Number of desks reconciled in parallel.
+	Workers int
+
+	// Resource limits of every desk namespace, unless a desk overrides
+	// them.
+	ResourceLimits workshopv1.DeskResourceLimits
+
+	// Selector of the namespaces from which the kubeshells of desks can be
+	// reached, i.e. that of the ingress controller. Defaults to all
+	// namespaces that are not desk namespaces.
+	IngressNamespaceSelector *metav1.LabelSelector
+
+	// Whether the deployments and statefulsets in the working namespace of
+	// suspended desks are scaled to zero along with their shell.
+	SuspendWorkloads bool
+
+	// Time without activity after which desks are suspended. Desks are not
+	// suspended for being idle if it is zero.
+	IdleTimeout time.Duration
+
+	// Expiration policy of every desk, unless its class or the policy of
+	// its owner in that class overrides it.
+	ExpirationPolicy workshopv1.DeskExpirationPolicy
+
+	// Limits of the active desks of each owner. Desks beyond them are held
+	// back until other desks of their owner are gone.
+	OwnerLimits workshopv1.DeskOwnerLimits
+
+	// Whether the owner of each desk is bound as a user, along with the
+	// collaborators of the desk, to the same roles as the serviceaccount of
+	// the desk, so that they can use their own credentials in the desk
+	// namespaces.
+	BindDeskUsers bool
+
+	// URL of the apiserver in the kubeconfigs of desks. NewWorkshopController
+	// defaults it to the apiserver that the controller connects to. Desks get
+	// no kubeconfig if it is empty.
+	KubeconfigServer string
+
+	// Group whose members may manage the desks they own, if it is not
+	// empty. The controller grants the group access to desks, and the
+	// webhook restricts its members to desks whose owner is their username.
+	SelfServiceGroup string
+}
+
 type WorkshopController struct {
 	domain             string
 	initialSyncTimeout time.Duration
+	workers            int
+	resourceLimits     *workshopv1.DeskResourceLimits
+	expirationPolicy   *workshopv1.DeskExpirationPolicy
+	ownerLimits        *workshopv1.DeskOwnerLimits
+	selfServiceGroup   string
+	bindDeskUsers      bool
+	kubeconfigServer   string
+
+	ingressNamespaceSelector *metav1.LabelSelector
+	suspendWorkloads         bool
+	idleTimeout              time.Duration
 
 	kubeClient     kubernetes.Interface
 	apiExtClient   apiextensionsclient.Interface
 	workshopClient workshop.Interface
 
-	desksStore      kcache.Store
-	desksController kcache.Controller
+	desksStore             kcache.Store
+	desksController        kcache.Controller
+	desksQueue             workqueue.RateLimitingInterface
+	deskVersionsStore      kcache.Store
+	deskVersionsController kcache.Controller
+	deskClassesStore       kcache.Store
+	deskClassesController  kcache.Controller
+	expirer                *deskExpirer
+	idler                  *deskExpirer
+	health                 *healthTracker
+	eventBroadcaster       record.EventBroadcaster
+	recorder               record.EventRecorder
 
-	namespacesStore      kcache.Store
-	namespacesController kcache.Controller
+	namespacesInformer      kcache.SharedIndexInformer
+	serviceAccountsInformer kcache.SharedIndexInformer
+	rolesInformer           kcache.SharedIndexInformer
+	roleBindingsInformer    kcache.SharedIndexInformer
+	deploymentsInformer     kcache.SharedIndexInformer
+	servicesInformer        kcache.SharedIndexInformer
+	ingressesInformer       kcache.SharedIndexInformer
+	resourceQuotasInformer  kcache.SharedIndexInformer
+	limitRangesInformer     kcache.SharedIndexInformer
+	networkPoliciesInformer kcache.SharedIndexInformer
+	secretsInformer         kcache.SharedIndexInformer
+	podsInformer            kcache.SharedIndexInformer
 }
 
-func NewWorkshopController(kubeconfig string, domain string, timeout time.Duration) (*WorkshopController, error) {
-	c := &WorkshopController{
-		domain:             domain,
-		initialSyncTimeout: timeout,
+// NewWorkshopController returns a controller that uses clients built from
+// the kubeconfig file. See BuildConfig for how the file is located.
+func NewWorkshopController(kubeconfig string, config Config) (*WorkshopController, error) {
+	restConfig, err := BuildConfig(kubeconfig)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	apiExtClient, err := apiextensionsclient.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
 	}
-	if err := c.setClients(kubeconfig); err != nil {
+	workshopClient, err := workshop.NewForConfig(restConfig)
+	if err != nil {
 		return nil, err
 	}
+	if config.KubeconfigServer == "" {
+		config.KubeconfigServer = restConfig.Host
+	}
+	return NewWorkshopControllerForClients(kubeClient, apiExtClient, workshopClient, config), nil
+}
+
+// NewWorkshopControllerForClients returns a controller that uses the given
+// clients, e.g. the fake clientsets in tests.
+func NewWorkshopControllerForClients(kubeClient kubernetes.Interface, apiExtClient apiextensionsclient.Interface, workshopClient workshop.Interface, config Config) *WorkshopController {
+	c := &WorkshopController{
+		domain:             config.Domain,
+		initialSyncTimeout: config.InitialSyncTimeout,
+		workers:            config.Workers,
+		resourceLimits:     config.ResourceLimits.DeepCopy(),
+		expirationPolicy:   config.ExpirationPolicy.DeepCopy(),
+		ownerLimits:        config.OwnerLimits.DeepCopy(),
+		selfServiceGroup:   config.SelfServiceGroup,
+		bindDeskUsers:      config.BindDeskUsers,
+		kubeconfigServer:   config.KubeconfigServer,
+		kubeClient:         kubeClient,
+		apiExtClient:       apiExtClient,
+		workshopClient:     workshopClient,
+		desksQueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "desks"),
+
+		ingressNamespaceSelector: config.IngressNamespaceSelector,
+		suspendWorkloads:         config.SuspendWorkloads,
+		idleTimeout:              config.IdleTimeout,
+	}
+	if c.ingressNamespaceSelector == nil {
+		c.ingressNamespaceSelector = defaultIngressNamespaceSelector()
+	}
+	c.expirer = newDeskExpirer("expiration", c.enqueueDeskByName)
+	c.idler = newDeskExpirer("idle timeout", c.enqueueDeskByName)
+	c.health = newHealthTracker()
+	c.eventBroadcaster, c.recorder = newEventRecorder()
 	c.setDesksStore()
-	c.setNamespacesStore()
-	return c, nil
+	c.setDeskVersionsStore()
+	c.setDeskClassesStore()
+	c.setOwnedInformers()
+	return c
 }
 
 func (c *WorkshopController) Start(ctx context.Context) error {
-	glog.V(1).Infof("Creating desk custom resource definitions")
-	if err := c.createDeskCRD(); err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(1).Infoln("Desk custom resource definition already exists, continuing execution")
-		} else {
-			glog.Fatalf("Could not create Desk custom resource definition: %v", err)
+	glog.V(1).Infof("Creating workshop custom resource definitions")
+	if err := c.ensureCRDs(); err != nil {
+		glog.Fatalf("Could not create workshop custom resource definitions: %v", err)
+	}
+	c.health.setCRDEstablished()
+	c.startRecordingEvents()
+
+	if err := c.ensureDefaultDeskVersion(); err != nil {
+		glog.Errorf("Could not create default desk version \"%s\": %s", workshopv1.DeskDefaultVersion, err)
+	}
+	if err := c.ensureDefaultDeskClass(); err != nil {
+		glog.Errorf("Could not create default desk class \"%s\": %s", workshopv1.DeskDefaultClass, err)
+	}
+	if c.selfServiceGroup != "" {
+		if err := c.ensureSelfServiceRBAC(); err != nil {
+			glog.Errorf("Could not grant group \"%s\" access to desks: %s", c.selfServiceGroup, err)
 		}
 	}
 
@@ -73,54 +221,97 @@ func (c *WorkshopController) Start(ctx context.Context) error {
 
 	glog.V(2).Infof("Starting desksController")
 	go c.desksController.Run(ctx.Done())
-	go c.namespacesController.Run(ctx.Done())
-
-	// TODO: Refactor and improve this to wait concurrently for all resources
-	// to sync.
-	//
-	// Wait synchronously for the initial list operations to be
-	// complete of desks from APIServer.
-	c.waitForDesksSynced()
-	return c.waitForNamespacesSynced()
+	go c.deskVersionsController.Run(ctx.Done())
+	go c.deskClassesController.Run(ctx.Done())
+	for _, informer := range c.ownedInformers() {
+		go informer.Run(ctx.Done())
+	}
+
+	// Wait concurrently for the initial list operations of desks and all
+	// of the resources they own to complete.
+	syncGroup, _ := errgroup.WithContext(ctx)
+	syncGroup.Go(func() error {
+		return c.waitForSynced("desks", c.desksController.HasSynced)
+	})
+	syncGroup.Go(func() error {
+		return c.waitForSynced("deskversions", c.deskVersionsController.HasSynced)
+	})
+	syncGroup.Go(func() error {
+		return c.waitForSynced("deskclasses", c.deskClassesController.HasSynced)
+	})
+	for resource, informer := range c.ownedInformers() {
+		resource, informer := resource, informer
+		syncGroup.Go(func() error {
+			return c.waitForSynced(resource, informer.HasSynced)
+		})
+	}
+	if err := syncGroup.Wait(); err != nil {
+		return err
+	}
+
+	glog.V(2).Infof("Starting %d desk workers", c.workers)
+	for i := 0; i < c.workers; i++ {
+		go wait.Until(c.runDeskWorker, time.Second, ctx.Done())
+	}
+	c.health.setWorkersStarted()
+	go c.sendHeartbeats(ctx.Done())
+	go func() {
+		<-ctx.Done()
+		c.expirer.Stop()
+		c.idler.Stop()
+		c.desksQueue.ShutDown()
+	}()
+	return nil
 }
 
 func (c *WorkshopController) Clean() error {
-	glog.V(1).Infof("Deleting desk custom resource definition")
-	return c.deleteDeskCRD()
+	var errs []error
+	if err := c.deleteSelfServiceRBAC(); err != nil {
+		errs = append(errs, err)
+	}
+	for _, crd := range workshopCRDs() {
+		glog.V(1).Infof("Deleting custom resource definition \"%s\"", crd.name)
+		if err := c.deleteCRD(crd.name); err != nil && !apierrors.IsNotFound(err) {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
 }
 
-func (c *WorkshopController) setClients(kubeconfig string) error {
-	var (
-		config *rest.Config
-		err    error
-	)
+func (c *WorkshopController) waitForSynced(name string, hasSynced func() bool) error {
+	// Wait for controllers to have completed an initial resource listing
+	timeout := time.After(c.initialSyncTimeout)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-timeout:
+			return fmt.Errorf("Timeout waiting for %s initialization", name)
+		case <-ticker.C:
+			if hasSynced() {
+				glog.V(0).Infof("Initialized %s from apiserver", name)
+				return nil
+			}
+			glog.V(0).Infof("Waiting for %s to be initialized from apiserver...", name)
+		}
+	}
+}
 
+// BuildConfig returns the client configuration for the kubeconfig file, the
+// default kubeconfig file, the in-cluster configuration or localhost, in
+// that order of preference.
+func BuildConfig(kubeconfig string) (*rest.Config, error) {
 	defaultKubeconfig := filepath.Join(os.Getenv("HOME"), ".kube", "config")
 	if kubeconfig != "" {
-		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
+		return clientcmd.BuildConfigFromFlags("", kubeconfig)
 	} else if _, err := os.Stat(defaultKubeconfig); err == nil {
-		config, err = clientcmd.BuildConfigFromFlags("", defaultKubeconfig)
-	} else {
-		if config, err = rest.InClusterConfig(); err != nil {
-			config, _ = clientcmd.BuildConfigFromFlags("http://localhost:8080", "")
-		}
+		return clientcmd.BuildConfigFromFlags("", defaultKubeconfig)
 	}
-
-	c.kubeClient, err = kubernetes.NewForConfig(config)
+	config, err := rest.InClusterConfig()
 	if err != nil {
-		return err
+		config, _ = clientcmd.BuildConfigFromFlags("http://localhost:8080", "")
 	}
-
-	c.apiExtClient, err = apiextensionsclient.NewForConfig(config)
-	if err != nil {
-		return err
-	}
-
-	c.workshopClient, err = workshop.NewForConfig(config)
-	if err != nil {
-		return err
-	}
-	return nil
+	return config, nil
 }
 
 func (c *WorkshopController) cleanStaleResources() {
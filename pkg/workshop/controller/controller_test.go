@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	networkingv1 "k8s.io/client-go/pkg/apis/networking/v1"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+	kubetesting "k8s.io/client-go/testing"
+	kcache "k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	workshopfake "github.com/joelanford/workshop/pkg/client/workshop/fake"
+)
+
+const testDomain = "example.com"
+
+// fixture is a controller backed by fake clientsets. The informers are not
+// run; instead the desks and objects the fixture is created with are added
+// to both the fake clientsets and the informer caches, as if the informers
+// had synced. The default desk version and desk class are always present;
+// other desk versions and classes can be passed as objects.
+type fixture struct {
+	t *testing.T
+
+	kubeClient     *kubefake.Clientset
+	apiExtClient   *fakeAPIExtClientset
+	workshopClient *workshopfake.Clientset
+
+	controller *WorkshopController
+	recorder   *record.FakeRecorder
+}
+
+func newFixture(t *testing.T, domain string, desks []*apiv1.Desk, objects []runtime.Object) *fixture {
+	var workshopObjects, kubeObjects []runtime.Object
+	for _, desk := range desks {
+		workshopObjects = append(workshopObjects, desk)
+	}
+	objects = append([]runtime.Object{newDefaultDeskVersion(), newDefaultDeskClass()}, objects...)
+	for _, obj := range objects {
+		switch obj.(type) {
+		case *apiv1.DeskVersion, *apiv1.DeskClass:
+			workshopObjects = append(workshopObjects, obj)
+		default:
+			kubeObjects = append(kubeObjects, obj)
+		}
+	}
+
+	f := &fixture{
+		t:              t,
+		kubeClient:     kubefake.NewSimpleClientset(kubeObjects...),
+		apiExtClient:   newFakeAPIExtClientset(),
+		workshopClient: workshopfake.NewSimpleClientset(workshopObjects...),
+	}
+	f.controller = NewWorkshopControllerForClients(f.kubeClient, f.apiExtClient, f.workshopClient, Config{
+		Domain:             domain,
+		InitialSyncTimeout: time.Second,
+		Workers:            1,
+	})
+	f.recorder = record.NewFakeRecorder(100)
+	f.controller.recorder = f.recorder
+
+	for _, desk := range desks {
+		if err := f.controller.desksStore.Add(desk); err != nil {
+			t.Fatalf("Could not add desk %q to cache: %s", desk.Name, err)
+		}
+	}
+	for _, obj := range objects {
+		switch o := obj.(type) {
+		case *apiv1.DeskVersion:
+			if err := f.controller.deskVersionsStore.Add(o); err != nil {
+				t.Fatalf("Could not add desk version %q to cache: %s", o.Name, err)
+			}
+			continue
+		case *apiv1.DeskClass:
+			if err := f.controller.deskClassesStore.Add(o); err != nil {
+				t.Fatalf("Could not add desk class %q to cache: %s", o.Name, err)
+			}
+			continue
+		}
+		if err := f.informerFor(obj).GetIndexer().Add(obj); err != nil {
+			t.Fatalf("Could not add %T to cache: %s", obj, err)
+		}
+	}
+	return f
+}
+
+func (f *fixture) informerFor(obj runtime.Object) kcache.SharedIndexInformer {
+	switch obj.(type) {
+	case *v1.Namespace:
+		return f.controller.namespacesInformer
+	case *v1.ServiceAccount:
+		return f.controller.serviceAccountsInformer
+	case *rbacv1beta1.Role:
+		return f.controller.rolesInformer
+	case *rbacv1beta1.RoleBinding:
+		return f.controller.roleBindingsInformer
+	case *extensionsv1beta1.Deployment:
+		return f.controller.deploymentsInformer
+	case *v1.Service:
+		return f.controller.servicesInformer
+	case *extensionsv1beta1.Ingress:
+		return f.controller.ingressesInformer
+	case *v1.ResourceQuota:
+		return f.controller.resourceQuotasInformer
+	case *v1.LimitRange:
+		return f.controller.limitRangesInformer
+	case *networkingv1.NetworkPolicy:
+		return f.controller.networkPoliciesInformer
+	case *v1.Secret:
+		return f.controller.secretsInformer
+	case *v1.Pod:
+		return f.controller.podsInformer
+	}
+	f.t.Fatalf("No informer for %T", obj)
+	return nil
+}
+
+// writes counts the write actions that were sent to the fake clientsets,
+// keyed by verb and resource, e.g. "create namespaces".
+func (f *fixture) writes() map[string]int {
+	writes := make(map[string]int)
+	actions := append(f.kubeClient.Actions(), f.workshopClient.Actions()...)
+	for _, action := range actions {
+		switch action.GetVerb() {
+		case "get", "list", "watch":
+			continue
+		}
+		writes[fmt.Sprintf("%s %s", action.GetVerb(), action.GetResource().Resource)]++
+	}
+	return writes
+}
+
+// events returns the events that the controller recorded since the last call,
+// formatted as "type reason message".
+func (f *fixture) events() []string {
+	var events []string
+	for {
+		select {
+		case event := <-f.recorder.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func (f *fixture) getDesk(name string) *apiv1.Desk {
+	desk, err := f.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatalf("Could not get desk %q: %s", name, err)
+	}
+	return desk
+}
+
+func (f *fixture) getDeployment(namespace, name string) *extensionsv1beta1.Deployment {
+	deployment, err := f.kubeClient.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatalf("Could not get deployment \"%s/%s\": %s", namespace, name, err)
+	}
+	return deployment
+}
+
+func (f *fixture) getRoleBinding(namespace, name string) *rbacv1beta1.RoleBinding {
+	roleBinding, err := f.kubeClient.RbacV1beta1().RoleBindings(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		f.t.Fatalf("Could not get rolebinding \"%s/%s\": %s", namespace, name, err)
+	}
+	return roleBinding
+}
+
+func newTestDesk(name, owner string) *apiv1.Desk {
+	expiration := metav1.NewTime(time.Now().Add(time.Hour))
+	return &apiv1.Desk{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			UID:               types.UID(name + "-uid"),
+			Generation:        2,
+			CreationTimestamp: metav1.Now(),
+			Finalizers:        []string{apiv1.DeskFinalizer},
+		},
+		Spec: apiv1.DeskSpec{
+			Owner:               owner,
+			Version:             apiv1.DeskDefaultVersion,
+			ExpirationTimestamp: expiration,
+			DeskClassName:       apiv1.DeskDefaultClass,
+		},
+		Status: apiv1.DeskStatus{
+			AcceptedExpirationTimestamp: expiration,
+		},
+	}
+}
+
+func newTestDeskVersion(name, image string) *apiv1.DeskVersion {
+	return &apiv1.DeskVersion{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: apiv1.DeskVersionSpec{
+			Image:          image,
+			Env:            []v1.EnvVar{{Name: "EDITOR", Value: "vim"}},
+			KubectlVersion: name,
+			Resources: v1.ResourceRequirements{
+				Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+			},
+		},
+	}
+}
+
+// desiredDeskObjects returns the objects that the controller creates for
+// desk with the default desk class and version and without resource limits,
+// with an available kubeshell deployment.
+func desiredDeskObjects(desk *apiv1.Desk, domain string) []runtime.Object {
+	class := newDefaultDeskClass()
+	trusted := newDeskNamespace(desk, desk.Name+"-desk-trusted")
+	trusted.Status.Phase = v1.NamespaceActive
+	def := newDeskNamespace(desk, desk.Name+"-desk-default")
+	def.Status.Phase = v1.NamespaceActive
+	sa := newDeskServiceAccount(desk, apiv1.DeskServiceAccountName(desk.Spec.Owner), trusted)
+	deployment := newDeskKubeshellDeployment(desk, class, newDefaultDeskVersion(), "kubeshell", sa, trusted, def)
+	deployment.Status.AvailableReplicas = 1
+
+	objects := []runtime.Object{
+		trusted,
+		def,
+		sa,
+		newDeskRoleBinding(desk, sa.Name+"-view", "view", sa, nil, trusted),
+		newDeskRoleBinding(desk, sa.Name+"-edit", "edit", sa, nil, def),
+		deployment,
+		newDeskKubeshellService(desk, class, "kubeshell", trusted),
+		newDeskIsolationPolicy(desk, trusted),
+		newDeskIsolationPolicy(desk, def),
+		newKubeshellIngressPolicy(desk, class, "kubeshell", trusted, defaultIngressNamespaceSelector()),
+	}
+	if domain != "" {
+		objects = append(objects, newDeskKubeshellIngress(desk, class, "kubeshell", trusted, domain))
+	}
+	return objects
+}
+
+// withoutObject returns objects without the object of the same type as obj
+// with the given name.
+func withoutObject(objects []runtime.Object, obj runtime.Object, name string) []runtime.Object {
+	var filtered []runtime.Object
+	for _, o := range objects {
+		if object, err := meta.Accessor(o); err == nil && object.GetName() == name && reflect.TypeOf(o) == reflect.TypeOf(obj) {
+			continue
+		}
+		filtered = append(filtered, o)
+	}
+	return filtered
+}
+
+// newDeletingDesk returns a desk that is being deleted.
+func newDeletingDesk(name, owner string) *apiv1.Desk {
+	desk := newTestDesk(name, owner)
+	now := metav1.Now()
+	desk.DeletionTimestamp = &now
+	return desk
+}
+
+// lastAction returns the last action with the given verb and resource.
+func lastAction(actions []kubetesting.Action, verb, resource string) kubetesting.Action {
+	var last kubetesting.Action
+	for _, action := range actions {
+		if action.Matches(verb, resource) {
+			last = action
+		}
+	}
+	return last
+}
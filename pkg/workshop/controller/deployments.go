@@ -1,31 +1,55 @@
 package controller
 
 import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/api/v1"
 	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
 
 	"github.com/golang/glog"
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
 )
 
-func (c *WorkshopController) createDeskKubeshellDeployment(desk *apiv1.Desk, name string, inNamespace *v1.Namespace, kubectlNamespace *v1.Namespace) (*extensionsv1beta1.Deployment, error) {
+// newDeskKubeshellDeployment returns the kubeshell deployment of the desk,
+// which is scaled to zero while the desk is suspended. The shell of the desk
+// class takes precedence over the desk version.
+func newDeskKubeshellDeployment(desk *apiv1.Desk, class *apiv1.DeskClass, version *apiv1.DeskVersion, name string, sa *v1.ServiceAccount, inNamespace *v1.Namespace, kubectlNamespace *v1.Namespace) *extensionsv1beta1.Deployment {
 	replicas := int32(1)
+	if desk.Spec.Suspended {
+		replicas = 0
+	}
 	kubeshellLabels := map[string]string{
 		"app": name,
 	}
-	deployment, err := c.kubeClient.ExtensionsV1beta1().Deployments(inNamespace.Name).Create(&extensionsv1beta1.Deployment{
+	env := []v1.EnvVar{
+		{Name: "KS_USER", Value: desk.Spec.Owner},
+		{Name: "KS_IN_CLUSTER", Value: "true"},
+		{Name: "KS_NAMESPACE", Value: kubectlNamespace.Name},
+		{Name: "KS_ENABLE_SUDO", Value: "false"},
+	}
+	if version.Spec.KubectlVersion != "" {
+		env = append(env, v1.EnvVar{Name: "KS_KUBECTL_VERSION", Value: version.Spec.KubectlVersion})
+	}
+	env = append(env, version.Spec.Env...)
+	env = append(env, class.Spec.Shell.Env...)
+	image := version.Spec.Image
+	if class.Spec.Shell.Image != "" {
+		image = class.Spec.Shell.Image
+	}
+	resources := version.DeepCopyObject().(*apiv1.DeskVersion).Spec.Resources
+	if shell := class.Spec.Shell; len(shell.Resources.Limits) > 0 || len(shell.Resources.Requests) > 0 {
+		resources = class.DeepCopyObject().(*apiv1.DeskClass).Spec.Shell.Resources
+	}
+	return &extensionsv1beta1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:   name,
-			Labels: kubeshellLabels,
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: apiv1.SchemeGroupVersion.String(),
-					Kind:       apiv1.DeskKind,
-					Name:       desk.Name,
-					UID:        desk.UID,
-				},
-			},
+			Name:            name,
+			Namespace:       inNamespace.Name,
+			Labels:          kubeshellLabels,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
 		},
 		Spec: extensionsv1beta1.DeploymentSpec{
 			Replicas: &replicas,
@@ -37,30 +61,120 @@ func (c *WorkshopController) createDeskKubeshellDeployment(desk *apiv1.Desk, nam
 					Labels: kubeshellLabels,
 				},
 				Spec: v1.PodSpec{
-					ServiceAccountName: desk.Name,
+					ServiceAccountName: sa.Name,
 					Containers: []v1.Container{
 						{
-							Name:  name,
-							Image: "joelanford/kubeshell:v1.7.0-latest",
-							Env: []v1.EnvVar{
-								{Name: "KS_USER", Value: desk.Spec.Owner},
-								{Name: "KS_IN_CLUSTER", Value: "true"},
-								{Name: "KS_NAMESPACE", Value: kubectlNamespace.Name},
-								{Name: "KS_ENABLE_SUDO", Value: "false"},
-							},
+							Name:      name,
+							Image:     image,
+							Env:       env,
+							Resources: resources,
 							Ports: []v1.ContainerPort{
-								{Protocol: v1.ProtocolTCP, ContainerPort: 4200},
+								{Protocol: v1.ProtocolTCP, ContainerPort: class.Spec.Shell.Port},
 							},
 						},
 					},
 				},
 			},
 		},
-	})
+	}
+}
+
+// ensureDeskKubeshellDeployment creates the kubeshell deployment if it does
+// not exist and restores the fields managed by the controller if they were
+// modified.
+func (c *WorkshopController) ensureDeskKubeshellDeployment(desk *apiv1.Desk, class *apiv1.DeskClass, version *apiv1.DeskVersion, name string, sa *v1.ServiceAccount, inNamespace *v1.Namespace, kubectlNamespace *v1.Namespace) (_ *extensionsv1beta1.Deployment, err error) {
+	defer metrics.ObserveReconcile("deployment", desk.Spec.DeskClassName, time.Now(), &err)
+
+	desired := newDeskKubeshellDeployment(desk, class, version, name, sa, inNamespace, kubectlNamespace)
+	current, err := c.getDeployment(inNamespace.Name, name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskDeployment(desk, desired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*extensionsv1beta1.Deployment)
+	changed := setDeskOwnerReference(updated, desk)
+	if setDeploymentSpec(updated, desired) {
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	deployment, err := c.kubeClient.ExtensionsV1beta1().Deployments(inNamespace.Name).Update(updated)
 	if err != nil {
 		return nil, err
 	}
-	glog.V(1).Infof("Created deployment \"%s\" in namespace \"%s\" for desk \"%s\"", deployment.Name, inNamespace.Name, desk.Name)
+	glog.V(0).Infof("Repaired deployment \"%s\" in namespace \"%s\" for desk \"%s\"", deployment.Name, inNamespace.Name, desk.Name)
+	return deployment, nil
+}
+
+func (c *WorkshopController) getDeployment(namespace, name string) (*extensionsv1beta1.Deployment, error) {
+	if obj, ok := getCachedObject(c.deploymentsInformer, namespace, name); ok {
+		return obj.(*extensionsv1beta1.Deployment), nil
+	}
+	return c.kubeClient.ExtensionsV1beta1().Deployments(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskDeployment(desk *apiv1.Desk, desired *extensionsv1beta1.Deployment) (*extensionsv1beta1.Deployment, error) {
+	deployment, err := c.kubeClient.ExtensionsV1beta1().Deployments(desired.Namespace).Create(desired)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(1).Infof("Created deployment \"%s\" in namespace \"%s\" for desk \"%s\"", deployment.Name, desired.Namespace, desk.Name)
 
 	return deployment, nil
 }
+
+// setDeploymentSpec copies the fields of desired that are managed by the
+// controller to deployment, leaving fields defaulted by the apiserver alone.
+// It returns whether deployment changed.
+func setDeploymentSpec(deployment, desired *extensionsv1beta1.Deployment) bool {
+	changed := false
+	if mergeStringMap(&deployment.Labels, desired.Labels) {
+		changed = true
+	}
+	if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != *desired.Spec.Replicas {
+		deployment.Spec.Replicas = desired.Spec.Replicas
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(deployment.Spec.Selector, desired.Spec.Selector) {
+		deployment.Spec.Selector = desired.Spec.Selector
+		changed = true
+	}
+	if mergeStringMap(&deployment.Spec.Template.Labels, desired.Spec.Template.Labels) {
+		changed = true
+	}
+	if deployment.Spec.Template.Spec.ServiceAccountName != desired.Spec.Template.Spec.ServiceAccountName {
+		deployment.Spec.Template.Spec.ServiceAccountName = desired.Spec.Template.Spec.ServiceAccountName
+		changed = true
+	}
+	if !containersMatch(deployment.Spec.Template.Spec.Containers, desired.Spec.Template.Spec.Containers) {
+		deployment.Spec.Template.Spec.Containers = desired.Spec.Template.Spec.Containers
+		changed = true
+	}
+	return changed
+}
+
+// containersMatch returns whether the containers have the same names, images,
+// environment, resources and ports as the desired containers.
+func containersMatch(containers, desired []v1.Container) bool {
+	if len(containers) != len(desired) {
+		return false
+	}
+	for i := range containers {
+		if containers[i].Name != desired[i].Name ||
+			containers[i].Image != desired[i].Image ||
+			!equality.Semantic.DeepEqual(containers[i].Env, desired[i].Env) ||
+			!equality.Semantic.DeepEqual(containers[i].Resources, desired[i].Resources) ||
+			!equality.Semantic.DeepEqual(containers[i].Ports, desired[i].Ports) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"encoding/json"
 	"time"
 
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/errors"
 	"k8s.io/apimachinery/pkg/util/wait"
 
@@ -12,30 +15,318 @@ import (
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
 )
 
-func (c *WorkshopController) createDeskCRD() error {
-	crd := &apiextensionsv1beta1.CustomResourceDefinition{
+// workshopCRD is a custom resource definition created by the controller,
+// along with the schema that its resources are validated against.
+type workshopCRD struct {
+	name   string
+	plural string
+	kind   string
+	schema map[string]interface{}
+}
+
+// workshopCRDs returns the custom resource definitions of all workshop
+// resources.
+func workshopCRDs() []workshopCRD {
+	return []workshopCRD{
+		{apiv1.DeskCRDName, apiv1.DeskResourcePlural, apiv1.DeskKind, deskValidationSchema()},
+		{apiv1.DeskVersionCRDName, apiv1.DeskVersionResourcePlural, apiv1.DeskVersionKind, deskVersionValidationSchema()},
+		{apiv1.DeskClassCRDName, apiv1.DeskClassResourcePlural, apiv1.DeskClassKind, deskClassValidationSchema()},
+	}
+}
+
+// ensureCRDs creates the custom resource definitions of all workshop
+// resources, or waits for them to be established if they already exist.
+func (c *WorkshopController) ensureCRDs() error {
+	for _, crd := range workshopCRDs() {
+		if err := c.createCRD(crd); err != nil {
+			if !apierrors.IsAlreadyExists(err) {
+				return err
+			}
+			glog.V(1).Infof("Custom resource definition \"%s\" already exists, continuing execution", crd.name)
+			if err := c.waitForCRDEstablished(crd.name); err != nil {
+				return err
+			}
+		}
+		if err := c.setCRDValidation(crd.name, crd.schema); err != nil {
+			glog.Errorf("Could not set validation of custom resource definition \"%s\", %s are only validated by the controller: %s", crd.name, crd.plural, err)
+		}
+	}
+	return nil
+}
+
+func (c *WorkshopController) createCRD(crd workshopCRD) error {
+	definition := &apiextensionsv1beta1.CustomResourceDefinition{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: apiv1.DeskCRDName,
+			Name: crd.name,
 		},
 		Spec: apiextensionsv1beta1.CustomResourceDefinitionSpec{
 			Group:   apiv1.GroupName,
 			Version: apiv1.SchemeGroupVersion.Version,
 			Scope:   apiextensionsv1beta1.ClusterScoped,
 			Names: apiextensionsv1beta1.CustomResourceDefinitionNames{
-				Plural: apiv1.DeskResourcePlural,
-				Kind:   apiv1.DeskKind,
+				Plural: crd.plural,
+				Kind:   crd.kind,
 			},
 		},
 	}
 
-	_, err := c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Create(crd)
+	_, err := c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Create(definition)
+	if err != nil {
+		return err
+	}
+
+	err = c.waitForCRDEstablished(crd.name)
 	if err != nil {
+		deleteErr := c.deleteCRD(crd.name)
+		if deleteErr != nil {
+			return errors.NewAggregate([]error{err, deleteErr})
+		}
 		return err
 	}
+	return nil
+}
 
-	// wait for CRD being established
-	err = wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
-		crd, err = c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Get(apiv1.DeskCRDName, metav1.GetOptions{})
+// deskValidationSchema returns the OpenAPI v3 schema that the apiserver
+// validates desks against.
+func deskValidationSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":      "string",
+						"pattern":   apiv1.DeskNamePattern,
+						"maxLength": apiv1.DeskNameMaxLength,
+					},
+				},
+			},
+			"spec": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"owner"},
+				"properties": map[string]interface{}{
+					"owner": map[string]interface{}{
+						"type":      "string",
+						"minLength": 1,
+					},
+					"version": map[string]interface{}{
+						"type":      "string",
+						"pattern":   apiv1.DeskVersionPattern,
+						"maxLength": apiv1.DeskVersionMaxLength,
+					},
+					"expirationTimestamp": map[string]interface{}{
+						"type":   "string",
+						"format": "date-time",
+					},
+					"deskClassName": map[string]interface{}{
+						"type":      "string",
+						"pattern":   apiv1.DeskClassNamePattern,
+						"maxLength": apiv1.DeskClassNameMaxLength,
+					},
+					"disableNetworkIsolation": map[string]interface{}{
+						"type": "boolean",
+					},
+					"suspended": map[string]interface{}{
+						"type": "boolean",
+					},
+					"limits": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"quota":           map[string]interface{}{"type": "object"},
+							"defaultLimits":   map[string]interface{}{"type": "object"},
+							"defaultRequests": map[string]interface{}{"type": "object"},
+							"maxLimits":       map[string]interface{}{"type": "object"},
+						},
+					},
+					"collaborators": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"kind", "name"},
+							"properties": map[string]interface{}{
+								"kind": map[string]interface{}{
+									"type": "string",
+									"enum": []string{apiv1.DeskSubjectUser, apiv1.DeskSubjectGroup},
+								},
+								"name": map[string]interface{}{
+									"type":      "string",
+									"minLength": 1,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"required": []string{"spec"},
+	}
+}
+
+// deskVersionValidationSchema returns the OpenAPI v3 schema that the
+// apiserver validates desk versions against.
+func deskVersionValidationSchema() map[string]interface{} {
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":      "string",
+						"pattern":   apiv1.DeskVersionNamePattern,
+						"maxLength": apiv1.DeskVersionNameMaxLength,
+					},
+				},
+			},
+			"spec": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"image"},
+				"properties": map[string]interface{}{
+					"description": map[string]interface{}{
+						"type": "string",
+					},
+					"image": map[string]interface{}{
+						"type":      "string",
+						"minLength": 1,
+					},
+					"env": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"name"},
+						},
+					},
+					"resources": map[string]interface{}{
+						"type": "object",
+					},
+					"kubectlVersion": map[string]interface{}{
+						"type": "string",
+					},
+				},
+			},
+		},
+		"required": []string{"spec"},
+	}
+}
+
+// deskClassValidationSchema returns the OpenAPI v3 schema that the apiserver
+// validates desk classes against.
+func deskClassValidationSchema() map[string]interface{} {
+	namespaceName := map[string]interface{}{
+		"type":      "string",
+		"pattern":   apiv1.DeskNamePattern,
+		"maxLength": apiv1.DeskNamespaceNameMaxLength,
+	}
+	expirationPolicy := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"maxLifespan": map[string]interface{}{"type": "string"},
+			"maxRenewals": map[string]interface{}{
+				"type":    "integer",
+				"minimum": 0,
+			},
+			"maxLifetime": map[string]interface{}{"type": "string"},
+		},
+	}
+	return map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"spec": map[string]interface{}{
+				"type":     "object",
+				"required": []string{"namespaces"},
+				"properties": map[string]interface{}{
+					"description": map[string]interface{}{
+						"type": "string",
+					},
+					"namespaces": map[string]interface{}{
+						"type":     "array",
+						"minItems": 1,
+						"items": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"name"},
+							"properties": map[string]interface{}{
+								"name": namespaceName,
+								"clusterRoles": map[string]interface{}{
+									"type":  "array",
+									"items": map[string]interface{}{"type": "string"},
+								},
+							},
+						},
+					},
+					"shell": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"namespace":        namespaceName,
+							"workingNamespace": namespaceName,
+							"image":            map[string]interface{}{"type": "string"},
+							"port": map[string]interface{}{
+								"type":    "integer",
+								"minimum": 1,
+								"maximum": 65535,
+							},
+						},
+					},
+					"exposure": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"type": map[string]interface{}{
+								"type": "string",
+								"enum": []string{string(apiv1.DeskExposureIngress), string(apiv1.DeskExposureService)},
+							},
+							"path": map[string]interface{}{
+								"type":    "string",
+								"pattern": "^/",
+							},
+						},
+					},
+					"manifests": map[string]interface{}{
+						"type": "array",
+						"items": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"namespace", "object"},
+							"properties": map[string]interface{}{
+								"namespace": namespaceName,
+								"object":    map[string]interface{}{"type": "object"},
+							},
+						},
+					},
+					"expirationPolicy": expirationPolicy,
+					// Apiservers of this era do not support schemas for
+					// the values of maps, so owner policies are only
+					// validated by the controller.
+					"ownerExpirationPolicies": map[string]interface{}{
+						"type": "object",
+					},
+				},
+			},
+		},
+		"required": []string{"spec"},
+	}
+}
+
+// setCRDValidation adds a validation schema to the named CRD. The vendored
+// CRD types predate CRD validation, so the schema is merged into the CRD with
+// a patch. Apiservers without CRD validation ignore it, which is why the
+// controller validates and defaults workshop resources as well.
+func (c *WorkshopController) setCRDValidation(name string, schema map[string]interface{}) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"validation": map[string]interface{}{
+				"openAPIV3Schema": schema,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+func (c *WorkshopController) waitForCRDEstablished(name string) error {
+	return wait.Poll(500*time.Millisecond, 60*time.Second, func() (bool, error) {
+		crd, err := c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Get(name, metav1.GetOptions{})
 		if err != nil {
 			return false, err
 		}
@@ -47,23 +338,14 @@ func (c *WorkshopController) createDeskCRD() error {
 				}
 			case apiextensionsv1beta1.NamesAccepted:
 				if cond.Status == apiextensionsv1beta1.ConditionFalse {
-					glog.Errorf("Desk CRD name conflict: %v\n", cond.Reason)
+					glog.Errorf("Custom resource definition \"%s\" name conflict: %v", name, cond.Reason)
 				}
 			}
 		}
 		return false, err
 	})
-
-	if err != nil {
-		deleteErr := c.deleteDeskCRD()
-		if deleteErr != nil {
-			return errors.NewAggregate([]error{err, deleteErr})
-		}
-		return err
-	}
-	return nil
 }
 
-func (c *WorkshopController) deleteDeskCRD() error {
-	return c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(apiv1.DeskCRDName, nil)
+func (c *WorkshopController) deleteCRD(name string) error {
+	return c.apiExtClient.ApiextensionsV1beta1().CustomResourceDefinitions().Delete(name, nil)
 }
@@ -0,0 +1,162 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kcache "k8s.io/client-go/tools/cache"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+func (c *WorkshopController) setDeskClassesStore() {
+	c.deskClassesStore, c.deskClassesController = kcache.NewInformer(
+		&kcache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return c.workshopClient.WorkshopV1().DeskClasses().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return c.workshopClient.WorkshopV1().DeskClasses().Watch(options)
+			},
+		},
+		&apiv1.DeskClass{},
+		resyncPeriod,
+		kcache.ResourceEventHandlerFuncs{
+			AddFunc: c.handleDeskClassChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.handleDeskClassChange(newObj)
+			},
+			DeleteFunc: c.handleDeskClassChange,
+		},
+	)
+}
+
+// handleDeskClassChange enqueues every desk of the changed class, and every
+// desk without a class, which is waiting for a default class.
+func (c *WorkshopController) handleDeskClassChange(obj interface{}) {
+	c.health.observeEvent("deskclasses")
+	name, err := kcache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("Could not get key for desk class %+v: %s", obj, err)
+		return
+	}
+	for _, obj := range c.desksStore.List() {
+		if desk, ok := obj.(*apiv1.Desk); ok && (desk.Spec.DeskClassName == name || desk.Spec.DeskClassName == "") {
+			glog.V(4).Infof("Desk class \"%s\" of desk \"%s\" changed", name, desk.Name)
+			c.enqueueDeskByName(desk.Name)
+		}
+	}
+}
+
+// getDeskClass returns the named desk class from the cache.
+func (c *WorkshopController) getDeskClass(name string) (*apiv1.DeskClass, bool) {
+	obj, exists, err := c.deskClassesStore.GetByKey(name)
+	if err != nil || !exists {
+		return nil, false
+	}
+	class, ok := obj.(*apiv1.DeskClass)
+	return class, ok
+}
+
+// getDefaultDeskClass returns the desk class marked as the default desk
+// class. It fails if there is no such class or more than one.
+func (c *WorkshopController) getDefaultDeskClass() (*apiv1.DeskClass, error) {
+	var defaults []*apiv1.DeskClass
+	for _, obj := range c.deskClassesStore.List() {
+		if class, ok := obj.(*apiv1.DeskClass); ok && class.IsDefault() {
+			defaults = append(defaults, class)
+		}
+	}
+	switch len(defaults) {
+	case 0:
+		return nil, fmt.Errorf("there is no default desk class")
+	case 1:
+		return defaults[0], nil
+	}
+	var names []string
+	for _, class := range defaults {
+		names = append(names, class.Name)
+	}
+	sort.Strings(names)
+	return nil, fmt.Errorf("desk classes %s are all marked as default", strings.Join(names, ", "))
+}
+
+// resolveDeskClass returns the desk class of the desk with defaults set, or
+// an error explaining why it cannot be used.
+func (c *WorkshopController) resolveDeskClass(desk *apiv1.Desk) (*apiv1.DeskClass, error) {
+	if desk.Spec.DeskClassName == "" {
+		// The desk was not initialized with a class because there was no
+		// single default desk class.
+		_, err := c.getDefaultDeskClass()
+		return nil, fmt.Errorf("desk has no class and %s", err)
+	}
+	class, ok := c.getDeskClass(desk.Spec.DeskClassName)
+	if !ok {
+		return nil, fmt.Errorf("desk class %q does not exist", desk.Spec.DeskClassName)
+	}
+	class = class.DeepCopyObject().(*apiv1.DeskClass)
+	apiv1.SetDeskClassDefaults(class)
+	if err := apiv1.ValidateDeskClass(class); err != nil {
+		return nil, fmt.Errorf("desk class %q is invalid: %s", class.Name, err)
+	}
+	return class, nil
+}
+
+// newDefaultDeskClass returns the desk class with the layout that desks had
+// before desk classes existed: a trusted namespace running the shell, which
+// the desk can view, and a default namespace, which the desk can edit and
+// kubectl uses by default.
+func newDefaultDeskClass() *apiv1.DeskClass {
+	return &apiv1.DeskClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: apiv1.DeskDefaultClass,
+			Annotations: map[string]string{
+				apiv1.DeskClassDefaultAnnotation: "true",
+			},
+		},
+		Spec: apiv1.DeskClassSpec{
+			Description: "Shell in a trusted namespace with view access and a default namespace with edit access",
+			Namespaces: []apiv1.DeskNamespaceTemplate{
+				{Name: "trusted", ClusterRoles: []string{"view"}},
+				{Name: "default", ClusterRoles: []string{"edit"}},
+			},
+			Shell: apiv1.DeskShellTemplate{
+				Namespace:        "trusted",
+				WorkingNamespace: "default",
+				Port:             apiv1.DeskShellDefaultPort,
+			},
+			Exposure: apiv1.DeskExposure{
+				Type: apiv1.DeskExposureIngress,
+				Path: "/kubeshell",
+			},
+		},
+	}
+}
+
+// ensureDefaultDeskClass creates the default desk class if there are no desk
+// classes at all. Existing desk classes are left alone, so that cluster
+// administrators can change the default desk class or replace it.
+func (c *WorkshopController) ensureDefaultDeskClass() error {
+	classes, err := c.workshopClient.WorkshopV1().DeskClasses().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	if len(classes.Items) > 0 {
+		return nil
+	}
+	class, err := c.workshopClient.WorkshopV1().DeskClasses().Create(newDefaultDeskClass())
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	glog.V(0).Infof("Created default desk class \"%s\"", class.Name)
+	return nil
+}
@@ -1,28 +1,41 @@
 package controller
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/pkg/api/v1"
 	kcache "k8s.io/client-go/tools/cache"
 
-	"fmt"
-
 	"github.com/golang/glog"
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
 )
 
+const (
+	// Number of times a desk is retried with backoff before it is dropped
+	// from the queue and left for the next resync.
+	maxDeskRetries = 15
+
+	// Name of the kubeshell deployment, service and ingress of every desk.
+	kubeshellName = "kubeshell"
+)
+
 func (c *WorkshopController) setDesksStore() {
 	// Returns a cache.ListWatch that gets all changes to desks.
 	c.desksStore, c.desksController = kcache.NewInformer(
-		kcache.NewListWatchFromClient(
-			c.workshopClient.WorkshopV1().RESTClient(),
-			"desks",
-			v1.NamespaceAll,
-			fields.Everything()),
+		&kcache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return c.workshopClient.WorkshopV1().Desks().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return c.workshopClient.WorkshopV1().Desks().Watch(options)
+			},
+		},
 		&apiv1.Desk{},
 		resyncPeriod,
 		kcache.ResourceEventHandlerFuncs{
@@ -33,172 +46,411 @@ func (c *WorkshopController) setDesksStore() {
 	)
 }
 
-func (c *WorkshopController) waitForDesksSynced() error {
-	// Wait for controllers to have completed an initial resource listing
-	timeout := time.After(c.initialSyncTimeout)
-	ticker := time.NewTicker(500 * time.Millisecond)
-	defer ticker.Stop()
-	for {
-		select {
-		case <-timeout:
-			return fmt.Errorf("Timeout waiting for initialization")
-		case <-ticker.C:
-			if c.desksController.HasSynced() {
-				glog.V(0).Infof("Initialized desks from apiserver")
-				return nil
-			}
-			glog.V(0).Infof("Waiting for desks to be initialized from apiserver...")
-		}
-	}
-}
-
 func (c *WorkshopController) handleDeskAdd(obj interface{}) {
-	if d, ok := obj.(*apiv1.Desk); ok {
-		c.createDeskResources(d)
-	}
+	c.enqueueDesk(obj)
 }
 
 func (c *WorkshopController) handleDeskUpdate(oldObj, newObj interface{}) {
-	oldDesk, oldDeskOk := oldObj.(*apiv1.Desk)
-	newDesk, newDeskOk := newObj.(*apiv1.Desk)
-	if oldDeskOk && newDeskOk {
-		c.updateDeskResources(oldDesk, newDesk)
+	// Updates are enqueued even when the resource version is unchanged so
+	// that periodic resyncs recreate any resources that have gone missing.
+	c.enqueueDesk(newObj)
+	oldDesk, oldOk := oldObj.(*apiv1.Desk)
+	newDesk, newOk := newObj.(*apiv1.Desk)
+	if oldOk && newOk && oldDesk.IsActive() && !newDesk.IsActive() {
+		c.enqueueBlockedOwnerDesks(newDesk.Spec.Owner)
 	}
 }
 
 func (c *WorkshopController) handleDeskDelete(obj interface{}) {
-	if d, ok := obj.(*apiv1.Desk); ok {
-		c.deleteDeskResources(d)
+	c.enqueueDesk(obj)
+	if desk, ok := obj.(*apiv1.Desk); ok {
+		c.enqueueBlockedOwnerDesks(desk.Spec.Owner)
 	}
 }
 
-func (c *WorkshopController) createDeskResources(desk *apiv1.Desk) {
-	glog.V(0).Infof("Creating resources for desk \"%s\"", desk.Name)
-
-	//
-	// TODO:
-	//       Find a home for desk expiration. If this were uncommented, it
-	//       would be buggy as is because the goroutine is not cancelled if
-	//       the desk is deleted externally or if the expiration timestamp is
-	//       changed.  The correct approach is probably to create a
-	//       "DeskManager" struct for each active desk and coordinate all
-	//       create, delete, update and expire functions through it.
-	//
-	// go func() {
-	// 	<-time.After(time.Until(desk.Spec.ExpirationTimestamp.Time))
-	// 	if err := c.workshopClient.WorkshopV1().Desks().Delete(desk.Name, nil); err != nil {
-	// 		glog.Errorf("Could not delete expired desk \"%s\": %s", desk.Name, err)
-	// 		return
-	// 	}
-	// 	glog.V(0).Infof("Deleted expired desk \"%s\"", desk.Name)
-	// }()
-
-	trustedNamespaceName := fmt.Sprintf("%s-desk-trusted", desk.Name)
-	trustedNamespace, err := c.createDeskNamespace(desk, trustedNamespaceName)
+func (c *WorkshopController) enqueueDesk(obj interface{}) {
+	c.health.observeEvent("desks")
+	key, err := kcache.DeletionHandlingMetaNamespaceKeyFunc(obj)
 	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("Namespace \"%s\" for desk \"%s\" already exists", trustedNamespaceName, desk.Name)
-			trustedNamespace, err = c.kubeClient.CoreV1().Namespaces().Get(trustedNamespaceName, metav1.GetOptions{})
-		} else {
-			glog.Error(err)
-			return
-		}
+		glog.Errorf("Could not get key for desk %+v: %s", obj, err)
+		return
+	}
+	c.desksQueue.Add(key)
+}
+
+func (c *WorkshopController) enqueueDeskByName(name string) {
+	// Desks are cluster scoped, so their key is just their name.
+	c.desksQueue.Add(name)
+}
+
+func (c *WorkshopController) runDeskWorker() {
+	for c.processNextDesk() {
+	}
+}
+
+func (c *WorkshopController) processNextDesk() bool {
+	key, quit := c.desksQueue.Get()
+	if quit {
+		return false
 	}
+	defer c.desksQueue.Done(key)
 
-	defaultNamespaceName := fmt.Sprintf("%s-desk-default", desk.Name)
-	defaultNamespace, err := c.createDeskNamespace(desk, defaultNamespaceName)
+	if _, ok := key.(heartbeatKey); ok {
+		c.health.heartbeat()
+		c.desksQueue.Forget(key)
+		return true
+	}
+
+	err := c.reconcileDesk(key.(string))
+	if err == nil {
+		c.desksQueue.Forget(key)
+		return true
+	}
+
+	if c.desksQueue.NumRequeues(key) < maxDeskRetries {
+		glog.Errorf("Error reconciling desk \"%s\", retrying: %s", key, err)
+		c.desksQueue.AddRateLimited(key)
+		return true
+	}
+
+	glog.Errorf("Error reconciling desk \"%s\", giving up until next resync: %s", key, err)
+	c.desksQueue.Forget(key)
+	return true
+}
+
+// reconcileDesk is the single entry point for bringing the resources of the
+// desk identified by key in line with the desk's current state. It is safe to
+// call any number of times for the same key.
+func (c *WorkshopController) reconcileDesk(key string) error {
+	obj, exists, err := c.desksStore.GetByKey(key)
 	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("Namespace \"%s\" for desk \"%s\" already exists", defaultNamespaceName, desk.Name)
-			defaultNamespace, err = c.kubeClient.CoreV1().Namespaces().Get(defaultNamespaceName, metav1.GetOptions{})
-		} else {
-			glog.Error(err)
-			return
+		return err
+	}
+	if !exists {
+		// The desk finalizer makes sure that its resources were deleted
+		// before the desk went away.
+		c.expirer.Cancel(key)
+		c.idler.Cancel(key)
+		return nil
+	}
+	desk, ok := obj.(*apiv1.Desk)
+	if !ok {
+		return fmt.Errorf("unexpected object type %T for desk \"%s\"", obj, key)
+	}
+
+	if desk.DeletionTimestamp != nil {
+		c.expirer.Cancel(key)
+		c.idler.Cancel(key)
+		return c.teardownDesk(desk)
+	}
+	if desk, err = c.initializeDesk(desk); err != nil {
+		return err
+	}
+	if desk, err = c.applyExpirationPolicy(desk); err != nil {
+		return err
+	}
+
+	if isDeskExpired(desk, time.Now()) {
+		c.expirer.Cancel(key)
+		c.idler.Cancel(key)
+		return c.expireDesk(desk)
+	}
+	if expiration := desk.Spec.ExpirationTimestamp; !expiration.IsZero() {
+		c.expirer.Schedule(key, expiration.Time)
+	} else {
+		c.expirer.Cancel(key)
+	}
+	lastActivity := c.observeDeskActivity(desk)
+	if desk, err = c.suspendIdleDesk(desk, lastActivity); err != nil {
+		return err
+	}
+
+	status := desk.DeepCopyObject().(*apiv1.Desk).Status
+	status.ObservedGeneration = desk.Generation
+	status.LastActivityTime = metav1.NewTime(lastActivity)
+	if err := apiv1.ValidateDesk(desk); err != nil {
+		// Servers without custom resource validation accept invalid
+		// desks, so refuse to build resources for them here.
+		status.State = apiv1.DeskStateInvalid
+		status.Message = err.Error()
+		return c.updateDeskStatus(desk, status)
+	}
+	err = c.syncDeskResources(desk, &status)
+	setDeskState(&status, desk.Spec.Suspended)
+	if updateErr := c.updateDeskStatus(desk, status); updateErr != nil {
+		return utilerrors.NewAggregate([]error{err, updateErr})
+	}
+	return err
+}
+
+// initializeDesk sets the defaults of the desk and adds the desk finalizer,
+// so that the desk is only removed once its resources are torn down. Desks
+// without a class get the default desk class, so that changing the default
+// does not change the layout of existing desks. The expiration of the desk
+// is then held to the expiration policy of its class.
+func (c *WorkshopController) initializeDesk(desk *apiv1.Desk) (*apiv1.Desk, error) {
+	updated := desk.DeepCopyObject().(*apiv1.Desk)
+	changed := apiv1.SetDeskDefaults(updated)
+	if updated.Spec.DeskClassName == "" {
+		if class, err := c.getDefaultDeskClass(); err == nil {
+			updated.Spec.DeskClassName = class.Name
+			changed = true
 		}
 	}
+	if c.setInitialDeskExpiration(updated) {
+		changed = true
+	}
+	if !hasDeskFinalizer(updated) {
+		updated.Finalizers = append(append([]string(nil), desk.Finalizers...), apiv1.DeskFinalizer)
+		changed = true
+	}
+	if !changed {
+		return desk, nil
+	}
 
-	saName := desk.Spec.Owner
-	sa, err := c.createDeskServiceAccount(desk, saName, trustedNamespace)
+	updated, err := c.workshopClient.WorkshopV1().Desks().Update(updated)
 	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("ServiceAccount \"%s\" for desk \"%s\" already exists", saName, desk.Name)
-			sa, err = c.kubeClient.CoreV1().ServiceAccounts(trustedNamespaceName).Get(saName, metav1.GetOptions{})
-		} else {
-			glog.Error(err)
-			return
+		return nil, err
+	}
+	glog.V(1).Infof("Initialized desk \"%s\" with class \"%s\", version \"%s\", expiration %s and finalizer", desk.Name, updated.Spec.DeskClassName, updated.Spec.Version, updated.Spec.ExpirationTimestamp)
+	return updated, nil
+}
+
+// resolveDeskVersion returns the desk version of the desk, or an error
+// explaining why it cannot be used.
+func (c *WorkshopController) resolveDeskVersion(desk *apiv1.Desk) (*apiv1.DeskVersion, error) {
+	name := apiv1.DeskVersionName(desk.Spec.Version)
+	version, ok := c.getDeskVersion(name)
+	if !ok {
+		if name != desk.Spec.Version {
+			return nil, fmt.Errorf("desk version %q does not exist, version %q refers to it", name, desk.Spec.Version)
 		}
+		return nil, fmt.Errorf("desk version %q does not exist", desk.Spec.Version)
+	}
+	if err := apiv1.ValidateDeskVersion(version); err != nil {
+		return nil, fmt.Errorf("desk version %q is invalid: %s", desk.Spec.Version, err)
 	}
+	return version, nil
+}
+
+// syncDeskResources creates any missing resources of the desk, restores
+// resources that were modified and records their readiness in status. The
+// resources are rendered from the desk class of the desk.
+func (c *WorkshopController) syncDeskResources(desk *apiv1.Desk, status *apiv1.DeskStatus) error {
+	glog.V(1).Infof("Syncing resources for desk \"%s\"", desk.Name)
 
-	viewRbName := fmt.Sprintf("%s-%s", sa.Name, "view")
-	_, err = c.createDeskRoleBinding(desk, viewRbName, "view", sa, trustedNamespace)
+	// Nothing can be done until the desk class and the desk version can be
+	// resolved. Changes to either enqueue the desk again.
+	class, err := c.resolveDeskClass(desk)
 	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("RoleBinding \"%s\" for desk \"%s\" already exists", viewRbName, desk.Name)
-		} else {
-			glog.Error(err)
-		}
+		setDeskCondition(status, apiv1.DeskConditionClassResolved, apiv1.ConditionFalse, "UnknownClass", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionClassResolved, "WaitingForClass", "desk class is not resolved")
+		return nil
 	}
+	setDeskCondition(status, apiv1.DeskConditionClassResolved, apiv1.ConditionTrue, "ClassResolved",
+		fmt.Sprintf("desk class %s has %d namespaces", class.Name, len(class.Spec.Namespaces)))
 
-	editRbName := fmt.Sprintf("%s-%s", sa.Name, "edit")
-	_, err = c.createDeskRoleBinding(desk, editRbName, "edit", sa, defaultNamespace)
+	version, err := c.resolveDeskVersion(desk)
 	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("RoleBinding \"%s\" for desk \"%s\" already exists", editRbName, desk.Name)
-		} else {
-			glog.Error(err)
+		setDeskCondition(status, apiv1.DeskConditionVersionResolved, apiv1.ConditionFalse, "UnknownVersion", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionVersionResolved, "WaitingForVersion", "desk version is not resolved")
+		return nil
+	}
+	setDeskCondition(status, apiv1.DeskConditionVersionResolved, apiv1.ConditionTrue, "VersionResolved",
+		fmt.Sprintf("desk version %s uses image %s", version.Name, version.Spec.Image))
+
+	if err := c.checkOwnerLimits(desk, class); err != nil {
+		setDeskCondition(status, apiv1.DeskConditionWithinOwnerLimits, apiv1.ConditionFalse, "OwnerLimitExceeded", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionWithinOwnerLimits, "WaitingForOwnerLimits", "desk exceeds the limits of its owner")
+		return nil
+	}
+	setDeskCondition(status, apiv1.DeskConditionWithinOwnerLimits, apiv1.ConditionTrue, "WithinOwnerLimits", "desk is within the limits of its owner")
+
+	namespaces := make(map[string]*v1.Namespace)
+	var namespaceNames, terminating []string
+	for _, template := range class.Spec.Namespaces {
+		namespace, err := c.ensureDeskNamespace(desk, desk.NamespaceName(template.Name))
+		if err != nil {
+			setDeskCondition(status, apiv1.DeskConditionNamespacesReady, apiv1.ConditionFalse, "SyncFailed", err.Error())
+			setPendingDeskConditions(status, apiv1.DeskConditionNamespacesReady, "WaitingForNamespaces", "namespaces are not ready")
+			return err
+		}
+		namespaces[template.Name] = namespace
+		namespaceNames = append(namespaceNames, namespace.Name)
+		if namespace.Status.Phase == v1.NamespaceTerminating {
+			terminating = append(terminating, namespace.Name)
 		}
 	}
+	if len(terminating) > 0 {
+		message := fmt.Sprintf("namespaces %s are terminating", strings.Join(terminating, ", "))
+		setDeskCondition(status, apiv1.DeskConditionNamespacesReady, apiv1.ConditionFalse, "NamespaceTerminating", message)
+		setPendingDeskConditions(status, apiv1.DeskConditionNamespacesReady, "WaitingForNamespaces", "namespaces are not ready")
+		return nil
+	}
+	setDeskCondition(status, apiv1.DeskConditionNamespacesReady, apiv1.ConditionTrue, "NamespacesActive",
+		fmt.Sprintf("namespaces %s are active", strings.Join(namespaceNames, ", ")))
 
-	kubeshellName := "kubeshell"
-	_, err = c.createDeskKubeshellDeployment(desk, kubeshellName, trustedNamespace, defaultNamespace)
-	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("Deployment \"%s\" for desk \"%s\" already exists", kubeshellName, desk.Name)
-		} else {
-			glog.Error(err)
+	// The limit ranges must exist before any pods are created in the
+	// namespaces, since their defaults are only applied on admission.
+	limits := c.deskResourceLimits(desk)
+	if err := apiv1.ValidateDeskResourceLimits(limits); err != nil {
+		setDeskCondition(status, apiv1.DeskConditionResourceLimitsReady, apiv1.ConditionFalse, "InvalidLimits", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionResourceLimitsReady, "WaitingForResourceLimits", "resource limits are not ready")
+		return nil
+	}
+	var limitErrs []error
+	for _, template := range class.Spec.Namespaces {
+		if err := c.ensureDeskResourceLimits(desk, limits, namespaces[template.Name]); err != nil {
+			limitErrs = append(limitErrs, err)
 		}
 	}
+	if len(limitErrs) > 0 {
+		err := utilerrors.NewAggregate(limitErrs)
+		setDeskCondition(status, apiv1.DeskConditionResourceLimitsReady, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionResourceLimitsReady, "WaitingForResourceLimits", "resource limits are not ready")
+		return err
+	}
+	var limitObjects []string
+	if limits.HasQuota() {
+		limitObjects = append(limitObjects, "resourcequota "+deskResourceQuotaName)
+	}
+	if limits.HasLimitRange() {
+		limitObjects = append(limitObjects, "limitrange "+deskLimitRangeName)
+	}
+	if len(limitObjects) == 0 {
+		setDeskCondition(status, apiv1.DeskConditionResourceLimitsReady, apiv1.ConditionTrue, "Unlimited", "namespaces have no resource limits")
+	} else {
+		setDeskCondition(status, apiv1.DeskConditionResourceLimitsReady, apiv1.ConditionTrue, "ResourceLimitsCreated",
+			fmt.Sprintf("namespaces are limited by %s", strings.Join(limitObjects, " and ")))
+	}
+
+	// Isolate the namespaces before the shell is started in them.
+	if err := c.ensureDeskNetworkIsolation(desk, class, kubeshellName, namespaces); err != nil {
+		setDeskCondition(status, apiv1.DeskConditionNetworkIsolated, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionNetworkIsolated, "WaitingForNetworkIsolation", "network policies are not ready")
+		return err
+	}
+	if desk.Spec.DisableNetworkIsolation {
+		setDeskCondition(status, apiv1.DeskConditionNetworkIsolated, apiv1.ConditionTrue, "IsolationDisabled", "desk opted out of network isolation")
+	} else {
+		setDeskCondition(status, apiv1.DeskConditionNetworkIsolated, apiv1.ConditionTrue, "NetworkPoliciesCreated",
+			fmt.Sprintf("pods only accept traffic from the desk, and kubeshell from namespaces matching %q", metav1.FormatLabelSelector(c.ingressNamespaceSelector)))
+	}
 
-	_, err = c.createDeskKubeshellService(desk, kubeshellName, trustedNamespace)
+	shellNamespace := namespaces[class.Spec.Shell.Namespace]
+	sa, err := c.ensureDeskServiceAccount(desk, apiv1.DeskServiceAccountName(desk.Spec.Owner), shellNamespace)
 	if err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			glog.V(2).Infof("Service \"%s\" for desk \"%s\" already exists", kubeshellName, desk.Name)
-		} else {
-			glog.Error(err)
-		}
+		setDeskCondition(status, apiv1.DeskConditionRBACReady, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		setPendingDeskConditions(status, apiv1.DeskConditionRBACReady, "WaitingForRBAC", "serviceaccount is not ready")
+		return err
 	}
 
-	if c.domain != "" {
-		_, err = c.createDeskKubeshellIngress(desk, kubeshellName, trustedNamespace, c.domain)
-		if err != nil {
-			if apierrors.IsAlreadyExists(err) {
-				glog.V(2).Infof("Ingress \"%s\" for desk \"%s\" already exists", kubeshellName, desk.Name)
-			} else {
-				glog.Error(err)
+	// The remaining resources are independent of each other, so keep going
+	// when one of them fails and report all of the failures together.
+	var errs []error
+
+	var rbacErrs []error
+	var bindings []string
+	users := c.deskUserSubjects(desk)
+	for _, template := range class.Spec.Namespaces {
+		namespace := namespaces[template.Name]
+		for _, role := range template.ClusterRoles {
+			if _, err := c.ensureDeskRoleBinding(desk, fmt.Sprintf("%s-%s", sa.Name, role), role, sa, users, namespace); err != nil {
+				rbacErrs = append(rbacErrs, err)
 			}
+			bindings = append(bindings, fmt.Sprintf("%s in %s", role, namespace.Name))
 		}
 	}
-}
+	if len(rbacErrs) > 0 {
+		setDeskCondition(status, apiv1.DeskConditionRBACReady, apiv1.ConditionFalse, "SyncFailed", utilerrors.NewAggregate(rbacErrs).Error())
+		errs = append(errs, rbacErrs...)
+	} else if len(bindings) == 0 {
+		setDeskCondition(status, apiv1.DeskConditionRBACReady, apiv1.ConditionTrue, "ServiceAccountCreated",
+			fmt.Sprintf("serviceaccount %s/%s is not bound to any roles", sa.Namespace, sa.Name))
+	} else {
+		subjects := fmt.Sprintf("serviceaccount %s/%s is", sa.Namespace, sa.Name)
+		if len(users) > 0 {
+			subjects = fmt.Sprintf("serviceaccount %s/%s and %d users and groups are", sa.Namespace, sa.Name, len(users))
+		}
+		setDeskCondition(status, apiv1.DeskConditionRBACReady, apiv1.ConditionTrue, "RoleBindingsCreated",
+			fmt.Sprintf("%s bound to %s", subjects, strings.Join(bindings, ", ")))
+	}
 
-func (c *WorkshopController) updateDeskResources(old, new *apiv1.Desk) {
-	glog.V(0).Infof("Updating resources for desk \"%s\"", new.Name)
-	if old.ResourceVersion == new.ResourceVersion {
-		glog.V(0).Infof("No changes changes for desk \"%s\"", new.Name)
-		return
+	workingNamespace := namespaces[class.Spec.Shell.WorkingNamespace]
+	if c.kubeconfigServer == "" {
+		status.KubeconfigSecret = nil
+		setDeskCondition(status, apiv1.DeskConditionKubeconfigReady, apiv1.ConditionTrue, "KubeconfigDisabled", "no apiserver is configured for the kubeconfigs of desks")
+	} else if secret, err := c.ensureDeskKubeconfig(desk, sa, workingNamespace); err != nil {
+		setDeskCondition(status, apiv1.DeskConditionKubeconfigReady, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		errs = append(errs, err)
+	} else if secret == nil {
+		setDeskCondition(status, apiv1.DeskConditionKubeconfigReady, apiv1.ConditionFalse, "WaitingForToken",
+			fmt.Sprintf("token of serviceaccount %s/%s is not issued yet", sa.Namespace, sa.Name))
+	} else if err := c.ensureDeskKubeconfigAccess(desk, secret); err != nil {
+		setDeskCondition(status, apiv1.DeskConditionKubeconfigReady, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		errs = append(errs, err)
+	} else {
+		status.KubeconfigSecret = &apiv1.DeskSecretReference{Namespace: secret.Namespace, Name: secret.Name}
+		setDeskCondition(status, apiv1.DeskConditionKubeconfigReady, apiv1.ConditionTrue, "KubeconfigCreated",
+			fmt.Sprintf("kubeconfig is published in secret %s/%s", secret.Namespace, secret.Name))
 	}
-	glog.V(0).Infof("Applying changes for desk \"%s\"", new.Name)
-	c.createDeskResources(new)
-}
 
-func (c *WorkshopController) deleteDeskResources(desk *apiv1.Desk) {
-	glog.V(0).Infof("Deleting resources for desk \"%s\"", desk.Name)
+	deployment, err := c.ensureDeskKubeshellDeployment(desk, class, version, kubeshellName, sa, shellNamespace, workingNamespace)
+	if err != nil {
+		setDeskCondition(status, apiv1.DeskConditionShellDeploymentAvailable, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		errs = append(errs, err)
+	} else if desk.Spec.Suspended {
+		setDeskCondition(status, apiv1.DeskConditionShellDeploymentAvailable, apiv1.ConditionFalse, "Suspended",
+			fmt.Sprintf("deployment %s is scaled to zero while the desk is suspended", deployment.Name))
+	} else if deployment.Status.AvailableReplicas < 1 {
+		setDeskCondition(status, apiv1.DeskConditionShellDeploymentAvailable, apiv1.ConditionFalse, "DeploymentUnavailable",
+			fmt.Sprintf("deployment %s has no available replicas", deployment.Name))
+	} else {
+		setDeskCondition(status, apiv1.DeskConditionShellDeploymentAvailable, apiv1.ConditionTrue, "DeploymentAvailable",
+			fmt.Sprintf("deployment %s has %d available replicas", deployment.Name, deployment.Status.AvailableReplicas))
+	}
 
-	trustedNamespaceName := fmt.Sprintf("%s-desk-trusted", desk.Name)
-	if err := c.deleteDeskNamespace(desk, trustedNamespaceName); err != nil {
-		glog.Errorf("Error deleting namespace \"%s\" for desk \"%s\": %s", trustedNamespaceName, desk.Name, err)
+	if c.suspendWorkloads {
+		if err := c.syncDeskWorkloads(desk, workingNamespace, kubeshellName); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	useIngress := c.domain != "" && class.Spec.Exposure.Type == apiv1.DeskExposureIngress
+	var ingressErrs []error
+	if _, err := c.ensureDeskKubeshellService(desk, class, kubeshellName, shellNamespace); err != nil {
+		ingressErrs = append(ingressErrs, err)
+	}
+	if useIngress {
+		if _, err := c.ensureDeskKubeshellIngress(desk, class, kubeshellName, shellNamespace, c.domain); err != nil {
+			ingressErrs = append(ingressErrs, err)
+		}
+	} else {
+		// The desk class may have stopped exposing the shell by ingress.
+		del := c.kubeClient.ExtensionsV1beta1().Ingresses(shellNamespace.Name).Delete
+		if err := c.deleteDeskObject(desk, "ingress", c.ingressesInformer, shellNamespace.Name, kubeshellName, del, nil); err != nil {
+			ingressErrs = append(ingressErrs, err)
+		}
+	}
+	if len(ingressErrs) > 0 {
+		setDeskCondition(status, apiv1.DeskConditionIngressReady, apiv1.ConditionFalse, "SyncFailed", utilerrors.NewAggregate(ingressErrs).Error())
+		errs = append(errs, ingressErrs...)
+	} else if useIngress {
+		status.URL = fmt.Sprintf("https://%s.%s%s", desk.Name, c.domain, class.Spec.Exposure.Path)
+		setDeskCondition(status, apiv1.DeskConditionIngressReady, apiv1.ConditionTrue, "IngressCreated",
+			fmt.Sprintf("kubeshell is exposed at %s", status.URL))
+	} else {
+		status.URL = ""
+		setDeskCondition(status, apiv1.DeskConditionIngressReady, apiv1.ConditionTrue, "ServiceCreated",
+			fmt.Sprintf("kubeshell is exposed by service %s/%s", shellNamespace.Name, kubeshellName))
 	}
 
-	if err := c.deleteDeskNamespace(desk, fmt.Sprintf("%s-desk-default", desk.Name)); err != nil {
-		glog.Errorf("Error deleting namespace \"%s\" for desk \"%s\": %s", trustedNamespaceName, desk.Name, err)
+	if created, err := c.ensureDeskManifests(desk, class, namespaces); err != nil {
+		setDeskCondition(status, apiv1.DeskConditionManifestsCreated, apiv1.ConditionFalse, "SyncFailed", err.Error())
+		errs = append(errs, err)
+	} else {
+		setDeskCondition(status, apiv1.DeskConditionManifestsCreated, apiv1.ConditionTrue, "ManifestsCreated",
+			fmt.Sprintf("%d manifests of desk class %s exist", created, class.Name))
 	}
+	return utilerrors.NewAggregate(errs)
 }
@@ -0,0 +1,1240 @@
+package controller
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/pkg/api/v1"
+	appsv1beta1 "k8s.io/client-go/pkg/apis/apps/v1beta1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+	kubetesting "k8s.io/client-go/testing"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestReconcileDesk(t *testing.T) {
+	desk := newTestDesk("alice", "alice")
+
+	expiredDesk := newTestDesk("bob", "bob")
+	expiredDesk.Spec.ExpirationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+	expiredDesk.Status.AcceptedExpirationTimestamp = expiredDesk.Spec.ExpirationTimestamp
+
+	deskWithoutFinalizer := newTestDesk("alice", "alice")
+	deskWithoutFinalizer.Finalizers = nil
+
+	deletingDesk := newDeletingDesk("alice", "alice")
+	var terminatingNamespaces []runtime.Object
+	for _, obj := range desiredDeskObjects(deletingDesk, testDomain)[:2] {
+		namespace := obj.(*v1.Namespace)
+		namespace.Status.Phase = v1.NamespaceTerminating
+		terminatingNamespaces = append(terminatingNamespaces, namespace)
+	}
+
+	undefaultedDesk := newTestDesk("alice", "alice")
+	undefaultedDesk.Spec.Version = ""
+	undefaultedDesk.Spec.ExpirationTimestamp = metav1.Time{}
+	undefaultedDesk.Status.AcceptedExpirationTimestamp = metav1.Time{}
+	undefaultedDesk.Spec.DeskClassName = ""
+
+	unknownClassDesk := newTestDesk("alice", "alice")
+	unknownClassDesk.Spec.DeskClassName = "missing"
+
+	courseDesk := newTestDesk("alice", "alice")
+	courseDesk.Spec.DeskClassName = "course"
+	courseClass := &apiv1.DeskClass{
+		ObjectMeta: metav1.ObjectMeta{Name: "course"},
+		Spec: apiv1.DeskClassSpec{
+			Namespaces: []apiv1.DeskNamespaceTemplate{{Name: "lab", ClusterRoles: []string{"admin"}}},
+			Shell:      apiv1.DeskShellTemplate{Port: 8080},
+			Exposure:   apiv1.DeskExposure{Type: apiv1.DeskExposureService},
+			Manifests: []apiv1.DeskManifest{{
+				Namespace: "lab",
+				Object:    runtime.RawExtension{Raw: []byte(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"welcome"},"data":{"motd":"hello"}}`)},
+			}},
+		},
+	}
+
+	invalidDesk := newTestDesk("alice", "")
+
+	unknownVersionDesk := newTestDesk("alice", "alice")
+	unknownVersionDesk.Spec.Version = "v0.1.0"
+
+	upgradedDesk := newTestDesk("alice", "alice")
+	upgradedDesk.Spec.Version = "v1.8.0"
+	upgradedVersion := newTestDeskVersion("v1.8.0", "joelanford/kubeshell:v1.8.0")
+	upgradedObjects := append(desiredDeskObjects(upgradedDesk, testDomain), upgradedVersion)
+
+	taggedDesk := newTestDesk("alice", "alice")
+	taggedDesk.Spec.Version = "V1_8"
+	taggedVersion := newTestDeskVersion("v1-8", "joelanford/kubeshell:V1_8")
+	taggedObjects := append(desiredDeskObjects(taggedDesk, testDomain), taggedVersion)
+
+	emailOwnedDesk := newTestDesk("alice", "alice@example.com")
+
+	driftedObjects := func() []runtime.Object {
+		objects := desiredDeskObjects(desk, testDomain)
+		objects = withoutObject(objects, &v1.Service{}, "kubeshell")
+		for _, obj := range objects {
+			switch o := obj.(type) {
+			case *extensionsv1beta1.Deployment:
+				o.Spec.Template.Spec.Containers[0].Image = "busybox"
+			case *rbacv1beta1.RoleBinding:
+				if o.Name == "alice-edit" {
+					o.RoleRef.Name = "admin"
+				}
+			}
+		}
+		return objects
+	}
+
+	tests := []struct {
+		name      string
+		domain    string
+		desks     []*apiv1.Desk
+		objects   []runtime.Object
+		key       string
+		wantErr   bool
+		want      map[string]int
+		wantState apiv1.DeskState
+		wantEvent string
+		check     func(t *testing.T, f *fixture)
+	}{
+		{
+			name:   "new desk creates all resources",
+			domain: testDomain,
+			desks:  []*apiv1.Desk{desk},
+			key:    "alice",
+			want: map[string]int{
+				"create namespaces":      2,
+				"create networkpolicies": 3,
+				"create serviceaccounts": 1,
+				"create rolebindings":    2,
+				"create deployments":     1,
+				"create services":        1,
+				"create ingresses":       1,
+				"update desks":           1,
+			},
+			wantState: apiv1.DeskStateInitializing,
+			wantEvent: "Normal Initializing",
+		},
+		{
+			name:  "new desk without domain has no ingress",
+			desks: []*apiv1.Desk{desk},
+			key:   "alice",
+			want: map[string]int{
+				"create namespaces":      2,
+				"create networkpolicies": 3,
+				"create serviceaccounts": 1,
+				"create rolebindings":    2,
+				"create deployments":     1,
+				"create services":        1,
+				"update desks":           1,
+			},
+			wantState: apiv1.DeskStateInitializing,
+		},
+		{
+			name:    "desk owned by username that is not a DNS label",
+			desks:   []*apiv1.Desk{emailOwnedDesk},
+			objects: desiredDeskObjects(emailOwnedDesk, ""),
+			key:     "alice",
+			want:    map[string]int{"update desks": 1},
+			check: func(t *testing.T, f *fixture) {
+				const name = "alice-example-com-ff8d9819"
+				if _, err := f.kubeClient.CoreV1().ServiceAccounts("alice-desk-trusted").Get(name, metav1.GetOptions{}); err != nil {
+					t.Errorf("Expected serviceaccount %q: %s", name, err)
+				}
+				deployment := f.getDeployment("alice-desk-trusted", "kubeshell")
+				if sa := deployment.Spec.Template.Spec.ServiceAccountName; sa != name {
+					t.Errorf("Expected kubeshell to run as serviceaccount %q, got %q", name, sa)
+				}
+			},
+		},
+		{
+			name:      "desk with all resources available is ready",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{desk},
+			objects:   desiredDeskObjects(desk, testDomain),
+			key:       "alice",
+			want:      map[string]int{"update desks": 1},
+			wantState: apiv1.DeskStateReady,
+			check: func(t *testing.T, f *fixture) {
+				status := f.getDesk("alice").Status
+				if status.ObservedGeneration != desk.Generation {
+					t.Errorf("Expected observed generation %d, got %d", desk.Generation, status.ObservedGeneration)
+				}
+				for _, conditionType := range deskConditionTypes {
+					if c := status.Condition(conditionType); c == nil || c.Status != apiv1.ConditionTrue {
+						t.Errorf("Expected condition %s to be true, got %+v", conditionType, c)
+					}
+				}
+			},
+		},
+		{
+			name:    "drifted resources are repaired",
+			domain:  testDomain,
+			desks:   []*apiv1.Desk{desk},
+			objects: driftedObjects(),
+			key:     "alice",
+			want: map[string]int{
+				"update deployments":  1,
+				"delete rolebindings": 1,
+				"create rolebindings": 1,
+				"create services":     1,
+				"update desks":        1,
+			},
+			wantState: apiv1.DeskStateReady,
+			check: func(t *testing.T, f *fixture) {
+				deployment := f.getDeployment("alice-desk-trusted", "kubeshell")
+				if image := deployment.Spec.Template.Spec.Containers[0].Image; image != defaultDeskVersionImage {
+					t.Errorf("Expected kubeshell image to be restored, got %q", image)
+				}
+				roleBinding := f.getRoleBinding("alice-desk-default", "alice-edit")
+				if roleBinding.RoleRef.Name != "edit" {
+					t.Errorf("Expected role \"edit\" to be restored, got %q", roleBinding.RoleRef.Name)
+				}
+			},
+		},
+		{
+			name:    "desk without finalizer gets one",
+			domain:  testDomain,
+			desks:   []*apiv1.Desk{deskWithoutFinalizer},
+			objects: desiredDeskObjects(deskWithoutFinalizer, testDomain),
+			key:     "alice",
+			want:    map[string]int{"update desks": 2},
+			check: func(t *testing.T, f *fixture) {
+				if !hasDeskFinalizer(f.getDesk("alice")) {
+					t.Errorf("Expected desk to have finalizer %s", apiv1.DeskFinalizer)
+				}
+			},
+		},
+		{
+			name:    "desk without version, expiration and class is defaulted",
+			domain:  testDomain,
+			desks:   []*apiv1.Desk{undefaultedDesk},
+			objects: desiredDeskObjects(undefaultedDesk, testDomain),
+			key:     "alice",
+			want:    map[string]int{"update desks": 2},
+			check: func(t *testing.T, f *fixture) {
+				desk := f.getDesk("alice")
+				if desk.Spec.Version != apiv1.DeskDefaultVersion {
+					t.Errorf("Expected version %q, got %q", apiv1.DeskDefaultVersion, desk.Spec.Version)
+				}
+				if want := desk.CreationTimestamp.Add(apiv1.DeskMaxLifespan); !desk.Spec.ExpirationTimestamp.Time.Equal(want) {
+					t.Errorf("Expected expiration %s, got %s", want, desk.Spec.ExpirationTimestamp)
+				}
+				if desk.Spec.DeskClassName != apiv1.DeskDefaultClass {
+					t.Errorf("Expected class %q, got %q", apiv1.DeskDefaultClass, desk.Spec.DeskClassName)
+				}
+			},
+		},
+		{
+			name:      "invalid desk gets no resources",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{invalidDesk},
+			key:       "alice",
+			want:      map[string]int{"update desks": 1},
+			wantState: apiv1.DeskStateInvalid,
+			wantEvent: "Warning Invalid",
+		},
+		{
+			name:      "desk with unknown class fails without resources",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{unknownClassDesk},
+			key:       "alice",
+			want:      map[string]int{"update desks": 1},
+			wantState: apiv1.DeskStateFailed,
+		},
+		{
+			name:    "desk is rendered from its class",
+			domain:  testDomain,
+			desks:   []*apiv1.Desk{courseDesk},
+			objects: []runtime.Object{courseClass},
+			key:     "alice",
+			want: map[string]int{
+				"create namespaces":      1,
+				"create networkpolicies": 2,
+				"create serviceaccounts": 1,
+				"create rolebindings":    1,
+				"create deployments":     1,
+				"create services":        1,
+				"create configmaps":      1,
+				"update desks":           1,
+			},
+			wantState: apiv1.DeskStateInitializing,
+			check: func(t *testing.T, f *fixture) {
+				container := f.getDeployment("alice-desk-lab", "kubeshell").Spec.Template.Spec.Containers[0]
+				if port := container.Ports[0].ContainerPort; port != 8080 {
+					t.Errorf("Expected shell port 8080, got %d", port)
+				}
+				for _, env := range container.Env {
+					if env.Name == "KS_NAMESPACE" && env.Value != "alice-desk-lab" {
+						t.Errorf("Expected working namespace \"alice-desk-lab\", got %q", env.Value)
+					}
+				}
+				if roleBinding := f.getRoleBinding("alice-desk-lab", "alice-admin"); roleBinding.RoleRef.Name != "admin" {
+					t.Errorf("Expected role \"admin\", got %q", roleBinding.RoleRef.Name)
+				}
+				configMap, err := f.kubeClient.CoreV1().ConfigMaps("alice-desk-lab").Get("welcome", metav1.GetOptions{})
+				if err != nil {
+					t.Fatalf("Expected manifest configmap to be created: %s", err)
+				}
+				if configMap.Data["motd"] != "hello" || len(configMap.OwnerReferences) != 1 {
+					t.Errorf("Expected configmap with data and desk owner, got %+v", configMap)
+				}
+			},
+		},
+		{
+			name:      "desk with unknown version fails without resources",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{unknownVersionDesk},
+			key:       "alice",
+			want:      map[string]int{"update desks": 1},
+			wantState: apiv1.DeskStateFailed,
+			check: func(t *testing.T, f *fixture) {
+				condition := f.getDesk("alice").Status.Condition(apiv1.DeskConditionVersionResolved)
+				if condition == nil || condition.Status != apiv1.ConditionFalse || condition.Reason != "UnknownVersion" {
+					t.Errorf("Expected condition %s to be false with reason UnknownVersion, got %+v", apiv1.DeskConditionVersionResolved, condition)
+				}
+			},
+		},
+		{
+			name:      "image tag style version resolves to its desk version",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{taggedDesk},
+			objects:   taggedObjects,
+			key:       "alice",
+			want:      map[string]int{"update deployments": 1, "update desks": 1},
+			wantState: apiv1.DeskStateReady,
+			check: func(t *testing.T, f *fixture) {
+				container := f.getDeployment("alice-desk-trusted", "kubeshell").Spec.Template.Spec.Containers[0]
+				if container.Image != taggedVersion.Spec.Image {
+					t.Errorf("Expected image %q, got %q", taggedVersion.Spec.Image, container.Image)
+				}
+			},
+		},
+		{
+			name:      "desk version is applied to the shell",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{upgradedDesk},
+			objects:   upgradedObjects,
+			key:       "alice",
+			want:      map[string]int{"update deployments": 1, "update desks": 1},
+			wantState: apiv1.DeskStateReady,
+			check: func(t *testing.T, f *fixture) {
+				container := f.getDeployment("alice-desk-trusted", "kubeshell").Spec.Template.Spec.Containers[0]
+				if container.Image != upgradedVersion.Spec.Image {
+					t.Errorf("Expected image %q, got %q", upgradedVersion.Spec.Image, container.Image)
+				}
+				if !reflect.DeepEqual(container.Resources, upgradedVersion.Spec.Resources) {
+					t.Errorf("Expected resources %+v, got %+v", upgradedVersion.Spec.Resources, container.Resources)
+				}
+				env := make(map[string]string)
+				for _, e := range container.Env {
+					env[e.Name] = e.Value
+				}
+				if env["KS_KUBECTL_VERSION"] != "v1.8.0" || env["EDITOR"] != "vim" {
+					t.Errorf("Expected kubectl version and desk version env, got %v", env)
+				}
+			},
+		},
+		{
+			name:   "deleted desk is a no-op",
+			domain: testDomain,
+			key:    "alice",
+			want:   map[string]int{},
+		},
+		{
+			name:    "deleting desk deletes the ingresses first",
+			domain:  testDomain,
+			desks:   []*apiv1.Desk{deletingDesk},
+			objects: desiredDeskObjects(deletingDesk, testDomain),
+			key:     "alice",
+			want: map[string]int{
+				"delete ingresses": 1,
+				"update desks":     1,
+			},
+			wantState: apiv1.DeskStateTerminating,
+			check: func(t *testing.T, f *fixture) {
+				desk := f.getDesk("alice")
+				if !hasDeskFinalizer(desk) {
+					t.Errorf("Expected finalizer to be kept until namespaces are gone")
+				}
+				if !strings.Contains(desk.Status.Message, "ingress to be deleted") {
+					t.Errorf("Expected message to wait for the ingress, got %q", desk.Status.Message)
+				}
+			},
+		},
+		{
+			name:      "deleting desk waits for terminating namespaces",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{deletingDesk},
+			objects:   terminatingNamespaces,
+			key:       "alice",
+			want:      map[string]int{"update desks": 1},
+			wantState: apiv1.DeskStateTerminating,
+			check: func(t *testing.T, f *fixture) {
+				desk := f.getDesk("alice")
+				if !hasDeskFinalizer(desk) {
+					t.Errorf("Expected finalizer to be kept until namespaces are gone")
+				}
+				if !strings.Contains(desk.Status.Message, "alice-desk-trusted") {
+					t.Errorf("Expected message to name the terminating namespaces, got %q", desk.Status.Message)
+				}
+			},
+		},
+		{
+			name:      "deleting desk without resources removes finalizer",
+			domain:    testDomain,
+			desks:     []*apiv1.Desk{deletingDesk},
+			key:       "alice",
+			want:      map[string]int{"update desks": 1},
+			wantState: apiv1.DeskStateTerminating,
+			wantEvent: "Normal TornDown",
+			check: func(t *testing.T, f *fixture) {
+				if hasDeskFinalizer(f.getDesk("alice")) {
+					t.Errorf("Expected finalizer to be removed")
+				}
+			},
+		},
+		{
+			name:   "expired desk is marked expired and deleted",
+			domain: testDomain,
+			desks:  []*apiv1.Desk{expiredDesk},
+			key:    "bob",
+			want: map[string]int{
+				"update desks": 1,
+				"delete desks": 1,
+			},
+			wantEvent: "Normal Expired",
+			check: func(t *testing.T, f *fixture) {
+				update := lastAction(f.workshopClient.Actions(), "update", "desks").(kubetesting.UpdateAction)
+				if state := update.GetObject().(*apiv1.Desk).Status.State; state != apiv1.DeskStateExpired {
+					t.Errorf("Expected desk to be marked %s before deletion, got %s", apiv1.DeskStateExpired, state)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			f := newFixture(t, test.domain, test.desks, test.objects)
+			defer f.controller.expirer.Stop()
+
+			err := f.controller.reconcileDesk(test.key)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", test.wantErr, err)
+			}
+			if got := f.writes(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Expected writes %v, got %v", test.want, got)
+			}
+			if test.wantState != "" {
+				if state := f.getDesk(test.key).Status.State; state != test.wantState {
+					t.Errorf("Expected desk state %s, got %s", test.wantState, state)
+				}
+			}
+			if events := f.events(); test.wantEvent != "" && !hasEvent(events, test.wantEvent) {
+				t.Errorf("Expected event %q, got %q", test.wantEvent, events)
+			}
+			if test.check != nil {
+				test.check(t, f)
+			}
+		})
+	}
+}
+
+// hasEvent returns whether one of the recorded events starts with the type
+// and reason in want, e.g. "Normal Ready".
+func hasEvent(events []string, want string) bool {
+	for _, event := range events {
+		if strings.HasPrefix(event, want+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTeardownDeskStages(t *testing.T) {
+	desk := newDeletingDesk("alice", "alice")
+	f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+	defer f.controller.expirer.Stop()
+
+	// Each reconciliation deletes one stage. The deleted objects are then
+	// removed from the informer caches, as the informers would once the
+	// deletions are observed.
+	var stages [][]string
+	for i := 0; i < 5 && hasDeskFinalizer(f.getDesk("alice")); i++ {
+		f.kubeClient.ClearActions()
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		var deleted []string
+		for _, action := range f.kubeClient.Actions() {
+			if action.GetVerb() != "delete" {
+				continue
+			}
+			resource := action.GetResource().Resource
+			if len(deleted) == 0 || deleted[len(deleted)-1] != resource {
+				deleted = append(deleted, resource)
+			}
+			informer := f.controller.ownedInformers()[resource]
+			del := action.(kubetesting.DeleteAction)
+			key := del.GetName()
+			if del.GetNamespace() != "" {
+				key = del.GetNamespace() + "/" + key
+			}
+			if obj, exists, _ := informer.GetIndexer().GetByKey(key); exists {
+				informer.GetIndexer().Delete(obj)
+			}
+		}
+		stages = append(stages, deleted)
+	}
+
+	want := [][]string{
+		{"ingresses"},
+		{"services", "deployments"},
+		{"rolebindings", "serviceaccounts"},
+		{"namespaces"},
+		nil,
+	}
+	if !reflect.DeepEqual(stages, want) {
+		t.Errorf("Expected deletions by stage %v, got %v", want, stages)
+	}
+	if hasDeskFinalizer(f.getDesk("alice")) {
+		t.Errorf("Expected finalizer to be removed once all stages are gone")
+	}
+}
+
+func TestReconcileDeskIsIdempotent(t *testing.T) {
+	desk := newTestDesk("alice", "alice")
+	f := newFixture(t, testDomain, []*apiv1.Desk{desk}, nil)
+	defer f.controller.expirer.Stop()
+
+	if err := f.controller.reconcileDesk("alice"); err != nil {
+		t.Fatalf("Unexpected error on first reconcile: %s", err)
+	}
+	f.kubeClient.ClearActions()
+	f.workshopClient.ClearActions()
+	if err := f.controller.desksStore.Update(f.getDesk("alice")); err != nil {
+		t.Fatalf("Could not update desk in cache: %s", err)
+	}
+
+	// The informer caches are not updated by the fake clientsets, so the
+	// second pass reads everything back from the API.
+	if err := f.controller.reconcileDesk("alice"); err != nil {
+		t.Fatalf("Unexpected error on second reconcile: %s", err)
+	}
+	if writes := f.writes(); len(writes) != 0 {
+		t.Errorf("Expected no writes on second reconcile, got %v", writes)
+	}
+}
+
+func TestReconcileDeskResourceLimits(t *testing.T) {
+	limits := &apiv1.DeskResourceLimits{
+		Quota:         v1.ResourceList{v1.ResourcePods: resource.MustParse("10")},
+		DefaultLimits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")},
+	}
+
+	t.Run("limits are created with desk overrides", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		desk.Spec.Limits = &apiv1.DeskResourceLimits{
+			Quota: v1.ResourceList{v1.ResourcePods: resource.MustParse("5")},
+		}
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+		defer f.controller.expirer.Stop()
+		f.controller.resourceLimits = limits
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"create resourcequotas": 2, "create limitranges": 2, "update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+
+		quota, err := f.kubeClient.CoreV1().ResourceQuotas("alice-desk-default").Get(deskResourceQuotaName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get resourcequota: %s", err)
+		}
+		if pods := quota.Spec.Hard[v1.ResourcePods]; pods.Value() != 5 {
+			t.Errorf("Expected quota of 5 pods from the desk, got %s", pods.String())
+		}
+		limitRange, err := f.kubeClient.CoreV1().LimitRanges("alice-desk-default").Get(deskLimitRangeName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get limitrange: %s", err)
+		}
+		if memory := limitRange.Spec.Limits[0].Default[v1.ResourceMemory]; memory.String() != "256Mi" {
+			t.Errorf("Expected default memory limit 256Mi, got %s", memory.String())
+		}
+		if condition := f.getDesk("alice").Status.Condition(apiv1.DeskConditionResourceLimitsReady); condition == nil || condition.Status != apiv1.ConditionTrue {
+			t.Errorf("Expected resource limits to be ready, got %+v", condition)
+		}
+	})
+
+	t.Run("limits are deleted when no longer configured", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		objects := desiredDeskObjects(desk, testDomain)
+		namespace := objects[1].(*v1.Namespace)
+		objects = append(objects, newDeskResourceQuota(desk, limits, namespace), newDeskLimitRange(desk, limits, namespace))
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, objects)
+		defer f.controller.expirer.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"delete resourcequotas": 1, "delete limitranges": 1, "update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+	})
+}
+
+func TestReconcileDeskUserBindings(t *testing.T) {
+	desk := newTestDesk("alice", "alice")
+	desk.Spec.Collaborators = []apiv1.DeskSubject{{Kind: apiv1.DeskSubjectGroup, Name: "instructors"}}
+	f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+	defer f.controller.expirer.Stop()
+	f.controller.bindDeskUsers = true
+
+	if err := f.controller.reconcileDesk("alice"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	want := map[string]int{"update rolebindings": 2, "update desks": 1}
+	if got := f.writes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected writes %v, got %v", want, got)
+	}
+
+	binding, err := f.kubeClient.RbacV1beta1().RoleBindings("alice-desk-default").Get("alice-edit", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Could not get rolebinding: %s", err)
+	}
+	var subjects []string
+	for _, subject := range binding.Subjects {
+		subjects = append(subjects, subject.Kind+" "+subject.Name)
+	}
+	if want := []string{"ServiceAccount alice", "User alice", "Group instructors"}; !reflect.DeepEqual(subjects, want) {
+		t.Errorf("Expected subjects %v, got %v", want, subjects)
+	}
+}
+
+func TestReconcileDeskKubeconfig(t *testing.T) {
+	newToken := func(desk *apiv1.Desk, rotation string) *v1.Secret {
+		sa := &v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "alice", Namespace: "alice-desk-trusted"}}
+		token := newDeskTokenSecret(desk, sa, rotation)
+		token.Data = map[string][]byte{v1.ServiceAccountTokenKey: []byte("token-" + rotation), v1.ServiceAccountRootCAKey: []byte("ca")}
+		return token
+	}
+
+	t.Run("token is requested", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+		defer f.controller.expirer.Stop()
+		f.controller.kubeconfigServer = "https://kubernetes.example.com"
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"create secrets": 1, "update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+		token, err := f.kubeClient.CoreV1().Secrets("alice-desk-trusted").Get(deskTokenSecretName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get token secret: %s", err)
+		}
+		if token.Type != v1.SecretTypeServiceAccountToken || token.Annotations[v1.ServiceAccountNameKey] != "alice" {
+			t.Errorf("Expected token secret of serviceaccount \"alice\", got %+v", token)
+		}
+		if condition := f.getDesk("alice").Status.Condition(apiv1.DeskConditionKubeconfigReady); condition == nil || condition.Reason != "WaitingForToken" {
+			t.Errorf("Expected desk to wait for the token, got %+v", condition)
+		}
+	})
+
+	t.Run("kubeconfig is published", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		objects := append(desiredDeskObjects(desk, testDomain), newToken(desk, deskTokenRotation(desk)))
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, objects)
+		defer f.controller.expirer.Stop()
+		f.controller.kubeconfigServer = "https://kubernetes.example.com"
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		secret, err := f.kubeClient.CoreV1().Secrets("alice-desk-trusted").Get(apiv1.DeskKubeconfigSecretName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get kubeconfig secret: %s", err)
+		}
+		kubeconfig := string(secret.Data[apiv1.DeskKubeconfigSecretKey])
+		for _, want := range []string{"server: https://kubernetes.example.com", "token: token-" + deskTokenRotation(desk), "namespace: alice-desk-default"} {
+			if !strings.Contains(kubeconfig, want) {
+				t.Errorf("Expected kubeconfig to contain %q, got:\n%s", want, kubeconfig)
+			}
+		}
+		if ref := f.getDesk("alice").Status.KubeconfigSecret; ref == nil || ref.Namespace != "alice-desk-trusted" || ref.Name != apiv1.DeskKubeconfigSecretName {
+			t.Errorf("Expected desk status to refer to the kubeconfig secret, got %+v", ref)
+		}
+
+		role, err := f.kubeClient.RbacV1beta1().Roles("alice-desk-trusted").Get(apiv1.DeskKubeconfigSecretName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get kubeconfig role: %s", err)
+		}
+		wantRules := []rbacv1beta1.PolicyRule{{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{apiv1.DeskKubeconfigSecretName},
+			Verbs:         []string{"get"},
+		}}
+		if !reflect.DeepEqual(role.Rules, wantRules) {
+			t.Errorf("Expected kubeconfig role to allow only getting the kubeconfig secret, got %+v", role.Rules)
+		}
+		binding := f.getRoleBinding("alice-desk-trusted", apiv1.DeskKubeconfigSecretName)
+		wantSubjects := []rbacv1beta1.Subject{{Kind: rbacv1beta1.UserKind, APIGroup: rbacv1beta1.SchemeGroupVersion.Group, Name: "alice"}}
+		if binding.RoleRef.Kind != "Role" || binding.RoleRef.Name != role.Name || !reflect.DeepEqual(binding.Subjects, wantSubjects) {
+			t.Errorf("Expected owner to be bound to the kubeconfig role, got %+v", binding)
+		}
+
+		// The access is only restored if it was modified.
+		f.kubeClient.ClearActions()
+		for _, obj := range []runtime.Object{secret, role, binding} {
+			if err := f.informerFor(obj).GetIndexer().Add(obj); err != nil {
+				t.Fatalf("Could not add %T to the informer: %s", obj, err)
+			}
+		}
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		for verb := range f.writes() {
+			if strings.HasSuffix(verb, " roles") || strings.HasSuffix(verb, " rolebindings") {
+				t.Errorf("Expected kubeconfig access to be left alone, got %v", f.writes())
+			}
+		}
+	})
+
+	t.Run("token is rotated when the desk is renewed", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		previous := desk.DeepCopyObject().(*apiv1.Desk)
+		previous.Status.AcceptedExpirationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+		objects := append(desiredDeskObjects(desk, testDomain), newToken(desk, deskTokenRotation(previous)))
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, objects)
+		defer f.controller.expirer.Stop()
+		f.controller.kubeconfigServer = "https://kubernetes.example.com"
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"delete secrets": 1, "create secrets": 1, "update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+		token, err := f.kubeClient.CoreV1().Secrets("alice-desk-trusted").Get(deskTokenSecretName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get token secret: %s", err)
+		}
+		if rotation := token.Annotations[apiv1.DeskTokenRotationAnnotation]; rotation != deskTokenRotation(desk) {
+			t.Errorf("Expected token of rotation %q, got %q", deskTokenRotation(desk), rotation)
+		}
+	})
+}
+
+func TestReconcileDeskOwnerLimits(t *testing.T) {
+	older := newTestDesk("alice-1", "alice")
+	older.CreationTimestamp = metav1.NewTime(older.CreationTimestamp.Add(-time.Minute))
+	newer := newTestDesk("alice-2", "alice")
+
+	t.Run("newer desks beyond the limits are held back", func(t *testing.T) {
+		f := newFixture(t, testDomain, []*apiv1.Desk{older, newer}, nil)
+		defer f.controller.expirer.Stop()
+		f.controller.ownerLimits = &apiv1.DeskOwnerLimits{MaxDesks: 1}
+
+		if err := f.controller.reconcileDesk("alice-2"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+		condition := f.getDesk("alice-2").Status.Condition(apiv1.DeskConditionWithinOwnerLimits)
+		if condition == nil || condition.Status != apiv1.ConditionFalse || condition.Reason != "OwnerLimitExceeded" {
+			t.Errorf("Expected desk to exceed the limits of its owner, got %+v", condition)
+		}
+	})
+
+	t.Run("older desks within the limits are provisioned", func(t *testing.T) {
+		f := newFixture(t, testDomain, []*apiv1.Desk{older, newer}, nil)
+		defer f.controller.expirer.Stop()
+		f.controller.ownerLimits = &apiv1.DeskOwnerLimits{MaxDesks: 1}
+
+		if err := f.controller.reconcileDesk("alice-1"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if _, err := f.kubeClient.CoreV1().Namespaces().Get("alice-1-desk-default", metav1.GetOptions{}); err != nil {
+			t.Errorf("Expected namespace of desk to be created: %s", err)
+		}
+		condition := f.getDesk("alice-1").Status.Condition(apiv1.DeskConditionWithinOwnerLimits)
+		if condition == nil || condition.Status != apiv1.ConditionTrue {
+			t.Errorf("Expected desk to be within the limits of its owner, got %+v", condition)
+		}
+	})
+
+	t.Run("resources of earlier desks count against the owner", func(t *testing.T) {
+		f := newFixture(t, testDomain, []*apiv1.Desk{older, newer}, nil)
+		defer f.controller.expirer.Stop()
+		f.controller.resourceLimits = &apiv1.DeskResourceLimits{
+			Quota: v1.ResourceList{v1.ResourcePods: resource.MustParse("10")},
+		}
+		f.controller.ownerLimits = &apiv1.DeskOwnerLimits{
+			MaxResources: v1.ResourceList{v1.ResourcePods: resource.MustParse("30")},
+		}
+
+		if err := f.controller.reconcileDesk("alice-2"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		condition := f.getDesk("alice-2").Status.Condition(apiv1.DeskConditionWithinOwnerLimits)
+		if condition == nil || condition.Status != apiv1.ConditionFalse || !strings.Contains(condition.Message, "pods (40 of at most 30)") {
+			t.Errorf("Expected desk to exceed the pods of its owner, got %+v", condition)
+		}
+	})
+}
+
+func TestReconcileDeskNetworkIsolation(t *testing.T) {
+	t.Run("namespaces only admit traffic from the desk", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, nil)
+		defer f.controller.expirer.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		policy, err := f.kubeClient.NetworkingV1().NetworkPolicies("alice-desk-default").Get(deskIsolationPolicyName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get networkpolicy: %s", err)
+		}
+		from := policy.Spec.Ingress[0].From[0].NamespaceSelector
+		if from == nil || from.MatchLabels[apiv1.DeskNamespaceLabel] != "alice" {
+			t.Errorf("Expected traffic to be admitted from the namespaces of desk \"alice\", got %+v", from)
+		}
+		namespace, err := f.kubeClient.CoreV1().Namespaces().Get("alice-desk-default", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get namespace: %s", err)
+		}
+		if namespace.Labels[apiv1.DeskNamespaceLabel] != "alice" {
+			t.Errorf("Expected namespace to be labeled with its desk, got %v", namespace.Labels)
+		}
+		shellPolicy, err := f.kubeClient.NetworkingV1().NetworkPolicies("alice-desk-trusted").Get(kubeshellIngressPolicyName, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get kubeshell networkpolicy: %s", err)
+		}
+		if port := shellPolicy.Spec.Ingress[0].Ports[0].Port.IntValue(); port != int(apiv1.DeskShellDefaultPort) {
+			t.Errorf("Expected kubeshell port %d to be admitted, got %d", apiv1.DeskShellDefaultPort, port)
+		}
+	})
+
+	t.Run("desks can opt out", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		desk.Spec.DisableNetworkIsolation = true
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+		defer f.controller.expirer.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"delete networkpolicies": 3, "update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+		if state := f.getDesk("alice").Status.State; state != apiv1.DeskStateReady {
+			t.Errorf("Expected desk state %s, got %s", apiv1.DeskStateReady, state)
+		}
+	})
+}
+
+func TestReconcileDeskSuspension(t *testing.T) {
+	t.Run("suspended desk scales its shell to zero", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		objects := desiredDeskObjects(desk, testDomain)
+		desk.Spec.Suspended = true
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, objects)
+		defer f.controller.expirer.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		want := map[string]int{"update deployments": 1, "update desks": 1}
+		if got := f.writes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected writes %v, got %v", want, got)
+		}
+		if replicas := *f.getDeployment("alice-desk-trusted", "kubeshell").Spec.Replicas; replicas != 0 {
+			t.Errorf("Expected kubeshell to be scaled to zero, got %d replicas", replicas)
+		}
+		if state := f.getDesk("alice").Status.State; state != apiv1.DeskStateSuspended {
+			t.Errorf("Expected desk state %s, got %s", apiv1.DeskStateSuspended, state)
+		}
+	})
+
+	t.Run("workloads are scaled down and back up", func(t *testing.T) {
+		desk := newTestDesk("alice", "alice")
+		desk.Spec.Suspended = true
+		webReplicas, dbReplicas := int32(3), int32(2)
+		web := &extensionsv1beta1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "alice-desk-default"},
+			Spec:       extensionsv1beta1.DeploymentSpec{Replicas: &webReplicas},
+		}
+		db := &appsv1beta1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "alice-desk-default"},
+			Spec:       appsv1beta1.StatefulSetSpec{Replicas: &dbReplicas},
+		}
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, append(desiredDeskObjects(desk, testDomain), web))
+		defer f.controller.expirer.Stop()
+		f.controller.suspendWorkloads = true
+		if _, err := f.kubeClient.AppsV1beta1().StatefulSets("alice-desk-default").Create(db); err != nil {
+			t.Fatalf("Could not create statefulset: %s", err)
+		}
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		suspendedWeb := f.getDeployment("alice-desk-default", "web")
+		if *suspendedWeb.Spec.Replicas != 0 || suspendedWeb.Annotations[apiv1.DeskSuspendedReplicasAnnotation] != "3" {
+			t.Errorf("Expected deployment to be scaled to zero with 3 recorded replicas, got %d and %v", *suspendedWeb.Spec.Replicas, suspendedWeb.Annotations)
+		}
+		suspendedDB, err := f.kubeClient.AppsV1beta1().StatefulSets("alice-desk-default").Get("db", metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("Could not get statefulset: %s", err)
+		}
+		if *suspendedDB.Spec.Replicas != 0 || suspendedDB.Annotations[apiv1.DeskSuspendedReplicasAnnotation] != "2" {
+			t.Errorf("Expected statefulset to be scaled to zero with 2 recorded replicas, got %d and %v", *suspendedDB.Spec.Replicas, suspendedDB.Annotations)
+		}
+
+		resumed := f.getDesk("alice")
+		resumed.Spec.Suspended = false
+		if err := f.controller.desksStore.Update(resumed); err != nil {
+			t.Fatalf("Could not update desk in cache: %s", err)
+		}
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resumedWeb := f.getDeployment("alice-desk-default", "web")
+		if *resumedWeb.Spec.Replicas != 3 {
+			t.Errorf("Expected deployment to be scaled back to 3 replicas, got %d", *resumedWeb.Spec.Replicas)
+		}
+		if _, ok := resumedWeb.Annotations[apiv1.DeskSuspendedReplicasAnnotation]; ok {
+			t.Errorf("Expected recorded replicas to be removed, got %v", resumedWeb.Annotations)
+		}
+	})
+}
+
+func TestReconcileDeskTimeToReadyIsObservedOnce(t *testing.T) {
+	samples := func() uint64 {
+		var m dto.Metric
+		if err := metrics.DeskTimeToReady.WithLabelValues(apiv1.DeskDefaultClass).Write(&m); err != nil {
+			t.Fatalf("Could not read time to ready: %s", err)
+		}
+		return m.GetHistogram().GetSampleCount()
+	}
+	desk := newTestDesk("alice", "alice")
+	desk.Spec.DeskClassName = apiv1.DeskDefaultClass
+	f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+	defer f.controller.expirer.Stop()
+	before := samples()
+
+	// The desk is ready, then suspended and resumed.
+	for _, suspended := range []bool{false, true, false} {
+		updated := f.getDesk("alice")
+		updated.Spec.Suspended = suspended
+		if err := f.controller.desksStore.Update(updated); err != nil {
+			t.Fatalf("Could not update desk in cache: %s", err)
+		}
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+	}
+	if state := f.getDesk("alice").Status.State; state != apiv1.DeskStateReady {
+		t.Fatalf("Expected resumed desk to be %s, got %s", apiv1.DeskStateReady, state)
+	}
+	if got := samples() - before; got != 1 {
+		t.Errorf("Expected time to ready to be observed once, got %d observations", got)
+	}
+}
+
+func TestReconcileDeskIdleTimeout(t *testing.T) {
+	newIdleDesk := func() *apiv1.Desk {
+		desk := newTestDesk("alice", "alice")
+		desk.CreationTimestamp = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+		return desk
+	}
+	newFixtureWithIdleTimeout := func(t *testing.T, desk *apiv1.Desk) *fixture {
+		f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+		f.controller.idleTimeout = time.Hour
+		return f
+	}
+
+	t.Run("idle desk is suspended", func(t *testing.T) {
+		f := newFixtureWithIdleTimeout(t, newIdleDesk())
+		defer f.controller.expirer.Stop()
+		defer f.controller.idler.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		desk := f.getDesk("alice")
+		if !desk.Spec.Suspended {
+			t.Errorf("Expected idle desk to be suspended")
+		}
+		if desk.Status.State != apiv1.DeskStateSuspended {
+			t.Errorf("Expected desk state %s, got %s", apiv1.DeskStateSuspended, desk.Status.State)
+		}
+		if events := f.events(); !hasEvent(events, "Normal IdleSuspended") {
+			t.Errorf("Expected idle suspension event, got %q", events)
+		}
+	})
+
+	t.Run("recent activity keeps desk running", func(t *testing.T) {
+		f := newFixtureWithIdleTimeout(t, newIdleDesk())
+		defer f.controller.expirer.Stop()
+		defer f.controller.idler.Stop()
+
+		heartbeat := time.Now().Add(-20 * time.Minute).Truncate(time.Second)
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "editor",
+			Namespace:   "alice-desk-default",
+			Annotations: map[string]string{apiv1.DeskLastActivityAnnotation: heartbeat.Format(time.RFC3339)},
+		}}
+		otherPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name:        "editor",
+			Namespace:   "bob-desk-default",
+			Annotations: map[string]string{apiv1.DeskLastActivityAnnotation: time.Now().Format(time.RFC3339)},
+		}}
+		for _, p := range []*v1.Pod{pod, otherPod} {
+			if err := f.controller.podsInformer.GetIndexer().Add(p); err != nil {
+				t.Fatalf("Could not add pod to cache: %s", err)
+			}
+		}
+		// Events are recorded by the cluster itself, so they are not
+		// activity.
+		event := &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: "web.1", Namespace: "alice-desk-default"},
+			InvolvedObject: v1.ObjectReference{Kind: "Deployment", Name: "web"},
+			Reason:         "ScalingReplicaSet",
+			LastTimestamp:  metav1.Now(),
+		}
+		if _, err := f.kubeClient.CoreV1().Events(event.Namespace).Create(event); err != nil {
+			t.Fatalf("Could not create event: %s", err)
+		}
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		desk := f.getDesk("alice")
+		if desk.Spec.Suspended {
+			t.Errorf("Expected active desk not to be suspended")
+		}
+		if !desk.Status.LastActivityTime.Time.Equal(heartbeat) {
+			t.Errorf("Expected last activity at %s, got %s", heartbeat, desk.Status.LastActivityTime)
+		}
+
+		f.controller.idler.mu.Lock()
+		_, scheduled := f.controller.idler.deadlines["alice"]
+		f.controller.idler.mu.Unlock()
+		if !scheduled {
+			t.Errorf("Expected idle timeout of desk \"alice\" to be scheduled")
+		}
+	})
+
+	t.Run("activity in the future is taken as now", func(t *testing.T) {
+		desk := newIdleDesk()
+		desk.Annotations = map[string]string{apiv1.DeskLastActivityAnnotation: time.Now().Add(24 * time.Hour).Format(time.RFC3339)}
+		f := newFixtureWithIdleTimeout(t, desk)
+		defer f.controller.expirer.Stop()
+		defer f.controller.idler.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		if last := f.getDesk("alice").Status.LastActivityTime.Time; last.After(time.Now()) {
+			t.Errorf("Expected last activity no later than now, got %s", last)
+		}
+	})
+
+	t.Run("resumed desk is not suspended again", func(t *testing.T) {
+		desk := newIdleDesk()
+		desk.Status.State = apiv1.DeskStateSuspended
+		desk.Status.LastActivityTime = desk.CreationTimestamp
+		f := newFixtureWithIdleTimeout(t, desk)
+		defer f.controller.expirer.Stop()
+		defer f.controller.idler.Stop()
+
+		if err := f.controller.reconcileDesk("alice"); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+		resumed := f.getDesk("alice")
+		if resumed.Spec.Suspended {
+			t.Errorf("Expected resumed desk not to be suspended")
+		}
+		if since := time.Since(resumed.Status.LastActivityTime.Time); since > time.Minute {
+			t.Errorf("Expected resume to count as activity, last activity was %s ago", since)
+		}
+	})
+}
+
+func TestReconcileDeskRenewal(t *testing.T) {
+	day := 24 * time.Hour
+	zero := int32(0)
+	course := newDefaultDeskClass()
+	course.Name = "course"
+	course.Annotations = nil
+	course.Spec.OwnerExpirationPolicies = map[string]apiv1.DeskExpirationPolicy{"alice": {MaxRenewals: &zero}}
+
+	tests := []struct {
+		name        string
+		class       string
+		accepted    time.Duration
+		requested   time.Duration
+		wantMin     time.Duration
+		wantMax     time.Duration
+		wantReason  string
+		wantClamped bool
+		wantEvent   string
+	}{
+		{
+			name:      "initial expiration is shortened to the lifespan",
+			requested: 30 * day,
+			wantMin:   day - time.Minute,
+			wantMax:   day,
+		},
+		{
+			name:       "renewal within policy is recorded",
+			accepted:   time.Hour,
+			requested:  3 * time.Hour,
+			wantMin:    3*time.Hour - time.Second,
+			wantMax:    3 * time.Hour,
+			wantReason: "Renewed",
+			wantEvent:  "Normal Renewed",
+		},
+		{
+			name:        "renewal beyond lifespan is clamped",
+			accepted:    time.Hour,
+			requested:   3 * day,
+			wantMin:     day - time.Minute,
+			wantMax:     day,
+			wantReason:  "RenewalClamped",
+			wantClamped: true,
+			wantEvent:   "Normal RenewalClamped",
+		},
+		{
+			// Clients could accept any expiration by writing the
+			// status of the desk without the webhook.
+			name:      "accepted expiration beyond the policy is shortened",
+			accepted:  30 * day,
+			requested: 30 * day,
+			wantMin:   day - time.Minute,
+			wantMax:   day,
+			wantEvent: "Warning ExpirationShortened",
+		},
+		{
+			name:       "renewal beyond max renewals of owner is reverted",
+			class:      "course",
+			accepted:   time.Hour,
+			requested:  3 * time.Hour,
+			wantMin:    time.Hour - time.Second,
+			wantMax:    time.Hour,
+			wantReason: "RenewalRejected",
+			wantEvent:  "Warning RenewalRejected",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			desk := newTestDesk("alice", "alice")
+			if test.class != "" {
+				desk.Spec.DeskClassName = test.class
+			}
+			desk.Spec.ExpirationTimestamp = metav1.NewTime(time.Now().Add(test.requested))
+			desk.Status.AcceptedExpirationTimestamp = metav1.Time{}
+			if test.accepted != 0 {
+				desk.Status.AcceptedExpirationTimestamp = metav1.NewTime(time.Now().Add(test.accepted))
+			}
+			f := newFixture(t, testDomain, []*apiv1.Desk{desk}, append(desiredDeskObjects(desk, testDomain), course))
+			defer f.controller.expirer.Stop()
+			f.controller.expirationPolicy = &apiv1.DeskExpirationPolicy{MaxLifespan: &metav1.Duration{Duration: day}}
+
+			if err := f.controller.reconcileDesk("alice"); err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+			renewed := f.getDesk("alice")
+			expiration := renewed.Spec.ExpirationTimestamp.Time
+			if min, max := time.Now().Add(test.wantMin), time.Now().Add(test.wantMax); expiration.Before(min) || expiration.After(max) {
+				t.Errorf("Expected expiration between %s and %s, got %s", min, max, expiration)
+			}
+			if !renewed.Status.AcceptedExpirationTimestamp.Equal(renewed.Spec.ExpirationTimestamp) {
+				t.Errorf("Expected accepted expiration %s, got %s", renewed.Spec.ExpirationTimestamp, renewed.Status.AcceptedExpirationTimestamp)
+			}
+			if events := f.events(); test.wantEvent != "" && !hasEvent(events, test.wantEvent) {
+				t.Errorf("Expected event %q, got %q", test.wantEvent, events)
+			}
+
+			condition := renewed.Status.Condition(apiv1.DeskConditionRenewalAccepted)
+			if test.wantReason == "" {
+				if condition != nil {
+					t.Errorf("Expected no %s condition, got %+v", apiv1.DeskConditionRenewalAccepted, condition)
+				}
+				return
+			}
+			if condition == nil || condition.Reason != test.wantReason {
+				t.Fatalf("Expected %s condition with reason %s, got %+v", apiv1.DeskConditionRenewalAccepted, test.wantReason, condition)
+			}
+			wantRenewals := 1
+			if test.wantReason == "RenewalRejected" {
+				wantRenewals = 0
+			}
+			if len(renewed.Status.Renewals) != wantRenewals {
+				t.Fatalf("Expected %d renewals, got %+v", wantRenewals, renewed.Status.Renewals)
+			}
+			if wantRenewals == 1 && renewed.Status.Renewals[0].Clamped != test.wantClamped {
+				t.Errorf("Expected renewal clamped %v, got %v", test.wantClamped, renewed.Status.Renewals[0].Clamped)
+			}
+		})
+	}
+}
+
+func TestReconcileDeskSchedulesExpiration(t *testing.T) {
+	desk := newTestDesk("alice", "alice")
+	f := newFixture(t, testDomain, []*apiv1.Desk{desk}, desiredDeskObjects(desk, testDomain))
+	defer f.controller.expirer.Stop()
+
+	if err := f.controller.reconcileDesk("alice"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	f.controller.expirer.mu.Lock()
+	deadline, ok := f.controller.expirer.deadlines["alice"]
+	f.controller.expirer.mu.Unlock()
+	if !ok {
+		t.Fatalf("Expected expiration of desk \"alice\" to be scheduled")
+	}
+	if !deadline.at.Equal(desk.Spec.ExpirationTimestamp.Time) {
+		t.Errorf("Expected expiration at %s, got %s", desk.Spec.ExpirationTimestamp.Time, deadline.at)
+	}
+}
+
+func TestDeskVersionChangeEnqueuesItsDesks(t *testing.T) {
+	alice := newTestDesk("alice", "alice")
+	bob := newTestDesk("bob", "bob")
+	bob.Spec.Version = "v1.8.0"
+	f := newFixture(t, testDomain, []*apiv1.Desk{alice, bob}, nil)
+
+	f.controller.handleDeskVersionChange(newTestDeskVersion("v1.8.0", "joelanford/kubeshell:v1.8.0"))
+
+	if n := f.controller.desksQueue.Len(); n != 1 {
+		t.Fatalf("Expected 1 queued desk, got %d", n)
+	}
+	if key, _ := f.controller.desksQueue.Get(); key != "bob" {
+		t.Errorf("Expected desk \"bob\" to be queued, got %v", key)
+	}
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	kcache "k8s.io/client-go/tools/cache"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Image of the default desk version, which is created when the
+	// controller starts so that desks with the default version work out of
+	// the box.
+	defaultDeskVersionImage = "joelanford/kubeshell:v1.7.0-latest"
+)
+
+func (c *WorkshopController) setDeskVersionsStore() {
+	c.deskVersionsStore, c.deskVersionsController = kcache.NewInformer(
+		&kcache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				return c.workshopClient.WorkshopV1().DeskVersions().List(options)
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				return c.workshopClient.WorkshopV1().DeskVersions().Watch(options)
+			},
+		},
+		&apiv1.DeskVersion{},
+		resyncPeriod,
+		kcache.ResourceEventHandlerFuncs{
+			AddFunc: c.handleDeskVersionChange,
+			UpdateFunc: func(oldObj, newObj interface{}) {
+				c.handleDeskVersionChange(newObj)
+			},
+			DeleteFunc: c.handleDeskVersionChange,
+		},
+	)
+}
+
+// handleDeskVersionChange enqueues every desk of the changed version, so that
+// their shells are updated and desks waiting for the version are resumed.
+func (c *WorkshopController) handleDeskVersionChange(obj interface{}) {
+	c.health.observeEvent("deskversions")
+	name, err := kcache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		glog.Errorf("Could not get key for desk version %+v: %s", obj, err)
+		return
+	}
+	for _, obj := range c.desksStore.List() {
+		if desk, ok := obj.(*apiv1.Desk); ok && apiv1.DeskVersionName(desk.Spec.Version) == name {
+			glog.V(4).Infof("Desk version \"%s\" of desk \"%s\" changed", name, desk.Name)
+			c.enqueueDeskByName(desk.Name)
+		}
+	}
+}
+
+// getDeskVersion returns the named desk version from the cache.
+func (c *WorkshopController) getDeskVersion(name string) (*apiv1.DeskVersion, bool) {
+	obj, exists, err := c.deskVersionsStore.GetByKey(name)
+	if err != nil || !exists {
+		return nil, false
+	}
+	version, ok := obj.(*apiv1.DeskVersion)
+	return version, ok
+}
+
+func newDefaultDeskVersion() *apiv1.DeskVersion {
+	return &apiv1.DeskVersion{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: apiv1.DeskDefaultVersion,
+		},
+		Spec: apiv1.DeskVersionSpec{
+			Description:    "Latest kubeshell with kubectl v1.7.0",
+			Image:          defaultDeskVersionImage,
+			KubectlVersion: "v1.7.0",
+		},
+	}
+}
+
+// ensureDefaultDeskVersion creates the default desk version if it does not
+// exist. An existing default desk version is left alone, so that cluster
+// administrators can change it.
+func (c *WorkshopController) ensureDefaultDeskVersion() error {
+	version, err := c.workshopClient.WorkshopV1().DeskVersions().Create(newDefaultDeskVersion())
+	if apierrors.IsAlreadyExists(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	glog.V(0).Infof("Created default desk version \"%s\" with image \"%s\"", version.Name, version.Spec.Image)
+	return nil
+}
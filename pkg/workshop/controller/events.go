@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Component of the events that the controller records.
+	eventComponent = "workshop-controller"
+
+	// Reasons of the events that the controller records for desks. The
+	// events of state transitions have the state as their reason, and the
+	// events of renewals the reason of the RenewalAccepted condition.
+	deskEventExpired             = "Expired"
+	deskEventIdleSuspended       = "IdleSuspended"
+	deskEventExpirationShortened = "ExpirationShortened"
+	deskEventTeardownFailed      = "TeardownFailed"
+	deskEventTornDown            = "TornDown"
+)
+
+// newEventRecorder returns a broadcaster of the events of the controller and a
+// recorder that sends events to it. The events are only written to the
+// apiserver once startRecordingEvents is called.
+func newEventRecorder() (record.EventBroadcaster, record.EventRecorder) {
+	broadcaster := record.NewBroadcaster()
+	return broadcaster, broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: eventComponent})
+}
+
+// startRecordingEvents writes the events of the controller to the apiserver
+// and logs them.
+func (c *WorkshopController) startRecordingEvents() {
+	c.eventBroadcaster.StartLogging(glog.V(4).Infof)
+	c.eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.kubeClient.CoreV1().Events("")})
+}
+
+// deskReference returns a reference to the desk for its events. Desks are not
+// registered in the scheme of the recorder, and desks from the caches have no
+// kind, so the reference is built from the desk itself. Events of desks are
+// recorded in the default namespace, since desks are cluster scoped.
+func deskReference(desk *apiv1.Desk) *v1.ObjectReference {
+	return &v1.ObjectReference{
+		APIVersion:      apiv1.SchemeGroupVersion.String(),
+		Kind:            apiv1.DeskKind,
+		Name:            desk.Name,
+		UID:             desk.UID,
+		ResourceVersion: desk.ResourceVersion,
+	}
+}
+
+// recordDeskEvent records an event of the desk.
+func (c *WorkshopController) recordDeskEvent(desk *apiv1.Desk, eventType, reason, messageFmt string, args ...interface{}) {
+	c.recorder.Eventf(deskReference(desk), eventType, reason, messageFmt, args...)
+}
+
+// recordDeskStateEvent records the transition of the desk to the state of
+// status. Transitions to states in which the desk does not work are
+// warnings.
+func (c *WorkshopController) recordDeskStateEvent(desk *apiv1.Desk, status apiv1.DeskStatus) {
+	eventType := v1.EventTypeNormal
+	if status.State == apiv1.DeskStateFailed || status.State == apiv1.DeskStateInvalid {
+		eventType = v1.EventTypeWarning
+	}
+	c.recordDeskEvent(desk, eventType, string(status.State), "%s", status.Message)
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+// deskExpirer keeps track of a deadline, e.g. the expiration, of every active
+// desk. When a deadline passes, the desk is handed back to the controller
+// through the expire callback so that it goes through the same reconcile
+// path as every other change to the desk.
+type deskExpirer struct {
+	mu        sync.Mutex
+	deadline  string
+	deadlines map[string]*deskDeadline
+	expire    func(name string)
+}
+
+type deskDeadline struct {
+	at    time.Time
+	timer *time.Timer
+}
+
+// newDeskExpirer returns a deskExpirer for the deadline, which names it in
+// log messages.
+func newDeskExpirer(deadline string, expire func(name string)) *deskExpirer {
+	return &deskExpirer{
+		deadline:  deadline,
+		deadlines: make(map[string]*deskDeadline),
+		expire:    expire,
+	}
+}
+
+// Schedule sets the deadline for the named desk. Scheduling the
+// same deadline again is a no-op and scheduling a different deadline replaces
+// the previous one.
+func (e *deskExpirer) Schedule(name string, at time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if d, ok := e.deadlines[name]; ok {
+		if d.at.Equal(at) {
+			return
+		}
+		d.timer.Stop()
+		glog.V(1).Infof("Rescheduling %s of desk \"%s\" from %s to %s", e.deadline, name, d.at, at)
+	} else {
+		glog.V(1).Infof("Scheduling %s of desk \"%s\" at %s", e.deadline, name, at)
+	}
+
+	e.deadlines[name] = &deskDeadline{
+		at: at,
+		timer: time.AfterFunc(time.Until(at), func() {
+			e.fire(name, at)
+		}),
+	}
+}
+
+// Cancel forgets the deadline of the named desk, if it has one.
+func (e *deskExpirer) Cancel(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if d, ok := e.deadlines[name]; ok {
+		d.timer.Stop()
+		delete(e.deadlines, name)
+		glog.V(1).Infof("Cancelled %s of desk \"%s\"", e.deadline, name)
+	}
+}
+
+// Stop cancels all pending deadlines.
+func (e *deskExpirer) Stop() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, d := range e.deadlines {
+		d.timer.Stop()
+		delete(e.deadlines, name)
+	}
+}
+
+func (e *deskExpirer) fire(name string, at time.Time) {
+	e.mu.Lock()
+	d, ok := e.deadlines[name]
+	if !ok || !d.at.Equal(at) {
+		// The deadline was cancelled or rescheduled after the timer fired.
+		e.mu.Unlock()
+		return
+	}
+	delete(e.deadlines, name)
+	e.mu.Unlock()
+
+	glog.V(0).Infof("Desk \"%s\" reached its %s at %s", name, e.deadline, at)
+	e.expire(name)
+}
+
+func isDeskExpired(desk *apiv1.Desk, now time.Time) bool {
+	if desk.Status.State == apiv1.DeskStateExpired {
+		return true
+	}
+	expiration := desk.Spec.ExpirationTimestamp
+	return !expiration.IsZero() && !expiration.After(now)
+}
+
+// expireDesk marks the desk as expired and deletes it.
+func (c *WorkshopController) expireDesk(desk *apiv1.Desk) error {
+	if desk.Status.State != apiv1.DeskStateExpired {
+		expired := desk.DeepCopyObject().(*apiv1.Desk)
+		expired.Status.State = apiv1.DeskStateExpired
+		expired.Status.Message = fmt.Sprintf("Desk expired at %s", desk.Spec.ExpirationTimestamp)
+		if _, err := c.workshopClient.WorkshopV1().Desks().Update(expired); err != nil {
+			return err
+		}
+		glog.V(1).Infof("Marked desk \"%s\" as expired", desk.Name)
+	}
+
+	if err := c.workshopClient.WorkshopV1().Desks().Delete(desk.Name, nil); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	metrics.DesksExpired.Inc()
+	c.recordDeskEvent(desk, v1.EventTypeNormal, deskEventExpired, "Deleted desk, which expired at %s", desk.Spec.ExpirationTimestamp)
+	glog.V(0).Infof("Deleted expired desk \"%s\"", desk.Name)
+	return nil
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	apiextensionsclient "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	apiextensionsv1beta1client "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/typed/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/rest"
+	kubetesting "k8s.io/client-go/testing"
+)
+
+// The vendored apiextensions-apiserver does not ship a fake clientset, so
+// this is a minimal one in the style of the generated fakes, backed by the
+// same object tracker as the other fake clientsets.
+
+var (
+	crdsResource = schema.GroupVersionResource{Group: "apiextensions.k8s.io", Version: "v1beta1", Resource: "customresourcedefinitions"}
+	crdsKind     = schema.GroupVersionKind{Group: "apiextensions.k8s.io", Version: "v1beta1", Kind: "CustomResourceDefinition"}
+)
+
+type fakeAPIExtClientset struct {
+	kubetesting.Fake
+}
+
+var _ apiextensionsclient.Interface = &fakeAPIExtClientset{}
+
+func newFakeAPIExtClientset(objects ...runtime.Object) *fakeAPIExtClientset {
+	scheme := runtime.NewScheme()
+	apiextensionsv1beta1.AddToScheme(scheme)
+	o := kubetesting.NewObjectTracker(scheme, serializer.NewCodecFactory(scheme).UniversalDecoder())
+	for _, obj := range objects {
+		if err := o.Add(obj); err != nil {
+			panic(err)
+		}
+	}
+
+	c := &fakeAPIExtClientset{}
+	c.AddReactor("*", "*", kubetesting.ObjectReaction(o))
+	c.AddWatchReactor("*", kubetesting.DefaultWatchReactor(watch.NewFake(), nil))
+	return c
+}
+
+func (c *fakeAPIExtClientset) Discovery() discovery.DiscoveryInterface {
+	return &fakediscovery.FakeDiscovery{Fake: &c.Fake}
+}
+
+func (c *fakeAPIExtClientset) ApiextensionsV1beta1() apiextensionsv1beta1client.ApiextensionsV1beta1Interface {
+	return &fakeApiextensionsV1beta1{&c.Fake}
+}
+
+func (c *fakeAPIExtClientset) Apiextensions() apiextensionsv1beta1client.ApiextensionsV1beta1Interface {
+	return &fakeApiextensionsV1beta1{&c.Fake}
+}
+
+type fakeApiextensionsV1beta1 struct {
+	*kubetesting.Fake
+}
+
+func (c *fakeApiextensionsV1beta1) CustomResourceDefinitions() apiextensionsv1beta1client.CustomResourceDefinitionInterface {
+	return &fakeCustomResourceDefinitions{c.Fake}
+}
+
+func (c *fakeApiextensionsV1beta1) RESTClient() rest.Interface {
+	var ret *rest.RESTClient
+	return ret
+}
+
+type fakeCustomResourceDefinitions struct {
+	Fake *kubetesting.Fake
+}
+
+func (c *fakeCustomResourceDefinitions) Create(crd *apiextensionsv1beta1.CustomResourceDefinition) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	obj, err := c.Fake.Invokes(kubetesting.NewRootCreateAction(crdsResource, crd), &apiextensionsv1beta1.CustomResourceDefinition{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*apiextensionsv1beta1.CustomResourceDefinition), err
+}
+
+func (c *fakeCustomResourceDefinitions) Update(crd *apiextensionsv1beta1.CustomResourceDefinition) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	obj, err := c.Fake.Invokes(kubetesting.NewRootUpdateAction(crdsResource, crd), &apiextensionsv1beta1.CustomResourceDefinition{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*apiextensionsv1beta1.CustomResourceDefinition), err
+}
+
+func (c *fakeCustomResourceDefinitions) UpdateStatus(crd *apiextensionsv1beta1.CustomResourceDefinition) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	obj, err := c.Fake.Invokes(kubetesting.NewRootUpdateSubresourceAction(crdsResource, "status", crd), &apiextensionsv1beta1.CustomResourceDefinition{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*apiextensionsv1beta1.CustomResourceDefinition), err
+}
+
+func (c *fakeCustomResourceDefinitions) Delete(name string, options *metav1.DeleteOptions) error {
+	_, err := c.Fake.Invokes(kubetesting.NewRootDeleteAction(crdsResource, name), &apiextensionsv1beta1.CustomResourceDefinition{})
+	return err
+}
+
+func (c *fakeCustomResourceDefinitions) DeleteCollection(options *metav1.DeleteOptions, listOptions metav1.ListOptions) error {
+	_, err := c.Fake.Invokes(kubetesting.NewRootDeleteCollectionAction(crdsResource, listOptions), &apiextensionsv1beta1.CustomResourceDefinitionList{})
+	return err
+}
+
+func (c *fakeCustomResourceDefinitions) Get(name string, options metav1.GetOptions) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	obj, err := c.Fake.Invokes(kubetesting.NewRootGetAction(crdsResource, name), &apiextensionsv1beta1.CustomResourceDefinition{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*apiextensionsv1beta1.CustomResourceDefinition), err
+}
+
+func (c *fakeCustomResourceDefinitions) List(opts metav1.ListOptions) (*apiextensionsv1beta1.CustomResourceDefinitionList, error) {
+	obj, err := c.Fake.Invokes(kubetesting.NewRootListAction(crdsResource, crdsKind, opts), &apiextensionsv1beta1.CustomResourceDefinitionList{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*apiextensionsv1beta1.CustomResourceDefinitionList), err
+}
+
+func (c *fakeCustomResourceDefinitions) Watch(opts metav1.ListOptions) (watch.Interface, error) {
+	return c.Fake.InvokesWatch(kubetesting.NewRootWatchAction(crdsResource, opts))
+}
+
+func (c *fakeCustomResourceDefinitions) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (*apiextensionsv1beta1.CustomResourceDefinition, error) {
+	obj, err := c.Fake.Invokes(kubetesting.NewRootPatchSubresourceAction(crdsResource, name, data, subresources...), &apiextensionsv1beta1.CustomResourceDefinition{})
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*apiextensionsv1beta1.CustomResourceDefinition), err
+}
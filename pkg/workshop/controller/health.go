@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// Period at which a heartbeat is sent through the desk workqueue.
+	HeartbeatPeriod = 30 * time.Second
+)
+
+// heartbeatKey is added to the desk workqueue periodically. It is handled by
+// the desk workers like any desk, so a missing heartbeat means that the
+// workers or the queue are stuck.
+type heartbeatKey struct{}
+
+// healthTracker records the signals used by the readiness and liveness
+// checks of the controller.
+type healthTracker struct {
+	mu             sync.Mutex
+	crdEstablished bool
+	workersStarted time.Time
+	lastHeartbeat  time.Time
+	lastEvent      map[string]time.Time
+}
+
+func newHealthTracker() *healthTracker {
+	return &healthTracker{
+		lastEvent: make(map[string]time.Time),
+	}
+}
+
+func (h *healthTracker) setCRDEstablished() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.crdEstablished = true
+}
+
+func (h *healthTracker) setWorkersStarted() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.workersStarted = time.Now()
+	h.lastHeartbeat = h.workersStarted
+}
+
+func (h *healthTracker) heartbeat() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastHeartbeat = time.Now()
+}
+
+// observeEvent records that the informer for resource delivered an event.
+func (h *healthTracker) observeEvent(resource string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastEvent[resource] = time.Now()
+}
+
+// Ready returns an error describing why the controller is not ready to
+// reconcile desks, or nil once the workshop custom resource definitions are
+// established, all informers have synced and the desk workers are running.
+func (c *WorkshopController) Ready() error {
+	c.health.mu.Lock()
+	crdEstablished := c.health.crdEstablished
+	workersStarted := !c.health.workersStarted.IsZero()
+	c.health.mu.Unlock()
+
+	var reasons []string
+	if !crdEstablished {
+		reasons = append(reasons, "workshop custom resource definitions are not established")
+	}
+	var unsynced []string
+	if !c.desksController.HasSynced() {
+		unsynced = append(unsynced, "desks")
+	}
+	if !c.deskVersionsController.HasSynced() {
+		unsynced = append(unsynced, "deskversions")
+	}
+	if !c.deskClassesController.HasSynced() {
+		unsynced = append(unsynced, "deskclasses")
+	}
+	for resource, informer := range c.ownedInformers() {
+		if !informer.HasSynced() {
+			unsynced = append(unsynced, resource)
+		}
+	}
+	if len(unsynced) > 0 {
+		sort.Strings(unsynced)
+		reasons = append(reasons, fmt.Sprintf("informers for %s have not synced", strings.Join(unsynced, ", ")))
+	}
+	if !workersStarted {
+		reasons = append(reasons, "desk workers have not started")
+	}
+	if len(reasons) > 0 {
+		return fmt.Errorf("%s", strings.Join(reasons, "; "))
+	}
+	return nil
+}
+
+// Healthy returns an error if the desk workers have not processed a heartbeat
+// within missedPeriods heartbeat periods, or if an informer with cached
+// objects has not delivered an event, not even a periodic resync, within
+// missedPeriods resync periods. A controller that has not been started is
+// considered healthy.
+func (c *WorkshopController) Healthy(missedPeriods int) error {
+	c.health.mu.Lock()
+	defer c.health.mu.Unlock()
+
+	if c.health.workersStarted.IsZero() {
+		return nil
+	}
+	now := time.Now()
+
+	var reasons []string
+	if since := now.Sub(c.health.lastHeartbeat); since > time.Duration(missedPeriods)*HeartbeatPeriod {
+		reasons = append(reasons, fmt.Sprintf("desk workers have not processed a heartbeat for %s", since))
+	}
+
+	stores := map[string]int{
+		"desks":        len(c.desksStore.ListKeys()),
+		"deskversions": len(c.deskVersionsStore.ListKeys()),
+		"deskclasses":  len(c.deskClassesStore.ListKeys()),
+	}
+	for resource, informer := range c.ownedInformers() {
+		stores[resource] = len(informer.GetStore().ListKeys())
+	}
+	for resource, count := range stores {
+		if count == 0 {
+			// Resyncs only deliver events for cached objects.
+			continue
+		}
+		last, ok := c.health.lastEvent[resource]
+		if !ok || last.Before(c.health.workersStarted) {
+			last = c.health.workersStarted
+		}
+		if since := now.Sub(last); since > time.Duration(missedPeriods)*resyncPeriod {
+			reasons = append(reasons, fmt.Sprintf("%s informer has not delivered an event for %s", resource, since))
+		}
+	}
+	if len(reasons) > 0 {
+		sort.Strings(reasons)
+		return fmt.Errorf("%s", strings.Join(reasons, "; "))
+	}
+	return nil
+}
+
+// sendHeartbeats adds a heartbeat to the desk workqueue every heartbeat
+// period until stop is closed.
+func (c *WorkshopController) sendHeartbeats(stop <-chan struct{}) {
+	ticker := time.NewTicker(HeartbeatPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			glog.V(5).Infof("Sending heartbeat to desk workers")
+			c.desksQueue.Add(heartbeatKey{})
+		}
+	}
+}
@@ -2,7 +2,10 @@ package controller
 
 import (
 	"fmt"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/pkg/api/v1"
@@ -10,25 +13,24 @@ import (
 
 	"github.com/golang/glog"
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
 )
 
-func (c *WorkshopController) createDeskKubeshellIngress(desk *apiv1.Desk, name string, namespace *v1.Namespace, domain string) (*extensionsv1beta1.Ingress, error) {
+func newDeskKubeshellIngress(desk *apiv1.Desk, class *apiv1.DeskClass, name string, namespace *v1.Namespace, domain string) *extensionsv1beta1.Ingress {
 	deskDomain := fmt.Sprintf("%s.%s", desk.Name, domain)
-	ingress, err := c.kubeClient.ExtensionsV1beta1().Ingresses(namespace.Name).Create(&extensionsv1beta1.Ingress{
+	annotations := map[string]string{
+		"kubernetes.io/ingress.allow-http":     "false",
+		"ingress.kubernetes.io/rewrite-target": "/",
+	}
+	for k, v := range class.Spec.Exposure.IngressAnnotations {
+		annotations[k] = v
+	}
+	return &extensionsv1beta1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-			Annotations: map[string]string{
-				"kubernetes.io/ingress.allow-http":     "false",
-				"ingress.kubernetes.io/rewrite-target": "/",
-			},
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: apiv1.SchemeGroupVersion.String(),
-					Kind:       apiv1.DeskKind,
-					Name:       desk.Name,
-					UID:        desk.UID,
-				},
-			},
+			Name:            name,
+			Namespace:       namespace.Name,
+			Annotations:     annotations,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
 		},
 		Spec: extensionsv1beta1.IngressSpec{
 			TLS: []extensionsv1beta1.IngressTLS{
@@ -41,10 +43,10 @@ func (c *WorkshopController) createDeskKubeshellIngress(desk *apiv1.Desk, name s
 						HTTP: &extensionsv1beta1.HTTPIngressRuleValue{
 							Paths: []extensionsv1beta1.HTTPIngressPath{
 								{
-									Path: fmt.Sprintf("/%s", name),
+									Path: class.Spec.Exposure.Path,
 									Backend: extensionsv1beta1.IngressBackend{
 										ServiceName: name,
-										ServicePort: intstr.FromInt(4200),
+										ServicePort: intstr.FromInt(int(class.Spec.Shell.Port)),
 									},
 								},
 							},
@@ -53,11 +55,60 @@ func (c *WorkshopController) createDeskKubeshellIngress(desk *apiv1.Desk, name s
 				},
 			},
 		},
-	})
+	}
+}
+
+// ensureDeskKubeshellIngress creates the kubeshell ingress if it does not
+// exist and restores its annotations and rules if they were modified.
+func (c *WorkshopController) ensureDeskKubeshellIngress(desk *apiv1.Desk, class *apiv1.DeskClass, name string, namespace *v1.Namespace, domain string) (_ *extensionsv1beta1.Ingress, err error) {
+	defer metrics.ObserveReconcile("ingress", desk.Spec.DeskClassName, time.Now(), &err)
+
+	desired := newDeskKubeshellIngress(desk, class, name, namespace, domain)
+	current, err := c.getIngress(namespace.Name, name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskIngress(desk, desired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*extensionsv1beta1.Ingress)
+	changed := setDeskOwnerReference(updated, desk)
+	if mergeStringMap(&updated.Annotations, desired.Annotations) {
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(updated.Spec, desired.Spec) {
+		updated.Spec = desired.Spec
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	ingress, err := c.kubeClient.ExtensionsV1beta1().Ingresses(namespace.Name).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired ingress \"%s\" in namespace \"%s\" for desk \"%s\"", ingress.Name, namespace.Name, desk.Name)
+	return ingress, nil
+}
+
+func (c *WorkshopController) getIngress(namespace, name string) (*extensionsv1beta1.Ingress, error) {
+	if obj, ok := getCachedObject(c.ingressesInformer, namespace, name); ok {
+		return obj.(*extensionsv1beta1.Ingress), nil
+	}
+	return c.kubeClient.ExtensionsV1beta1().Ingresses(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskIngress(desk *apiv1.Desk, desired *extensionsv1beta1.Ingress) (*extensionsv1beta1.Ingress, error) {
+	ingress, err := c.kubeClient.ExtensionsV1beta1().Ingresses(desired.Namespace).Create(desired)
 	if err != nil {
 		return nil, err
 	}
-	glog.V(1).Infof("Created ingress \"%s\" in namespace \"%s\" for desk \"%s\"", ingress.Name, namespace.Name, desk.Name)
+	glog.V(1).Infof("Created ingress \"%s\" in namespace \"%s\" for desk \"%s\"", ingress.Name, desired.Namespace, desk.Name)
 
 	return ingress, nil
 }
@@ -0,0 +1,316 @@
+package controller
+
+import (
+	"bytes"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+const (
+	// Name of the secret in the shell namespace of each desk for which the
+	// token controller issues a token of the serviceaccount of the desk.
+	deskTokenSecretName = "desk-token"
+)
+
+// newDeskTokenSecret returns a secret for which the token controller issues a
+// token of the serviceaccount. The rotation is recorded so that a new token
+// is issued when the desk is renewed.
+func newDeskTokenSecret(desk *apiv1.Desk, sa *v1.ServiceAccount, rotation string) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      deskTokenSecretName,
+			Namespace: sa.Namespace,
+			Labels:    map[string]string{apiv1.DeskNamespaceLabel: desk.Name},
+			Annotations: map[string]string{
+				v1.ServiceAccountNameKey:          sa.Name,
+				apiv1.DeskTokenRotationAnnotation: rotation,
+			},
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Type: v1.SecretTypeServiceAccountToken,
+	}
+	if sa.UID != "" {
+		secret.Annotations[v1.ServiceAccountUIDKey] = string(sa.UID)
+	}
+	return secret
+}
+
+// newDeskKubeconfig returns a kubeconfig that connects to the server with the
+// token and the CA of the token secret, in the given namespace by default.
+func newDeskKubeconfig(desk *apiv1.Desk, server string, token *v1.Secret, namespace string) ([]byte, error) {
+	config := clientcmdapi.NewConfig()
+
+	cluster := clientcmdapi.NewCluster()
+	cluster.Server = server
+	cluster.CertificateAuthorityData = token.Data[v1.ServiceAccountRootCAKey]
+	config.Clusters[desk.Name] = cluster
+
+	authInfo := clientcmdapi.NewAuthInfo()
+	authInfo.Token = string(token.Data[v1.ServiceAccountTokenKey])
+	config.AuthInfos[desk.Name] = authInfo
+
+	context := clientcmdapi.NewContext()
+	context.Cluster = desk.Name
+	context.AuthInfo = desk.Name
+	context.Namespace = namespace
+	config.Contexts[desk.Name] = context
+	config.CurrentContext = desk.Name
+
+	return clientcmd.Write(*config)
+}
+
+// deskTokenRotation returns the rotation of the token of the desk, which is
+// its accepted expiration.
+func deskTokenRotation(desk *apiv1.Desk) string {
+	return desk.Status.AcceptedExpirationTimestamp.UTC().Format(time.RFC3339)
+}
+
+// ensureDeskKubeconfig publishes a kubeconfig with a token of the
+// serviceaccount of the desk in a secret in the namespace of the
+// serviceaccount. The token is rotated whenever the accepted expiration of
+// the desk changes, i.e. when it is renewed, which the controller holds to
+// the expiration policy of the desk. It returns nil until the token
+// controller has issued the token.
+func (c *WorkshopController) ensureDeskKubeconfig(desk *apiv1.Desk, sa *v1.ServiceAccount, workingNamespace *v1.Namespace) (_ *v1.Secret, err error) {
+	defer metrics.ObserveReconcile("kubeconfig", desk.Spec.DeskClassName, time.Now(), &err)
+
+	rotation := deskTokenRotation(desk)
+	token, err := c.getSecret(sa.Namespace, deskTokenSecretName)
+	if apierrors.IsNotFound(err) {
+		return nil, c.createDeskTokenSecret(desk, sa, rotation)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.Annotations[apiv1.DeskTokenRotationAnnotation] != rotation {
+		// The cache may not have seen the rotated secret yet.
+		token, err = c.kubeClient.CoreV1().Secrets(sa.Namespace).Get(deskTokenSecretName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			return nil, c.createDeskTokenSecret(desk, sa, rotation)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if token.Annotations[apiv1.DeskTokenRotationAnnotation] != rotation {
+		// Deleting the secret revokes its token.
+		if err := c.kubeClient.CoreV1().Secrets(sa.Namespace).Delete(deskTokenSecretName, nil); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		glog.V(0).Infof("Rotating token of serviceaccount \"%s\" in namespace \"%s\" for renewed desk \"%s\"", sa.Name, sa.Namespace, desk.Name)
+		return nil, c.createDeskTokenSecret(desk, sa, rotation)
+	}
+	if len(token.Data[v1.ServiceAccountTokenKey]) == 0 {
+		return nil, nil
+	}
+
+	kubeconfig, err := newDeskKubeconfig(desk, c.kubeconfigServer, token, workingNamespace.Name)
+	if err != nil {
+		return nil, err
+	}
+	desired := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            apiv1.DeskKubeconfigSecretName,
+			Namespace:       sa.Namespace,
+			Labels:          map[string]string{apiv1.DeskNamespaceLabel: desk.Name},
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{apiv1.DeskKubeconfigSecretKey: kubeconfig},
+	}
+
+	current, err := c.getSecret(desired.Namespace, desired.Name)
+	if apierrors.IsNotFound(err) {
+		secret, err := c.kubeClient.CoreV1().Secrets(desired.Namespace).Create(desired)
+		if err != nil {
+			return nil, err
+		}
+		glog.V(1).Infof("Created kubeconfig secret \"%s\" in namespace \"%s\" for desk \"%s\"", secret.Name, secret.Namespace, desk.Name)
+		return secret, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.Secret)
+	changed := setDeskOwnerReference(updated, desk)
+	if !bytes.Equal(updated.Data[apiv1.DeskKubeconfigSecretKey], kubeconfig) {
+		updated.Data = desired.Data
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	secret, err := c.kubeClient.CoreV1().Secrets(desired.Namespace).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Updated kubeconfig secret \"%s\" in namespace \"%s\" for desk \"%s\"", secret.Name, secret.Namespace, desk.Name)
+	return secret, nil
+}
+
+// newDeskKubeconfigRole returns a role that allows reading the kubeconfig
+// secret of the desk and nothing else, since the owner of the desk may only
+// view the shell namespace.
+func newDeskKubeconfigRole(desk *apiv1.Desk, secret *v1.Secret) *rbacv1beta1.Role {
+	return &rbacv1beta1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            apiv1.DeskKubeconfigSecretName,
+			Namespace:       secret.Namespace,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Rules: []rbacv1beta1.PolicyRule{
+			{
+				APIGroups:     []string{v1.GroupName},
+				Resources:     []string{"secrets"},
+				ResourceNames: []string{secret.Name},
+				Verbs:         []string{"get"},
+			},
+		},
+	}
+}
+
+// newDeskKubeconfigRoleBinding returns a rolebinding of the kubeconfig role
+// of the desk to the given users and groups.
+func newDeskKubeconfigRoleBinding(desk *apiv1.Desk, role *rbacv1beta1.Role, users []rbacv1beta1.Subject) *rbacv1beta1.RoleBinding {
+	return &rbacv1beta1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            role.Name,
+			Namespace:       role.Namespace,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		RoleRef: rbacv1beta1.RoleRef{
+			APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
+			Kind:     "Role",
+			Name:     role.Name,
+		},
+		Subjects: users,
+	}
+}
+
+// deskKubeconfigSubjects returns the users and groups that may read the
+// kubeconfig of the desk: the users of the desk if the controller binds
+// them, and otherwise only the owner, so that owners can always get the
+// kubeconfig of their desks.
+func (c *WorkshopController) deskKubeconfigSubjects(desk *apiv1.Desk) []rbacv1beta1.Subject {
+	if users := c.deskUserSubjects(desk); users != nil {
+		return users
+	}
+	return []rbacv1beta1.Subject{
+		{
+			Kind:     rbacv1beta1.UserKind,
+			APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
+			Name:     desk.Spec.Owner,
+		},
+	}
+}
+
+// ensureDeskKubeconfigAccess creates the role and the rolebinding that allow
+// the users of the desk to read its kubeconfig secret, or restores them if
+// they were modified.
+func (c *WorkshopController) ensureDeskKubeconfigAccess(desk *apiv1.Desk, secret *v1.Secret) (err error) {
+	defer metrics.ObserveReconcile("kubeconfigaccess", desk.Spec.DeskClassName, time.Now(), &err)
+
+	rbac := c.kubeClient.RbacV1beta1()
+	desiredRole := newDeskKubeconfigRole(desk, secret)
+	var role *rbacv1beta1.Role
+	if obj, ok := getCachedObject(c.rolesInformer, desiredRole.Namespace, desiredRole.Name); ok {
+		role = obj.(*rbacv1beta1.Role)
+	} else if role, err = rbac.Roles(desiredRole.Namespace).Get(desiredRole.Name, metav1.GetOptions{}); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	switch {
+	case role == nil || apierrors.IsNotFound(err):
+		if _, err := rbac.Roles(desiredRole.Namespace).Create(desiredRole); err != nil {
+			return err
+		}
+		glog.V(1).Infof("Created role \"%s\" in namespace \"%s\" for desk \"%s\"", desiredRole.Name, desiredRole.Namespace, desk.Name)
+	default:
+		obj, err := copyObject(role)
+		if err != nil {
+			return err
+		}
+		updated := obj.(*rbacv1beta1.Role)
+		changed := setDeskOwnerReference(updated, desk)
+		if !equality.Semantic.DeepEqual(updated.Rules, desiredRole.Rules) {
+			updated.Rules = desiredRole.Rules
+			changed = true
+		}
+		if changed {
+			if _, err := rbac.Roles(updated.Namespace).Update(updated); err != nil {
+				return err
+			}
+			glog.V(0).Infof("Repaired role \"%s\" in namespace \"%s\" for desk \"%s\"", updated.Name, updated.Namespace, desk.Name)
+		}
+	}
+
+	desiredBinding := newDeskKubeconfigRoleBinding(desk, desiredRole, c.deskKubeconfigSubjects(desk))
+	binding, err := c.getRoleBinding(desiredBinding.Namespace, desiredBinding.Name)
+	if apierrors.IsNotFound(err) {
+		if _, err := rbac.RoleBindings(desiredBinding.Namespace).Create(desiredBinding); err != nil {
+			return err
+		}
+		glog.V(1).Infof("Created rolebinding \"%s\" in namespace \"%s\" for desk \"%s\"", desiredBinding.Name, desiredBinding.Namespace, desk.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !equality.Semantic.DeepEqual(binding.RoleRef, desiredBinding.RoleRef) {
+		// The role of a rolebinding cannot be changed, so replace it.
+		if err := rbac.RoleBindings(binding.Namespace).Delete(binding.Name, nil); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+		_, err := rbac.RoleBindings(desiredBinding.Namespace).Create(desiredBinding)
+		return err
+	}
+	obj, err := copyObject(binding)
+	if err != nil {
+		return err
+	}
+	updated := obj.(*rbacv1beta1.RoleBinding)
+	changed := setDeskOwnerReference(updated, desk)
+	if !equality.Semantic.DeepEqual(updated.Subjects, desiredBinding.Subjects) {
+		updated.Subjects = desiredBinding.Subjects
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	if _, err := rbac.RoleBindings(updated.Namespace).Update(updated); err != nil {
+		return err
+	}
+	glog.V(0).Infof("Repaired rolebinding \"%s\" in namespace \"%s\" for desk \"%s\"", updated.Name, updated.Namespace, desk.Name)
+	return nil
+}
+
+func (c *WorkshopController) createDeskTokenSecret(desk *apiv1.Desk, sa *v1.ServiceAccount, rotation string) error {
+	secret, err := c.kubeClient.CoreV1().Secrets(sa.Namespace).Create(newDeskTokenSecret(desk, sa, rotation))
+	if err != nil {
+		return err
+	}
+	glog.V(1).Infof("Created token secret \"%s\" for serviceaccount \"%s\" in namespace \"%s\" for desk \"%s\"", secret.Name, sa.Name, secret.Namespace, desk.Name)
+	return nil
+}
+
+func (c *WorkshopController) getSecret(namespace, name string) (*v1.Secret, error) {
+	if obj, ok := getCachedObject(c.secretsInformer, namespace, name); ok {
+		return obj.(*v1.Secret), nil
+	}
+	return c.kubeClient.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+// ensureDeskManifests creates the objects of the manifests of the desk class
+// that do not exist yet. Existing objects are left alone, so that the desk
+// owner can change them. The objects live in the namespaces of the desk, so
+// they are deleted along with them. It returns the number of objects that
+// exist.
+func (c *WorkshopController) ensureDeskManifests(desk *apiv1.Desk, class *apiv1.DeskClass, namespaces map[string]*v1.Namespace) (_ int, err error) {
+	defer metrics.ObserveReconcile("manifest", desk.Spec.DeskClassName, time.Now(), &err)
+
+	var errs []error
+	existing := 0
+	for i, manifest := range class.Spec.Manifests {
+		obj, err := newDeskManifestObject(desk, manifest, namespaces[manifest.Namespace])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("manifest %d: %s", i, err))
+			continue
+		}
+		if err := c.createDeskManifestObject(desk, obj); err != nil {
+			errs = append(errs, fmt.Errorf("manifest %d: %s", i, err))
+			continue
+		}
+		existing++
+	}
+	return existing, utilerrors.NewAggregate(errs)
+}
+
+// newDeskManifestObject decodes the object of the manifest and places it in
+// the namespace, owned by the desk.
+func newDeskManifestObject(desk *apiv1.Desk, manifest apiv1.DeskManifest, namespace *v1.Namespace) (runtime.Object, error) {
+	obj, _, err := scheme.Codecs.UniversalDeserializer().Decode(manifest.Object.Raw, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if object.GetName() == "" {
+		return nil, fmt.Errorf("%T has no name", obj)
+	}
+	object.SetNamespace(namespace.Name)
+	object.SetResourceVersion("")
+	setDeskOwnerReference(object, desk)
+	return obj, nil
+}
+
+// createDeskManifestObject creates obj unless it exists already. Only the
+// namespaced kinds that desks are commonly seeded with are supported.
+func (c *WorkshopController) createDeskManifestObject(desk *apiv1.Desk, obj runtime.Object) error {
+	core := c.kubeClient.CoreV1()
+	rbac := c.kubeClient.RbacV1beta1()
+	extensions := c.kubeClient.ExtensionsV1beta1()
+	options := metav1.GetOptions{}
+
+	var kind string
+	var get, create func() error
+	switch o := obj.(type) {
+	case *v1.ConfigMap:
+		kind = "configmap"
+		get = func() error { _, err := core.ConfigMaps(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := core.ConfigMaps(o.Namespace).Create(o); return err }
+	case *v1.Secret:
+		kind = "secret"
+		get = func() error { _, err := core.Secrets(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := core.Secrets(o.Namespace).Create(o); return err }
+	case *v1.ServiceAccount:
+		kind = "serviceaccount"
+		get = func() error { _, err := core.ServiceAccounts(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := core.ServiceAccounts(o.Namespace).Create(o); return err }
+	case *v1.Service:
+		kind = "service"
+		get = func() error { _, err := core.Services(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := core.Services(o.Namespace).Create(o); return err }
+	case *rbacv1beta1.Role:
+		kind = "role"
+		get = func() error { _, err := rbac.Roles(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := rbac.Roles(o.Namespace).Create(o); return err }
+	case *rbacv1beta1.RoleBinding:
+		kind = "rolebinding"
+		get = func() error { _, err := rbac.RoleBindings(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := rbac.RoleBindings(o.Namespace).Create(o); return err }
+	case *extensionsv1beta1.Deployment:
+		kind = "deployment"
+		get = func() error { _, err := extensions.Deployments(o.Namespace).Get(o.Name, options); return err }
+		create = func() error { _, err := extensions.Deployments(o.Namespace).Create(o); return err }
+	default:
+		return fmt.Errorf("unsupported kind %s", obj.GetObjectKind().GroupVersionKind())
+	}
+
+	object, _ := meta.Accessor(obj)
+	err := get()
+	if err == nil || !apierrors.IsNotFound(err) {
+		return err
+	}
+	if err := create(); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	glog.V(1).Infof("Created %s \"%s\" in namespace \"%s\" for desk \"%s\"", kind, object.GetName(), object.GetNamespace(), desk.Name)
+	return nil
+}
@@ -0,0 +1,55 @@
+package controller
+
+import (
+	kcache "k8s.io/client-go/tools/cache"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+var desksDesc = prometheus.NewDesc(
+	"workshop_desks",
+	"Number of desks, partitioned by state.",
+	[]string{"state"}, nil,
+)
+
+// deskCollector reports the number of desks in each state from the desks
+// informer cache at scrape time.
+type deskCollector struct {
+	store kcache.Store
+}
+
+// DeskCollector returns a Prometheus collector for the number of desks in
+// each state.
+func (c *WorkshopController) DeskCollector() prometheus.Collector {
+	return deskCollector{store: c.desksStore}
+}
+
+func (dc deskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- desksDesc
+}
+
+func (dc deskCollector) Collect(ch chan<- prometheus.Metric) {
+	counts := map[apiv1.DeskState]int{
+		apiv1.DeskStateInitializing: 0,
+		apiv1.DeskStateReady:        0,
+		apiv1.DeskStateExpired:      0,
+		apiv1.DeskStateTerminating:  0,
+		apiv1.DeskStateInvalid:      0,
+		apiv1.DeskStateFailed:       0,
+		apiv1.DeskStateSuspended:    0,
+	}
+	for _, obj := range dc.store.List() {
+		if desk, ok := obj.(*apiv1.Desk); ok {
+			state := desk.Status.State
+			if state == "" {
+				state = apiv1.DeskStateInitializing
+			}
+			counts[state]++
+		}
+	}
+	for state, count := range counts {
+		ch <- prometheus.MustNewConstMetric(desksDesc, prometheus.GaugeValue, float64(count), string(state))
+	}
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/pkg/api/v1"
+	networkingv1 "k8s.io/client-go/pkg/apis/networking/v1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+const (
+	// Name of the network policy in each desk namespace that only admits
+	// traffic from the namespaces of the same desk.
+	deskIsolationPolicyName = "desk-isolation"
+
+	// Name of the network policy in the shell namespace that admits traffic
+	// from the ingress controller to the kubeshell.
+	kubeshellIngressPolicyName = "kubeshell-ingress"
+)
+
+// defaultIngressNamespaceSelector selects the namespaces that are not desk
+// namespaces, one of which runs the ingress controller.
+func defaultIngressNamespaceSelector() *metav1.LabelSelector {
+	return &metav1.LabelSelector{
+		MatchExpressions: []metav1.LabelSelectorRequirement{
+			{Key: apiv1.DeskNamespaceLabel, Operator: metav1.LabelSelectorOpDoesNotExist},
+		},
+	}
+}
+
+// newDeskIsolationPolicy returns a network policy that selects all pods of
+// the namespace, which denies all ingress traffic to them that is not
+// admitted by a policy, and admits traffic from the namespaces of the desk.
+func newDeskIsolationPolicy(desk *apiv1.Desk, namespace *v1.Namespace) *networkingv1.NetworkPolicy {
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            deskIsolationPolicyName,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					From: []networkingv1.NetworkPolicyPeer{
+						{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{apiv1.DeskNamespaceLabel: desk.Name}}},
+					},
+				},
+			},
+		},
+	}
+}
+
+// newKubeshellIngressPolicy returns a network policy that admits traffic to
+// the kubeshell port from the namespaces that the selector matches.
+func newKubeshellIngressPolicy(desk *apiv1.Desk, class *apiv1.DeskClass, name string, namespace *v1.Namespace, selector *metav1.LabelSelector) *networkingv1.NetworkPolicy {
+	protocol := v1.ProtocolTCP
+	port := intstr.FromInt(int(class.Spec.Shell.Port))
+	return &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            kubeshellIngressPolicyName,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{
+				{
+					Ports: []networkingv1.NetworkPolicyPort{{Protocol: &protocol, Port: &port}},
+					From:  []networkingv1.NetworkPolicyPeer{{NamespaceSelector: selector}},
+				},
+			},
+		},
+	}
+}
+
+// ensureDeskNetworkIsolation isolates the namespaces of the desk from other
+// desks, or removes the isolation if the desk opted out of it.
+func (c *WorkshopController) ensureDeskNetworkIsolation(desk *apiv1.Desk, class *apiv1.DeskClass, kubeshellName string, namespaces map[string]*v1.Namespace) error {
+	if desk.Spec.DisableNetworkIsolation {
+		return c.deleteDeskNetworkPolicies(desk)
+	}
+
+	var errs []error
+	for _, template := range class.Spec.Namespaces {
+		if _, err := c.ensureDeskNetworkPolicy(desk, newDeskIsolationPolicy(desk, namespaces[template.Name])); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	shellNamespace := namespaces[class.Spec.Shell.Namespace]
+	if _, err := c.ensureDeskNetworkPolicy(desk, newKubeshellIngressPolicy(desk, class, kubeshellName, shellNamespace, c.ingressNamespaceSelector)); err != nil {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// ensureDeskNetworkPolicy creates the network policy if it does not exist
+// and restores its spec if it was modified.
+func (c *WorkshopController) ensureDeskNetworkPolicy(desk *apiv1.Desk, desired *networkingv1.NetworkPolicy) (_ *networkingv1.NetworkPolicy, err error) {
+	defer metrics.ObserveReconcile("networkpolicy", desk.Spec.DeskClassName, time.Now(), &err)
+
+	current, err := c.getNetworkPolicy(desired.Namespace, desired.Name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskNetworkPolicy(desk, desired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*networkingv1.NetworkPolicy)
+	changed := setDeskOwnerReference(updated, desk)
+	if !equality.Semantic.DeepEqual(updated.Spec, desired.Spec) {
+		updated.Spec = desired.Spec
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	policy, err := c.kubeClient.NetworkingV1().NetworkPolicies(desired.Namespace).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired networkpolicy \"%s\" in namespace \"%s\" for desk \"%s\"", policy.Name, desired.Namespace, desk.Name)
+	return policy, nil
+}
+
+func (c *WorkshopController) getNetworkPolicy(namespace, name string) (*networkingv1.NetworkPolicy, error) {
+	if obj, ok := getCachedObject(c.networkPoliciesInformer, namespace, name); ok {
+		return obj.(*networkingv1.NetworkPolicy), nil
+	}
+	return c.kubeClient.NetworkingV1().NetworkPolicies(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskNetworkPolicy(desk *apiv1.Desk, desired *networkingv1.NetworkPolicy) (*networkingv1.NetworkPolicy, error) {
+	policy, err := c.kubeClient.NetworkingV1().NetworkPolicies(desired.Namespace).Create(desired)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(1).Infof("Created networkpolicy \"%s\" in namespace \"%s\" for desk \"%s\"", policy.Name, desired.Namespace, desk.Name)
+	return policy, nil
+}
+
+// deleteDeskNetworkPolicies deletes all network policies owned by the desk.
+func (c *WorkshopController) deleteDeskNetworkPolicies(desk *apiv1.Desk) error {
+	policies, err := getOwnedObjects(c.networkPoliciesInformer, desk.Name)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, policy := range policies {
+		del := c.kubeClient.NetworkingV1().NetworkPolicies(policy.GetNamespace()).Delete
+		if err := c.deleteDeskObject(desk, "networkpolicy", c.networkPoliciesInformer, policy.GetNamespace(), policy.GetName(), del, nil); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	networkingv1 "k8s.io/client-go/pkg/apis/networking/v1"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+	kcache "k8s.io/client-go/tools/cache"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Name of the index of owned objects by the name of their desk.
+	deskIndex = "desk"
+)
+
+func (c *WorkshopController) setOwnedInformers() {
+	core := c.kubeClient.CoreV1()
+	rbac := c.kubeClient.RbacV1beta1()
+	extensions := c.kubeClient.ExtensionsV1beta1()
+	networking := c.kubeClient.NetworkingV1()
+
+	c.namespacesInformer = c.newOwnedInformer("namespaces", &v1.Namespace{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return core.Namespaces().List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return core.Namespaces().Watch(options)
+		})
+	c.serviceAccountsInformer = c.newOwnedInformer("serviceaccounts", &v1.ServiceAccount{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return core.ServiceAccounts(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return core.ServiceAccounts(v1.NamespaceAll).Watch(options)
+		})
+	c.rolesInformer = c.newOwnedInformer("roles", &rbacv1beta1.Role{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return rbac.Roles(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return rbac.Roles(v1.NamespaceAll).Watch(options)
+		})
+	c.roleBindingsInformer = c.newOwnedInformer("rolebindings", &rbacv1beta1.RoleBinding{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return rbac.RoleBindings(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return rbac.RoleBindings(v1.NamespaceAll).Watch(options)
+		})
+	c.deploymentsInformer = c.newOwnedInformer("deployments", &extensionsv1beta1.Deployment{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return extensions.Deployments(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return extensions.Deployments(v1.NamespaceAll).Watch(options)
+		})
+	c.servicesInformer = c.newOwnedInformer("services", &v1.Service{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return core.Services(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return core.Services(v1.NamespaceAll).Watch(options)
+		})
+	c.ingressesInformer = c.newOwnedInformer("ingresses", &extensionsv1beta1.Ingress{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return extensions.Ingresses(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return extensions.Ingresses(v1.NamespaceAll).Watch(options)
+		})
+	c.resourceQuotasInformer = c.newOwnedInformer("resourcequotas", &v1.ResourceQuota{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return core.ResourceQuotas(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return core.ResourceQuotas(v1.NamespaceAll).Watch(options)
+		})
+	c.limitRangesInformer = c.newOwnedInformer("limitranges", &v1.LimitRange{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return core.LimitRanges(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return core.LimitRanges(v1.NamespaceAll).Watch(options)
+		})
+	c.networkPoliciesInformer = c.newOwnedInformer("networkpolicies", &networkingv1.NetworkPolicy{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return networking.NetworkPolicies(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return networking.NetworkPolicies(v1.NamespaceAll).Watch(options)
+		})
+	// Only the secrets of desks are watched, rather than every secret of
+	// the cluster.
+	c.secretsInformer = c.newOwnedInformer("secrets", &v1.Secret{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = apiv1.DeskNamespaceLabel
+			return core.Secrets(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = apiv1.DeskNamespaceLabel
+			return core.Secrets(v1.NamespaceAll).Watch(options)
+		})
+	// Pods are not owned by desks, but the pods in desk namespaces report
+	// the activity in their desk, so they are also indexed by namespace.
+	c.podsInformer = c.newOwnedInformer("pods", &v1.Pod{},
+		func(options metav1.ListOptions) (runtime.Object, error) {
+			return core.Pods(v1.NamespaceAll).List(options)
+		},
+		func(options metav1.ListOptions) (watch.Interface, error) {
+			return core.Pods(v1.NamespaceAll).Watch(options)
+		})
+	if err := c.podsInformer.AddIndexers(kcache.Indexers{kcache.NamespaceIndex: kcache.MetaNamespaceIndexFunc}); err != nil {
+		glog.Errorf("Could not index pods by namespace: %s", err)
+	}
+}
+
+// ownedInformers returns the informers of all resource kinds owned by desks,
+// and of the pods in their namespaces, keyed by resource name.
+func (c *WorkshopController) ownedInformers() map[string]kcache.SharedIndexInformer {
+	return map[string]kcache.SharedIndexInformer{
+		"namespaces":      c.namespacesInformer,
+		"serviceaccounts": c.serviceAccountsInformer,
+		"roles":           c.rolesInformer,
+		"rolebindings":    c.roleBindingsInformer,
+		"deployments":     c.deploymentsInformer,
+		"services":        c.servicesInformer,
+		"ingresses":       c.ingressesInformer,
+		"resourcequotas":  c.resourceQuotasInformer,
+		"limitranges":     c.limitRangesInformer,
+		"networkpolicies": c.networkPoliciesInformer,
+		"secrets":         c.secretsInformer,
+		"pods":            c.podsInformer,
+	}
+}
+
+// newOwnedInformer returns a shared informer for a kind of resource owned by
+// desks. Every change to an owned object enqueues its owning desk, so that
+// deleted or modified objects are restored to their desired state.
+func (c *WorkshopController) newOwnedInformer(resource string, objType runtime.Object, listFunc kcache.ListFunc, watchFunc kcache.WatchFunc) kcache.SharedIndexInformer {
+	informer := kcache.NewSharedIndexInformer(
+		&kcache.ListWatch{ListFunc: listFunc, WatchFunc: watchFunc},
+		objType,
+		resyncPeriod,
+		kcache.Indexers{deskIndex: deskIndexFunc},
+	)
+	informer.AddEventHandler(kcache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			c.health.observeEvent(resource)
+			c.handleOwnedObject(obj)
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			c.health.observeEvent(resource)
+			c.handleOwnedObject(newObj)
+		},
+		DeleteFunc: func(obj interface{}) {
+			c.health.observeEvent(resource)
+			c.handleOwnedObject(obj)
+		},
+	})
+	return informer
+}
+
+func (c *WorkshopController) handleOwnedObject(obj interface{}) {
+	if tombstone, ok := obj.(kcache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		glog.Errorf("Could not get object metadata for %+v: %s", obj, err)
+		return
+	}
+	deskName, ok := deskOwnerName(object)
+	if !ok {
+		return
+	}
+	if _, exists, _ := c.desksStore.GetByKey(deskName); exists {
+		glog.V(4).Infof("Object \"%s/%s\" owned by desk \"%s\" changed", object.GetNamespace(), object.GetName(), deskName)
+		c.enqueueDeskByName(deskName)
+	}
+}
+
+// deskIndexFunc indexes objects by the name of the desk that owns them.
+func deskIndexFunc(obj interface{}) ([]string, error) {
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, err
+	}
+	if deskName, ok := deskOwnerName(object); ok {
+		return []string{deskName}, nil
+	}
+	return nil, nil
+}
+
+// getOwnedObjects returns the objects in the informer's cache that are owned
+// by the named desk, sorted by namespace and name.
+func getOwnedObjects(informer kcache.SharedIndexInformer, deskName string) ([]metav1.Object, error) {
+	objs, err := informer.GetIndexer().ByIndex(deskIndex, deskName)
+	if err != nil {
+		return nil, err
+	}
+	var objects []metav1.Object
+	for _, obj := range objs {
+		object, err := meta.Accessor(obj)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].GetNamespace() != objects[j].GetNamespace() {
+			return objects[i].GetNamespace() < objects[j].GetNamespace()
+		}
+		return objects[i].GetName() < objects[j].GetName()
+	})
+	return objects, nil
+}
+
+// getCachedObject returns the object with the given namespace and name from
+// the informer's cache.
+func getCachedObject(informer kcache.SharedIndexInformer, namespace, name string) (interface{}, bool) {
+	key := name
+	if namespace != "" {
+		key = namespace + "/" + name
+	}
+	obj, exists, err := informer.GetIndexer().GetByKey(key)
+	if err != nil || !exists {
+		return nil, false
+	}
+	return obj, true
+}
+
+func newDeskOwnerReference(desk *apiv1.Desk) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: apiv1.SchemeGroupVersion.String(),
+		Kind:       apiv1.DeskKind,
+		Name:       desk.Name,
+		UID:        desk.UID,
+	}
+}
+
+// deskOwnerName returns the name of the desk that owns object.
+func deskOwnerName(object metav1.Object) (string, bool) {
+	for _, ownerRef := range object.GetOwnerReferences() {
+		if ownerRef.Kind == apiv1.DeskKind && ownerRef.APIVersion == apiv1.SchemeGroupVersion.String() {
+			return ownerRef.Name, true
+		}
+	}
+	return "", false
+}
+
+// setDeskOwnerReference makes desk the owner of object, dropping references
+// to other desks, e.g. a previous desk with the same name. It returns whether
+// the owner references changed.
+func setDeskOwnerReference(object metav1.Object, desk *apiv1.Desk) bool {
+	ownerRef := newDeskOwnerReference(desk)
+	var ownerRefs []metav1.OwnerReference
+	found, dropped := false, false
+	for _, ref := range object.GetOwnerReferences() {
+		if ref.Kind == apiv1.DeskKind && ref.APIVersion == apiv1.SchemeGroupVersion.String() {
+			if !found && ref.Name == ownerRef.Name && ref.UID == ownerRef.UID {
+				found = true
+				ownerRefs = append(ownerRefs, ref)
+			} else {
+				dropped = true
+			}
+			continue
+		}
+		ownerRefs = append(ownerRefs, ref)
+	}
+	if !found {
+		ownerRefs = append(ownerRefs, ownerRef)
+	}
+	if found && !dropped {
+		return false
+	}
+	object.SetOwnerReferences(ownerRefs)
+	return true
+}
+
+// copyObject returns a deep copy of an object of one of the built-in kinds.
+func copyObject(obj interface{}) (interface{}, error) {
+	return scheme.Scheme.DeepCopy(obj)
+}
+
+// mergeStringMap adds the desired entries to m, keeping any other entries. It
+// returns whether m changed.
+func mergeStringMap(m *map[string]string, desired map[string]string) bool {
+	changed := false
+	for k, v := range desired {
+		if current, ok := (*m)[k]; ok && current == v {
+			continue
+		}
+		if *m == nil {
+			*m = make(map[string]string)
+		}
+		(*m)[k] = v
+		changed = true
+	}
+	return changed
+}
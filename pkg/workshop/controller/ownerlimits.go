@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"k8s.io/client-go/pkg/api/v1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// deskFootprint returns the total of the hard limits of the resource quotas
+// of the namespaces of the desk of the given class.
+func (c *WorkshopController) deskFootprint(desk *apiv1.Desk, class *apiv1.DeskClass) v1.ResourceList {
+	return c.deskResourceLimits(desk).Footprint(len(class.Spec.Namespaces))
+}
+
+// checkOwnerLimits returns an error if the desk exceeds the limits of its
+// owner. Only the active desks of the owner that were created before the desk
+// count against the limits, so that the newest desks of an owner are the
+// ones held back when the owner has too many.
+func (c *WorkshopController) checkOwnerLimits(desk *apiv1.Desk, class *apiv1.DeskClass) error {
+	if c.ownerLimits.IsZero() {
+		return nil
+	}
+
+	desks := 0
+	used := v1.ResourceList{}
+	for _, obj := range c.desksStore.List() {
+		other, ok := obj.(*apiv1.Desk)
+		if !ok || other.Name == desk.Name || other.Spec.Owner != desk.Spec.Owner || !other.IsActive() || !createdBefore(other, desk) {
+			continue
+		}
+		desks++
+		// Desks whose class cannot be resolved have no namespaces.
+		if otherClass, err := c.resolveDeskClass(other); err == nil {
+			apiv1.AddResourceLists(used, c.deskFootprint(other, otherClass))
+		}
+	}
+	return c.ownerLimits.Check(desk.Spec.Owner, desks, used, c.deskFootprint(desk, class))
+}
+
+// createdBefore returns whether desk a was created before desk b. Desks
+// created in the same second are ordered by name.
+func createdBefore(a, b *apiv1.Desk) bool {
+	if !a.CreationTimestamp.Equal(b.CreationTimestamp) {
+		return a.CreationTimestamp.Before(b.CreationTimestamp)
+	}
+	return a.Name < b.Name
+}
+
+// enqueueBlockedOwnerDesks enqueues the desks of the owner that are held back
+// by the owner limits, since they may fit once another desk of the owner is
+// gone.
+func (c *WorkshopController) enqueueBlockedOwnerDesks(owner string) {
+	for _, obj := range c.desksStore.List() {
+		desk, ok := obj.(*apiv1.Desk)
+		if !ok || desk.Spec.Owner != owner {
+			continue
+		}
+		if condition := desk.Status.Condition(apiv1.DeskConditionWithinOwnerLimits); condition != nil && condition.Status == apiv1.ConditionFalse {
+			c.enqueueDeskByName(desk.Name)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+// deskExpirationPolicy returns the expiration policy of the desk: the policy
+// the controller is configured with, overridden by the policy of the desk's
+// class and by the policy of its owner in that class. Desks whose class
+// cannot be resolved get the policy of the controller.
+func (c *WorkshopController) deskExpirationPolicy(desk *apiv1.Desk) *apiv1.DeskExpirationPolicy {
+	class, err := c.resolveDeskClass(desk)
+	if err != nil {
+		return c.expirationPolicy.DeepCopy()
+	}
+	return class.ExpirationPolicy(c.expirationPolicy, desk.Spec.Owner)
+}
+
+// setInitialDeskExpiration shortens the expiration that the desk was
+// created with to the limits of its expiration policy and accepts it. It
+// returns whether the desk changed. Desks are renewed by later extensions of
+// their accepted expiration, see applyExpirationPolicy.
+func (c *WorkshopController) setInitialDeskExpiration(desk *apiv1.Desk) bool {
+	requested := desk.Spec.ExpirationTimestamp
+	if requested.IsZero() || !desk.Status.AcceptedExpirationTimestamp.IsZero() {
+		return false
+	}
+	policy := c.deskExpirationPolicy(desk)
+	if max := policy.MaxExpiration(desk, desk.CreationTimestamp.Time); !max.IsZero() && requested.After(max) {
+		desk.Spec.ExpirationTimestamp = metav1.NewTime(max)
+		glog.V(1).Infof("Shortened expiration of desk \"%s\" from %s to %s", desk.Name, requested, desk.Spec.ExpirationTimestamp)
+	}
+	desk.Status.AcceptedExpirationTimestamp = desk.Spec.ExpirationTimestamp
+	return true
+}
+
+// applyExpirationPolicy holds changes to the accepted expiration of the desk
+// to its expiration policy. Desks may always expire earlier. Extensions are
+// renewals, which are clamped to the limits of the policy or, if the desk
+// cannot be renewed, reverted. Accepted renewals are recorded in the status
+// of the desk. It returns the possibly updated desk.
+func (c *WorkshopController) applyExpirationPolicy(desk *apiv1.Desk) (*apiv1.Desk, error) {
+	requested := desk.Spec.ExpirationTimestamp
+	accepted := desk.Status.AcceptedExpirationTimestamp
+	if requested.IsZero() || accepted.IsZero() {
+		return desk, nil
+	}
+	now := time.Now()
+	policy := c.deskExpirationPolicy(desk)
+
+	// The accepted expiration is held to the policy on every reconcile, not
+	// only when the desk is renewed, because the status of the desk can be
+	// written by clients when the webhook is not running.
+	if max := policy.MaxExpiration(desk, lastDeskRenewal(desk, now)).Truncate(time.Second); !max.IsZero() && accepted.After(max) {
+		updated := desk.DeepCopyObject().(*apiv1.Desk)
+		updated.Status.AcceptedExpirationTimestamp = metav1.NewTime(max)
+		if requested.After(max) {
+			updated.Spec.ExpirationTimestamp = updated.Status.AcceptedExpirationTimestamp
+		}
+		updated, err := c.workshopClient.WorkshopV1().Desks().Update(updated)
+		if err != nil {
+			return nil, err
+		}
+		glog.V(0).Infof("Shortened accepted expiration of desk \"%s\" from %s to %s, the latest its expiration policy allows", desk.Name, accepted, max)
+		c.recordDeskEvent(updated, v1.EventTypeWarning, deskEventExpirationShortened, "accepted expiration %s was shortened to %s by the expiration policy",
+			accepted.UTC().Format(time.RFC3339), max.UTC().Format(time.RFC3339))
+		return updated, nil
+	}
+	if requested.Equal(accepted) {
+		return desk, nil
+	}
+
+	updated := desk.DeepCopyObject().(*apiv1.Desk)
+	if requested.Before(accepted) {
+		updated.Status.AcceptedExpirationTimestamp = requested
+		return c.workshopClient.WorkshopV1().Desks().Update(updated)
+	}
+
+	expiration, err := policy.Renew(desk, requested.Time, now)
+	if err != nil {
+		updated.Spec.ExpirationTimestamp = accepted
+		setDeskCondition(&updated.Status, apiv1.DeskConditionRenewalAccepted, apiv1.ConditionFalse, "RenewalRejected",
+			fmt.Sprintf("renewal until %s was rejected: %s", requested.UTC().Format(time.RFC3339), err))
+		metrics.DeskRenewals.WithLabelValues("rejected").Inc()
+		glog.V(0).Infof("Rejected renewal of desk \"%s\" until %s: %s", desk.Name, requested, err)
+		condition := *updated.Status.Condition(apiv1.DeskConditionRenewalAccepted)
+		updated, err := c.workshopClient.WorkshopV1().Desks().Update(updated)
+		if err != nil {
+			return nil, err
+		}
+		c.recordDeskEvent(updated, v1.EventTypeWarning, condition.Reason, "%s", condition.Message)
+		return updated, nil
+	}
+
+	// Times are stored with a precision of seconds.
+	clamped := expiration.Before(requested.Time)
+	expiration = expiration.Truncate(time.Second)
+	updated.Spec.ExpirationTimestamp = metav1.NewTime(expiration)
+	updated.Status.AcceptedExpirationTimestamp = updated.Spec.ExpirationTimestamp
+	updated.Status.Renewals = append(updated.Status.Renewals, apiv1.DeskRenewal{
+		Time:                        metav1.NewTime(now.Truncate(time.Second)),
+		PreviousExpirationTimestamp: accepted,
+		ExpirationTimestamp:         updated.Spec.ExpirationTimestamp,
+		Clamped:                     clamped,
+	})
+	if clamped {
+		setDeskCondition(&updated.Status, apiv1.DeskConditionRenewalAccepted, apiv1.ConditionTrue, "RenewalClamped",
+			fmt.Sprintf("renewal until %s was shortened to %s by the expiration policy", requested.UTC().Format(time.RFC3339), expiration.UTC().Format(time.RFC3339)))
+		metrics.DeskRenewals.WithLabelValues("clamped").Inc()
+	} else {
+		setDeskCondition(&updated.Status, apiv1.DeskConditionRenewalAccepted, apiv1.ConditionTrue, "Renewed",
+			fmt.Sprintf("desk was renewed until %s", expiration.UTC().Format(time.RFC3339)))
+		metrics.DeskRenewals.WithLabelValues("renewed").Inc()
+	}
+	condition := *updated.Status.Condition(apiv1.DeskConditionRenewalAccepted)
+	updated, err = c.workshopClient.WorkshopV1().Desks().Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Renewed desk \"%s\" from %s until %s", desk.Name, accepted, updated.Spec.ExpirationTimestamp)
+	c.recordDeskEvent(updated, v1.EventTypeNormal, condition.Reason, "%s", condition.Message)
+	return updated, nil
+}
+
+// lastDeskRenewal returns the time at which the desk was last renewed, or
+// its creation time if it was never renewed. Times after now are taken as
+// now.
+func lastDeskRenewal(desk *apiv1.Desk, now time.Time) time.Time {
+	last := desk.CreationTimestamp.Time
+	for _, renewal := range desk.Status.Renewals {
+		if renewal.Time.After(last) {
+			last = renewal.Time.Time
+		}
+	}
+	if last.After(now) {
+		return now
+	}
+	return last
+}
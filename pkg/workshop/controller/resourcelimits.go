@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+const (
+	// Names of the resource quota and the limit range in each desk
+	// namespace.
+	deskResourceQuotaName = "desk-quota"
+	deskLimitRangeName    = "desk-limits"
+)
+
+// deskResourceLimits returns the resource limits of the desk's namespaces:
+// the limits the controller is configured with, overridden by the limits
+// of the desk.
+func (c *WorkshopController) deskResourceLimits(desk *apiv1.Desk) *apiv1.DeskResourceLimits {
+	return c.resourceLimits.Merge(desk.Spec.Limits)
+}
+
+func newDeskResourceQuota(desk *apiv1.Desk, limits *apiv1.DeskResourceLimits, namespace *v1.Namespace) *v1.ResourceQuota {
+	return &v1.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            deskResourceQuotaName,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Spec: v1.ResourceQuotaSpec{
+			Hard: limits.Quota,
+		},
+	}
+}
+
+func newDeskLimitRange(desk *apiv1.Desk, limits *apiv1.DeskResourceLimits, namespace *v1.Namespace) *v1.LimitRange {
+	return &v1.LimitRange{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            deskLimitRangeName,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
+		},
+		Spec: v1.LimitRangeSpec{
+			Limits: []v1.LimitRangeItem{
+				{
+					Type:           v1.LimitTypeContainer,
+					Default:        limits.DefaultLimits,
+					DefaultRequest: limits.DefaultRequests,
+					Max:            limits.MaxLimits,
+				},
+			},
+		},
+	}
+}
+
+// ensureDeskResourceLimits creates or deletes the resource quota and the
+// limit range of the namespace, depending on whether the limits call for
+// them.
+func (c *WorkshopController) ensureDeskResourceLimits(desk *apiv1.Desk, limits *apiv1.DeskResourceLimits, namespace *v1.Namespace) error {
+	if limits.HasQuota() {
+		if _, err := c.ensureDeskResourceQuota(desk, limits, namespace); err != nil {
+			return err
+		}
+	} else {
+		del := c.kubeClient.CoreV1().ResourceQuotas(namespace.Name).Delete
+		if err := c.deleteDeskObject(desk, "resourcequota", c.resourceQuotasInformer, namespace.Name, deskResourceQuotaName, del, nil); err != nil {
+			return err
+		}
+	}
+	if limits.HasLimitRange() {
+		if _, err := c.ensureDeskLimitRange(desk, limits, namespace); err != nil {
+			return err
+		}
+	} else {
+		del := c.kubeClient.CoreV1().LimitRanges(namespace.Name).Delete
+		if err := c.deleteDeskObject(desk, "limitrange", c.limitRangesInformer, namespace.Name, deskLimitRangeName, del, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureDeskResourceQuota creates the resource quota if it does not exist
+// and restores its hard limits if they were modified.
+func (c *WorkshopController) ensureDeskResourceQuota(desk *apiv1.Desk, limits *apiv1.DeskResourceLimits, namespace *v1.Namespace) (_ *v1.ResourceQuota, err error) {
+	defer metrics.ObserveReconcile("resourcequota", desk.Spec.DeskClassName, time.Now(), &err)
+
+	desired := newDeskResourceQuota(desk, limits, namespace)
+	current, err := c.getResourceQuota(namespace.Name, desired.Name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskResourceQuota(desk, desired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.ResourceQuota)
+	changed := setDeskOwnerReference(updated, desk)
+	if !equality.Semantic.DeepEqual(updated.Spec.Hard, desired.Spec.Hard) {
+		updated.Spec.Hard = desired.Spec.Hard
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	quota, err := c.kubeClient.CoreV1().ResourceQuotas(namespace.Name).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired resourcequota \"%s\" in namespace \"%s\" for desk \"%s\"", quota.Name, namespace.Name, desk.Name)
+	return quota, nil
+}
+
+func (c *WorkshopController) getResourceQuota(namespace, name string) (*v1.ResourceQuota, error) {
+	if obj, ok := getCachedObject(c.resourceQuotasInformer, namespace, name); ok {
+		return obj.(*v1.ResourceQuota), nil
+	}
+	return c.kubeClient.CoreV1().ResourceQuotas(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskResourceQuota(desk *apiv1.Desk, desired *v1.ResourceQuota) (*v1.ResourceQuota, error) {
+	quota, err := c.kubeClient.CoreV1().ResourceQuotas(desired.Namespace).Create(desired)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(1).Infof("Created resourcequota \"%s\" in namespace \"%s\" for desk \"%s\"", quota.Name, desired.Namespace, desk.Name)
+	return quota, nil
+}
+
+// ensureDeskLimitRange creates the limit range if it does not exist and
+// restores its limits if they were modified.
+func (c *WorkshopController) ensureDeskLimitRange(desk *apiv1.Desk, limits *apiv1.DeskResourceLimits, namespace *v1.Namespace) (_ *v1.LimitRange, err error) {
+	defer metrics.ObserveReconcile("limitrange", desk.Spec.DeskClassName, time.Now(), &err)
+
+	desired := newDeskLimitRange(desk, limits, namespace)
+	current, err := c.getLimitRange(namespace.Name, desired.Name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskLimitRange(desk, desired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.LimitRange)
+	changed := setDeskOwnerReference(updated, desk)
+	if !equality.Semantic.DeepEqual(updated.Spec.Limits, desired.Spec.Limits) {
+		updated.Spec.Limits = desired.Spec.Limits
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	limitRange, err := c.kubeClient.CoreV1().LimitRanges(namespace.Name).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired limitrange \"%s\" in namespace \"%s\" for desk \"%s\"", limitRange.Name, namespace.Name, desk.Name)
+	return limitRange, nil
+}
+
+func (c *WorkshopController) getLimitRange(namespace, name string) (*v1.LimitRange, error) {
+	if obj, ok := getCachedObject(c.limitRangesInformer, namespace, name); ok {
+		return obj.(*v1.LimitRange), nil
+	}
+	return c.kubeClient.CoreV1().LimitRanges(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskLimitRange(desk *apiv1.Desk, desired *v1.LimitRange) (*v1.LimitRange, error) {
+	limitRange, err := c.kubeClient.CoreV1().LimitRanges(desired.Namespace).Create(desired)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(1).Infof("Created limitrange \"%s\" in namespace \"%s\" for desk \"%s\"", limitRange.Name, desired.Namespace, desk.Name)
+	return limitRange, nil
+}
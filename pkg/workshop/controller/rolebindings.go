@@ -1,44 +1,128 @@
 package controller
 
 import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/api/v1"
 	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
 
 	"github.com/golang/glog"
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
 )
 
-func (c *WorkshopController) createDeskRoleBinding(desk *apiv1.Desk, name, role string, sa *v1.ServiceAccount, namespace *v1.Namespace) (*rbacv1beta1.RoleBinding, error) {
-	roleBinding, err := c.kubeClient.RbacV1beta1().RoleBindings(namespace.Name).Create(&rbacv1beta1.RoleBinding{
+// newDeskRoleBinding returns a rolebinding of the role to the serviceaccount
+// of the desk and to the given users and groups.
+func newDeskRoleBinding(desk *apiv1.Desk, name, role string, sa *v1.ServiceAccount, users []rbacv1beta1.Subject, namespace *v1.Namespace) *rbacv1beta1.RoleBinding {
+	return &rbacv1beta1.RoleBinding{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: apiv1.SchemeGroupVersion.String(),
-					Kind:       apiv1.DeskKind,
-					Name:       desk.Name,
-					UID:        desk.UID,
-				},
-			},
+			Name:            name,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
 		},
 		RoleRef: rbacv1beta1.RoleRef{
 			APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
 			Kind:     "ClusterRole",
 			Name:     role,
 		},
-		Subjects: []rbacv1beta1.Subject{
+		Subjects: append([]rbacv1beta1.Subject{
 			{
 				Kind:      rbacv1beta1.ServiceAccountKind,
 				Name:      sa.Name,
 				Namespace: sa.Namespace,
 			},
+		}, users...),
+	}
+}
+
+// deskUserSubjects returns the owner of the desk as a user followed by the
+// collaborators of the desk, or nil if the controller does not bind the users
+// of desks.
+func (c *WorkshopController) deskUserSubjects(desk *apiv1.Desk) []rbacv1beta1.Subject {
+	if !c.bindDeskUsers {
+		return nil
+	}
+	subjects := []rbacv1beta1.Subject{
+		{
+			Kind:     rbacv1beta1.UserKind,
+			APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
+			Name:     desk.Spec.Owner,
 		},
-	})
+	}
+	for _, collaborator := range desk.Spec.Collaborators {
+		subject := rbacv1beta1.Subject{
+			Kind:     rbacv1beta1.UserKind,
+			APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
+			Name:     collaborator.Name,
+		}
+		if collaborator.Kind == apiv1.DeskSubjectGroup {
+			subject.Kind = rbacv1beta1.GroupKind
+		}
+		subjects = append(subjects, subject)
+	}
+	return subjects
+}
+
+// ensureDeskRoleBinding creates the rolebinding if it does not exist and
+// restores its role and subjects if they were modified.
+func (c *WorkshopController) ensureDeskRoleBinding(desk *apiv1.Desk, name, role string, sa *v1.ServiceAccount, users []rbacv1beta1.Subject, namespace *v1.Namespace) (_ *rbacv1beta1.RoleBinding, err error) {
+	defer metrics.ObserveReconcile("rolebinding", desk.Spec.DeskClassName, time.Now(), &err)
+
+	desired := newDeskRoleBinding(desk, name, role, sa, users, namespace)
+	current, err := c.getRoleBinding(namespace.Name, name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskRoleBinding(desk, desired, sa)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !equality.Semantic.DeepEqual(current.RoleRef, desired.RoleRef) {
+		// The role of a rolebinding cannot be changed, so replace it.
+		if err := c.kubeClient.RbacV1beta1().RoleBindings(namespace.Name).Delete(name, nil); err != nil && !apierrors.IsNotFound(err) {
+			return nil, err
+		}
+		glog.V(0).Infof("Replacing rolebinding \"%s\" in namespace \"%s\" for desk \"%s\" with modified role \"%s\"", name, namespace.Name, desk.Name, current.RoleRef.Name)
+		return c.createDeskRoleBinding(desk, desired, sa)
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*rbacv1beta1.RoleBinding)
+	changed := setDeskOwnerReference(updated, desk)
+	if !equality.Semantic.DeepEqual(updated.Subjects, desired.Subjects) {
+		updated.Subjects = desired.Subjects
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	roleBinding, err := c.kubeClient.RbacV1beta1().RoleBindings(namespace.Name).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired rolebinding \"%s\" in namespace \"%s\" for desk \"%s\"", roleBinding.Name, namespace.Name, desk.Name)
+	return roleBinding, nil
+}
+
+func (c *WorkshopController) getRoleBinding(namespace, name string) (*rbacv1beta1.RoleBinding, error) {
+	if obj, ok := getCachedObject(c.roleBindingsInformer, namespace, name); ok {
+		return obj.(*rbacv1beta1.RoleBinding), nil
+	}
+	return c.kubeClient.RbacV1beta1().RoleBindings(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskRoleBinding(desk *apiv1.Desk, desired *rbacv1beta1.RoleBinding, sa *v1.ServiceAccount) (*rbacv1beta1.RoleBinding, error) {
+	roleBinding, err := c.kubeClient.RbacV1beta1().RoleBindings(desired.Namespace).Create(desired)
 	if err != nil {
 		return nil, err
 	}
-	glog.V(1).Infof("Created rolebinding \"%s\" for serviceaccount \"%s\" in namespace \"%s\" for desk \"%s\"", roleBinding.Name, sa.Name, namespace.Name, desk.Name)
+	glog.V(1).Infof("Created rolebinding \"%s\" for serviceaccount \"%s\" in namespace \"%s\" for desk \"%s\"", roleBinding.Name, sa.Name, desired.Namespace, desk.Name)
 
 	return roleBinding, nil
 }
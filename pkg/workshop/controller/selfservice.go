@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Name of the clusterrole and the clusterrolebinding that grant the
+	// self-service group access to desks.
+	selfServiceRBACName = "workshop-desk-self-service"
+)
+
+// newSelfServiceClusterRole returns a clusterrole that allows managing desks
+// and reading the desk classes and versions they can be created with. The
+// webhook limits which desks the self-service group can manage.
+func newSelfServiceClusterRole() *rbacv1beta1.ClusterRole {
+	return &rbacv1beta1.ClusterRole{
+		ObjectMeta: metav1.ObjectMeta{Name: selfServiceRBACName},
+		Rules: []rbacv1beta1.PolicyRule{
+			{
+				APIGroups: []string{apiv1.GroupName},
+				Resources: []string{apiv1.DeskResourcePlural},
+				Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+			},
+			{
+				APIGroups: []string{apiv1.GroupName},
+				Resources: []string{apiv1.DeskClassResourcePlural, apiv1.DeskVersionResourcePlural},
+				Verbs:     []string{"get", "list", "watch"},
+			},
+		},
+	}
+}
+
+func newSelfServiceClusterRoleBinding(group string) *rbacv1beta1.ClusterRoleBinding {
+	return &rbacv1beta1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: selfServiceRBACName},
+		RoleRef: rbacv1beta1.RoleRef{
+			APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
+			Kind:     "ClusterRole",
+			Name:     selfServiceRBACName,
+		},
+		Subjects: []rbacv1beta1.Subject{
+			{
+				Kind:     rbacv1beta1.GroupKind,
+				APIGroup: rbacv1beta1.SchemeGroupVersion.Group,
+				Name:     group,
+			},
+		},
+	}
+}
+
+// ensureSelfServiceRBAC creates the clusterrole and the clusterrolebinding
+// of the self-service group, or restores them if they were modified.
+func (c *WorkshopController) ensureSelfServiceRBAC() error {
+	roles := c.kubeClient.RbacV1beta1().ClusterRoles()
+	desiredRole := newSelfServiceClusterRole()
+	role, err := roles.Get(desiredRole.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := roles.Create(desiredRole); err != nil {
+			return err
+		}
+		glog.V(0).Infof("Created clusterrole \"%s\"", desiredRole.Name)
+	case err != nil:
+		return err
+	case !equality.Semantic.DeepEqual(role.Rules, desiredRole.Rules):
+		role.Rules = desiredRole.Rules
+		if _, err := roles.Update(role); err != nil {
+			return err
+		}
+		glog.V(0).Infof("Repaired clusterrole \"%s\"", role.Name)
+	}
+
+	bindings := c.kubeClient.RbacV1beta1().ClusterRoleBindings()
+	desiredBinding := newSelfServiceClusterRoleBinding(c.selfServiceGroup)
+	binding, err := bindings.Get(desiredBinding.Name, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		if _, err := bindings.Create(desiredBinding); err != nil {
+			return err
+		}
+		glog.V(0).Infof("Created clusterrolebinding \"%s\" for group \"%s\"", desiredBinding.Name, c.selfServiceGroup)
+	case err != nil:
+		return err
+	case !equality.Semantic.DeepEqual(binding.Subjects, desiredBinding.Subjects):
+		binding.Subjects = desiredBinding.Subjects
+		if _, err := bindings.Update(binding); err != nil {
+			return err
+		}
+		glog.V(0).Infof("Updated clusterrolebinding \"%s\" for group \"%s\"", binding.Name, c.selfServiceGroup)
+	}
+	return nil
+}
+
+// deleteSelfServiceRBAC deletes the clusterrole and the clusterrolebinding
+// of the self-service group, if they exist.
+func (c *WorkshopController) deleteSelfServiceRBAC() error {
+	var errs []error
+	if err := c.kubeClient.RbacV1beta1().ClusterRoleBindings().Delete(selfServiceRBACName, nil); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+	if err := c.kubeClient.RbacV1beta1().ClusterRoles().Delete(selfServiceRBACName, nil); err != nil && !apierrors.IsNotFound(err) {
+		errs = append(errs, err)
+	}
+	return utilerrors.NewAggregate(errs)
+}
@@ -1,27 +1,65 @@
 package controller
 
 import (
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/pkg/api/v1"
 
 	"github.com/golang/glog"
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
 )
 
-func (c *WorkshopController) createDeskServiceAccount(desk *apiv1.Desk, name string, namespace *v1.Namespace) (*v1.ServiceAccount, error) {
-	sa, err := c.kubeClient.CoreV1().ServiceAccounts(namespace.Name).Create(&v1.ServiceAccount{
+func newDeskServiceAccount(desk *apiv1.Desk, name string, namespace *v1.Namespace) *v1.ServiceAccount {
+	return &v1.ServiceAccount{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: apiv1.SchemeGroupVersion.String(),
-					Kind:       apiv1.DeskKind,
-					Name:       desk.Name,
-					UID:        desk.UID,
-				},
-			},
+			Name:            name,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
 		},
-	})
+	}
+}
+
+// ensureDeskServiceAccount creates the serviceaccount if it does not exist
+// and makes sure it is owned by the desk.
+func (c *WorkshopController) ensureDeskServiceAccount(desk *apiv1.Desk, name string, namespace *v1.Namespace) (_ *v1.ServiceAccount, err error) {
+	defer metrics.ObserveReconcile("serviceaccount", desk.Spec.DeskClassName, time.Now(), &err)
+
+	current, err := c.getServiceAccount(namespace.Name, name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskServiceAccount(desk, name, namespace)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.ServiceAccount)
+	if !setDeskOwnerReference(updated, desk) {
+		return current, nil
+	}
+	sa, err := c.kubeClient.CoreV1().ServiceAccounts(namespace.Name).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired serviceaccount \"%s\" in namespace \"%s\" for desk \"%s\"", sa.Name, namespace.Name, desk.Name)
+	return sa, nil
+}
+
+func (c *WorkshopController) getServiceAccount(namespace, name string) (*v1.ServiceAccount, error) {
+	if obj, ok := getCachedObject(c.serviceAccountsInformer, namespace, name); ok {
+		return obj.(*v1.ServiceAccount), nil
+	}
+	return c.kubeClient.CoreV1().ServiceAccounts(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskServiceAccount(desk *apiv1.Desk, name string, namespace *v1.Namespace) (*v1.ServiceAccount, error) {
+	sa, err := c.kubeClient.CoreV1().ServiceAccounts(namespace.Name).Create(newDeskServiceAccount(desk, name, namespace))
 	if err != nil {
 		return nil, err
 	}
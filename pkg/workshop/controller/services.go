@@ -1,42 +1,91 @@
 package controller
 
 import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/client-go/pkg/api/v1"
 
 	"github.com/golang/glog"
 	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
 )
 
-func (c *WorkshopController) createDeskKubeshellService(desk *apiv1.Desk, name string, namespace *v1.Namespace) (*v1.Service, error) {
+func newDeskKubeshellService(desk *apiv1.Desk, class *apiv1.DeskClass, name string, namespace *v1.Namespace) *v1.Service {
 	kubeshellLabels := map[string]string{
 		"app": name,
 	}
 
-	service, err := c.kubeClient.CoreV1().Services(namespace.Name).Create(&v1.Service{
+	return &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion: apiv1.SchemeGroupVersion.String(),
-					Kind:       apiv1.DeskKind,
-					Name:       desk.Name,
-					UID:        desk.UID,
-				},
-			},
+			Name:            name,
+			Namespace:       namespace.Name,
+			OwnerReferences: []metav1.OwnerReference{newDeskOwnerReference(desk)},
 		},
 		Spec: v1.ServiceSpec{
 			Selector: kubeshellLabels,
 			Ports: []v1.ServicePort{
-				{Protocol: v1.ProtocolTCP, Port: 4200, TargetPort: intstr.FromInt(4200)},
+				{Protocol: v1.ProtocolTCP, Port: class.Spec.Shell.Port, TargetPort: intstr.FromInt(int(class.Spec.Shell.Port))},
 			},
 		},
-	})
+	}
+}
+
+// ensureDeskKubeshellService creates the kubeshell service if it does not
+// exist and restores its selector and ports if they were modified.
+func (c *WorkshopController) ensureDeskKubeshellService(desk *apiv1.Desk, class *apiv1.DeskClass, name string, namespace *v1.Namespace) (_ *v1.Service, err error) {
+	defer metrics.ObserveReconcile("service", desk.Spec.DeskClassName, time.Now(), &err)
+
+	desired := newDeskKubeshellService(desk, class, name, namespace)
+	current, err := c.getService(namespace.Name, name)
+	if apierrors.IsNotFound(err) {
+		return c.createDeskService(desk, desired)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := copyObject(current)
+	if err != nil {
+		return nil, err
+	}
+	updated := obj.(*v1.Service)
+	changed := setDeskOwnerReference(updated, desk)
+	if !equality.Semantic.DeepEqual(updated.Spec.Selector, desired.Spec.Selector) {
+		updated.Spec.Selector = desired.Spec.Selector
+		changed = true
+	}
+	if !equality.Semantic.DeepEqual(updated.Spec.Ports, desired.Spec.Ports) {
+		updated.Spec.Ports = desired.Spec.Ports
+		changed = true
+	}
+	if !changed {
+		return current, nil
+	}
+	service, err := c.kubeClient.CoreV1().Services(namespace.Name).Update(updated)
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Repaired service \"%s\" in namespace \"%s\" for desk \"%s\"", service.Name, namespace.Name, desk.Name)
+	return service, nil
+}
+
+func (c *WorkshopController) getService(namespace, name string) (*v1.Service, error) {
+	if obj, ok := getCachedObject(c.servicesInformer, namespace, name); ok {
+		return obj.(*v1.Service), nil
+	}
+	return c.kubeClient.CoreV1().Services(namespace).Get(name, metav1.GetOptions{})
+}
+
+func (c *WorkshopController) createDeskService(desk *apiv1.Desk, desired *v1.Service) (*v1.Service, error) {
+	service, err := c.kubeClient.CoreV1().Services(desired.Namespace).Create(desired)
 	if err != nil {
 		return nil, err
 	}
-	glog.V(1).Infof("Created service \"%s\" in namespace \"%s\" for desk \"%s\"", service.Name, namespace.Name, desk.Name)
+	glog.V(1).Infof("Created service \"%s\" in namespace \"%s\" for desk \"%s\"", service.Name, desired.Namespace, desk.Name)
 
 	return service, nil
 }
@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/workshop/metrics"
+)
+
+// deskConditionTypes lists the conditions that must all be true for a desk
+// to be ready, in the order in which they are reported.
+var deskConditionTypes = []apiv1.DeskConditionType{
+	apiv1.DeskConditionClassResolved,
+	apiv1.DeskConditionVersionResolved,
+	apiv1.DeskConditionWithinOwnerLimits,
+	apiv1.DeskConditionNamespacesReady,
+	apiv1.DeskConditionResourceLimitsReady,
+	apiv1.DeskConditionNetworkIsolated,
+	apiv1.DeskConditionRBACReady,
+	apiv1.DeskConditionKubeconfigReady,
+	apiv1.DeskConditionShellDeploymentAvailable,
+	apiv1.DeskConditionIngressReady,
+	apiv1.DeskConditionManifestsCreated,
+}
+
+// deskFailureConditionTypes lists the conditions that fail the desk when they
+// are false, since the desk cannot become ready until the desk, its class or
+// its version is changed.
+var deskFailureConditionTypes = []apiv1.DeskConditionType{
+	apiv1.DeskConditionClassResolved,
+	apiv1.DeskConditionVersionResolved,
+}
+
+// setDeskCondition adds or updates the condition of the given type. The
+// transition time is only changed when the status of the condition changes.
+func setDeskCondition(status *apiv1.DeskStatus, t apiv1.DeskConditionType, conditionStatus apiv1.ConditionStatus, reason, message string) {
+	condition := status.Condition(t)
+	if condition == nil {
+		status.Conditions = append(status.Conditions, apiv1.DeskCondition{Type: t})
+		condition = &status.Conditions[len(status.Conditions)-1]
+	}
+	if condition.Status != conditionStatus {
+		condition.Status = conditionStatus
+		condition.LastTransitionTime = metav1.Now()
+	}
+	condition.Reason = reason
+	condition.Message = message
+}
+
+// setPendingDeskConditions marks every condition that comes after the failed
+// condition and is not true as unknown, since it cannot be checked until the
+// failed condition is true.
+func setPendingDeskConditions(status *apiv1.DeskStatus, failed apiv1.DeskConditionType, reason, message string) {
+	pending := false
+	for _, t := range deskConditionTypes {
+		if !pending {
+			pending = t == failed
+			continue
+		}
+		if condition := status.Condition(t); condition == nil || condition.Status != apiv1.ConditionTrue {
+			setDeskCondition(status, t, apiv1.ConditionUnknown, reason, message)
+		}
+	}
+}
+
+// setDeskState derives the desk state and message from its conditions.
+// Expired and Terminating desks keep their state, and suspended desks are
+// Suspended unless they failed.
+func setDeskState(status *apiv1.DeskStatus, suspended bool) {
+	if status.State == apiv1.DeskStateExpired || status.State == apiv1.DeskStateTerminating {
+		return
+	}
+	for _, t := range deskFailureConditionTypes {
+		if condition := status.Condition(t); condition != nil && condition.Status == apiv1.ConditionFalse {
+			status.State = apiv1.DeskStateFailed
+			status.Message = condition.Message
+			return
+		}
+	}
+	if suspended {
+		status.State = apiv1.DeskStateSuspended
+		status.Message = "Desk is suspended"
+		return
+	}
+
+	var notReady []string
+	for _, t := range deskConditionTypes {
+		condition := status.Condition(t)
+		if condition == nil {
+			notReady = append(notReady, string(t))
+		} else if condition.Status != apiv1.ConditionTrue {
+			notReady = append(notReady, fmt.Sprintf("%s (%s)", t, condition.Message))
+		}
+	}
+
+	if len(notReady) == 0 {
+		status.State = apiv1.DeskStateReady
+		status.Message = "All desk resources are ready"
+		return
+	}
+	status.State = apiv1.DeskStateInitializing
+	status.Message = fmt.Sprintf("Waiting for %s", strings.Join(notReady, ", "))
+}
+
+// updateDeskStatus writes status to the desk if it differs from the desk's
+// current status. The first time a desk is ready is recorded, so that the
+// time to ready is only observed once per desk and not again when the desk
+// is resumed or recovers.
+func (c *WorkshopController) updateDeskStatus(desk *apiv1.Desk, status apiv1.DeskStatus) error {
+	if status.State == apiv1.DeskStateReady && status.FirstReadyTime.IsZero() {
+		status.FirstReadyTime = metav1.Now()
+	}
+	if equality.Semantic.DeepEqual(desk.Status, status) {
+		return nil
+	}
+
+	updated := desk.DeepCopyObject().(*apiv1.Desk)
+	updated.Status = status
+	if _, err := c.workshopClient.WorkshopV1().Desks().Update(updated); err != nil {
+		return err
+	}
+	if desk.Status.State != status.State {
+		glog.V(0).Infof("Desk \"%s\" is now %s: %s", desk.Name, status.State, status.Message)
+		c.recordDeskStateEvent(desk, status)
+		if status.State == apiv1.DeskStateReady && desk.Status.FirstReadyTime.IsZero() {
+			metrics.DeskTimeToReady.WithLabelValues(desk.Spec.DeskClassName).Observe(time.Since(desk.CreationTimestamp.Time).Seconds())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// syncDeskWorkloads scales the deployments and statefulsets in the namespace
+// to zero while the desk is suspended and back to their previous replica
+// counts once it is resumed. The kubeshell deployment is left alone, since
+// it is reconciled with the rest of the desk.
+func (c *WorkshopController) syncDeskWorkloads(desk *apiv1.Desk, namespace *v1.Namespace, kubeshellName string) error {
+	var errs []error
+
+	deployments, err := c.kubeClient.ExtensionsV1beta1().Deployments(namespace.Name).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		deployment := &deployments.Items[i]
+		if owner, ok := deskOwnerName(deployment); ok && owner == desk.Name && deployment.Name == kubeshellName {
+			continue
+		}
+		changed, err := setSuspendedReplicas(deployment, &deployment.Spec.Replicas, desk.Spec.Suspended)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("deployment \"%s\": %s", deployment.Name, err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if _, err := c.kubeClient.ExtensionsV1beta1().Deployments(namespace.Name).Update(deployment); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		glog.V(1).Infof("Scaled deployment \"%s\" in namespace \"%s\" of desk \"%s\" to %d replicas", deployment.Name, namespace.Name, desk.Name, *deployment.Spec.Replicas)
+	}
+
+	statefulSets, err := c.kubeClient.AppsV1beta1().StatefulSets(namespace.Name).List(metav1.ListOptions{})
+	if err != nil {
+		return utilerrors.NewAggregate(append(errs, err))
+	}
+	for i := range statefulSets.Items {
+		statefulSet := &statefulSets.Items[i]
+		changed, err := setSuspendedReplicas(statefulSet, &statefulSet.Spec.Replicas, desk.Spec.Suspended)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("statefulset \"%s\": %s", statefulSet.Name, err))
+			continue
+		}
+		if !changed {
+			continue
+		}
+		if _, err := c.kubeClient.AppsV1beta1().StatefulSets(namespace.Name).Update(statefulSet); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		glog.V(1).Infof("Scaled statefulset \"%s\" in namespace \"%s\" of desk \"%s\" to %d replicas", statefulSet.Name, namespace.Name, desk.Name, *statefulSet.Spec.Replicas)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// setSuspendedReplicas scales a workload to zero and records its replica
+// count in an annotation if suspended is true, and restores the recorded
+// replica count otherwise. Workloads that were scaled to zero before the
+// desk was suspended are left at zero. It returns whether the workload
+// changed.
+func setSuspendedReplicas(object metav1.Object, replicas **int32, suspended bool) (bool, error) {
+	annotations := object.GetAnnotations()
+	recorded, isSuspended := annotations[apiv1.DeskSuspendedReplicasAnnotation]
+
+	if suspended {
+		// Unset replicas default to one.
+		current := int32(1)
+		if *replicas != nil {
+			current = **replicas
+		}
+		if current == 0 {
+			return false, nil
+		}
+		if !isSuspended {
+			if annotations == nil {
+				annotations = make(map[string]string)
+			}
+			annotations[apiv1.DeskSuspendedReplicasAnnotation] = strconv.Itoa(int(current))
+			object.SetAnnotations(annotations)
+		}
+		zero := int32(0)
+		*replicas = &zero
+		return true, nil
+	}
+
+	if !isSuspended {
+		return false, nil
+	}
+	n, err := strconv.ParseInt(recorded, 10, 32)
+	if err != nil {
+		return false, fmt.Errorf("invalid annotation %s=%q: %s", apiv1.DeskSuspendedReplicasAnnotation, recorded, err)
+	}
+	restored := int32(n)
+	*replicas = &restored
+	delete(annotations, apiv1.DeskSuspendedReplicasAnnotation)
+	object.SetAnnotations(annotations)
+	return true, nil
+}
@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/pkg/api/v1"
+	kcache "k8s.io/client-go/tools/cache"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+func hasDeskFinalizer(desk *apiv1.Desk) bool {
+	for _, finalizer := range desk.Finalizers {
+		if finalizer == apiv1.DeskFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeDeskFinalizer(desk *apiv1.Desk) {
+	var finalizers []string
+	for _, finalizer := range desk.Finalizers {
+		if finalizer != apiv1.DeskFinalizer {
+			finalizers = append(finalizers, finalizer)
+		}
+	}
+	desk.Finalizers = finalizers
+}
+
+// teardownDesk deletes the resources of a desk that is being deleted, in the
+// reverse order of their creation. The desk finalizer is removed, and with
+// it the desk, once all of its namespaces have terminated. Until then the
+// desk is reported as terminating.
+func (c *WorkshopController) teardownDesk(desk *apiv1.Desk) error {
+	if !hasDeskFinalizer(desk) {
+		return nil
+	}
+
+	updated := desk.DeepCopyObject().(*apiv1.Desk)
+	updated.Status.State = apiv1.DeskStateTerminating
+
+	waiting, err := c.deleteDeskResources(desk)
+	switch {
+	case err != nil:
+		updated.Status.Message = fmt.Sprintf("Could not tear down desk resources: %s", err)
+	case waiting != "":
+		updated.Status.Message = fmt.Sprintf("Waiting for %s", waiting)
+	default:
+		updated.Status.Message = "All desk resources are deleted"
+		removeDeskFinalizer(updated)
+	}
+
+	if desk.Status.State != updated.Status.State || desk.Status.Message != updated.Status.Message || !hasDeskFinalizer(updated) {
+		if _, updateErr := c.workshopClient.WorkshopV1().Desks().Update(updated); updateErr != nil {
+			return utilerrors.NewAggregate([]error{err, updateErr})
+		}
+		if desk.Status.State != updated.Status.State {
+			glog.V(0).Infof("Desk \"%s\" is now %s: %s", desk.Name, updated.Status.State, updated.Status.Message)
+			c.recordDeskStateEvent(desk, updated.Status)
+		}
+	}
+	switch {
+	case err != nil && desk.Status.Message != updated.Status.Message:
+		c.recordDeskEvent(desk, v1.EventTypeWarning, deskEventTeardownFailed, "%s", updated.Status.Message)
+	case err == nil && waiting == "":
+		glog.V(0).Infof("Removed finalizer from desk \"%s\" after deleting its resources", desk.Name)
+		c.recordDeskEvent(desk, v1.EventTypeNormal, deskEventTornDown, "%s", updated.Status.Message)
+	}
+	return err
+}
+
+// deleteDeskResources deletes the resources of the desk in stages: first the
+// ingresses, which cut off access to the desk, then the shell, then its RBAC
+// and finally the namespaces. A stage is only started once the objects of
+// the previous stage are gone from the informer caches; until then it
+// returns what the teardown is waiting for, and the deletion of the objects
+// requeues the desk. The resources are found by their owner, so that desks
+// are torn down even if their desk class changed or no longer exists.
+func (c *WorkshopController) deleteDeskResources(desk *apiv1.Desk) (string, error) {
+	glog.V(1).Infof("Deleting resources for desk \"%s\"", desk.Name)
+
+	core := c.kubeClient.CoreV1()
+	rbac := c.kubeClient.RbacV1beta1()
+	extensions := c.kubeClient.ExtensionsV1beta1()
+	propagation := metav1.DeletePropagationBackground
+	options := &metav1.DeleteOptions{PropagationPolicy: &propagation}
+
+	type deleter struct {
+		kind     string
+		informer kcache.SharedIndexInformer
+		del      func(namespace string) func(string, *metav1.DeleteOptions) error
+	}
+	stages := []struct {
+		name     string
+		deleters []deleter
+	}{
+		{"ingress", []deleter{
+			{"ingress", c.ingressesInformer, func(ns string) func(string, *metav1.DeleteOptions) error { return extensions.Ingresses(ns).Delete }},
+		}},
+		{"shell", []deleter{
+			{"service", c.servicesInformer, func(ns string) func(string, *metav1.DeleteOptions) error { return core.Services(ns).Delete }},
+			{"deployment", c.deploymentsInformer, func(ns string) func(string, *metav1.DeleteOptions) error { return extensions.Deployments(ns).Delete }},
+		}},
+		{"RBAC", []deleter{
+			{"role", c.rolesInformer, func(ns string) func(string, *metav1.DeleteOptions) error { return rbac.Roles(ns).Delete }},
+			{"rolebinding", c.roleBindingsInformer, func(ns string) func(string, *metav1.DeleteOptions) error { return rbac.RoleBindings(ns).Delete }},
+			{"serviceaccount", c.serviceAccountsInformer, func(ns string) func(string, *metav1.DeleteOptions) error { return core.ServiceAccounts(ns).Delete }},
+		}},
+	}
+	for _, stage := range stages {
+		var errs, remaining []string
+		for _, d := range stage.deleters {
+			objects, err := getOwnedObjects(d.informer, desk.Name)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			for _, object := range objects {
+				remaining = append(remaining, fmt.Sprintf("%s \"%s/%s\"", d.kind, object.GetNamespace(), object.GetName()))
+				if object.GetDeletionTimestamp() != nil {
+					continue
+				}
+				if err := c.deleteDeskObject(desk, d.kind, d.informer, object.GetNamespace(), object.GetName(), d.del(object.GetNamespace()), options); err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+		}
+		if len(errs) > 0 {
+			return "", fmt.Errorf("could not delete %s: %s", stage.name, strings.Join(errs, "; "))
+		}
+		if len(remaining) > 0 {
+			return fmt.Sprintf("%s to be deleted: %s", stage.name, strings.Join(remaining, ", ")), nil
+		}
+	}
+
+	namespaces, err := getOwnedObjects(c.namespacesInformer, desk.Name)
+	if err != nil {
+		return "", err
+	}
+	var remaining []string
+	for _, object := range namespaces {
+		namespace := object.(*v1.Namespace)
+		remaining = append(remaining, namespace.Name)
+		if namespace.Status.Phase == v1.NamespaceTerminating {
+			continue
+		}
+		if err := c.deleteDeskNamespace(desk.Name, namespace.Name); err != nil && !apierrors.IsNotFound(err) {
+			return "", fmt.Errorf("could not delete namespace \"%s\": %s", namespace.Name, err)
+		}
+	}
+	if len(remaining) > 0 {
+		return fmt.Sprintf("namespaces %s to terminate", strings.Join(remaining, ", ")), nil
+	}
+	return "", nil
+}
+
+// deleteDeskObject deletes the named object if it is in the informer cache.
+func (c *WorkshopController) deleteDeskObject(desk *apiv1.Desk, kind string, informer kcache.SharedIndexInformer, namespace, name string, del func(string, *metav1.DeleteOptions) error, options *metav1.DeleteOptions) error {
+	if _, ok := getCachedObject(informer, namespace, name); !ok {
+		return nil
+	}
+	if err := del(name, options); err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("%s \"%s/%s\": %s", kind, namespace, name, err)
+	}
+	glog.V(1).Infof("Deleted %s \"%s\" in namespace \"%s\" for desk \"%s\"", kind, name, namespace, desk.Name)
+	return nil
+}
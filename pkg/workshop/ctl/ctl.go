@@ -3,14 +3,18 @@ package ctl
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/urfave/cli"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
@@ -18,7 +22,15 @@ import (
 	"github.com/joelanford/workshop/pkg/client/workshop"
 )
 
+const (
+	// Time that renew waits for the controller to apply the expiration
+	// policy of the desk to the renewal.
+	renewalTimeout = 10 * time.Second
+)
+
 type WorkshopctlCommand struct {
+	config         *rest.Config
+	kubeClient     kubernetes.Interface
 	workshopClient workshop.Interface
 }
 
@@ -49,6 +61,11 @@ func (c *WorkshopctlCommand) Initialize(kubeconfig string) error {
 		}
 	}
 
+	c.config = config
+	c.kubeClient, err = kubernetes.NewForConfig(config)
+	if err != nil {
+		return err
+	}
 	c.workshopClient, err = workshop.NewForConfig(config)
 	return err
 }
@@ -59,29 +76,44 @@ func (c *WorkshopctlCommand) CreateDesk(ctx *cli.Context) error {
 	}
 	name := ctx.Args()[0]
 
-	owner := name
+	owner := ctx.String("owner")
+	if owner == "" {
+		owner = name
+	}
 	version := ctx.String("version")
 	if version == "" {
 		version = apiv1.DeskDefaultVersion
 	}
 
-	expirationDurationStr := ctx.String("expiration")
-	expirationDuration, err := time.ParseDuration(expirationDurationStr)
+	expiration, err := createExpiration(ctx, time.Now())
 	if err != nil {
-		expirationDuration = apiv1.DeskMaxLifespan
+		return err
 	}
-	expiration := time.Now().Add(expirationDuration)
 
-	desk, err := c.workshopClient.WorkshopV1().Desks().Create(&apiv1.Desk{
+	desk := &apiv1.Desk{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: name,
 		},
 		Spec: apiv1.DeskSpec{
-			Owner:               owner,
-			Version:             version,
-			ExpirationTimestamp: metav1.NewTime(expiration),
+			Owner:         owner,
+			Version:       version,
+			DeskClassName: ctx.String("class"),
+
+			DisableNetworkIsolation: ctx.Bool("disable-network-isolation"),
+			ExpirationTimestamp:     metav1.NewTime(expiration),
 		},
-	})
+	}
+	for _, user := range ctx.StringSlice("collaborator") {
+		desk.Spec.Collaborators = append(desk.Spec.Collaborators, apiv1.DeskSubject{Kind: apiv1.DeskSubjectUser, Name: user})
+	}
+	for _, group := range ctx.StringSlice("collaborator-group") {
+		desk.Spec.Collaborators = append(desk.Spec.Collaborators, apiv1.DeskSubject{Kind: apiv1.DeskSubjectGroup, Name: group})
+	}
+	if err := apiv1.ValidateDesk(desk); err != nil {
+		return fmt.Errorf("invalid desk \"%s\": %s", name, err)
+	}
+
+	desk, err = c.workshopClient.WorkshopV1().Desks().Create(desk)
 	if err != nil {
 		return err
 	}
@@ -89,9 +121,50 @@ func (c *WorkshopctlCommand) CreateDesk(ctx *cli.Context) error {
 	return nil
 }
 
+// createExpiration returns the expiration of a new desk given by the
+// --expires-at or the --expiration option.
+func createExpiration(ctx *cli.Context, now time.Time) (time.Time, error) {
+	if ctx.IsSet("expires-at") {
+		if ctx.IsSet("expiration") {
+			return time.Time{}, errors.New("--expiration and --expires-at are mutually exclusive")
+		}
+		return parseExpirationTime("--expires-at", ctx.String("expires-at"), now)
+	}
+	duration, err := apiv1.ParseDuration(ctx.String("expiration"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --expiration: %s", err)
+	}
+	return now.Add(duration), nil
+}
+
+// parseExpirationTime parses the RFC 3339 time of the option, which must be
+// in the future.
+func parseExpirationTime(option, value string, now time.Time) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: %s", option, err)
+	}
+	if !t.After(now) {
+		return time.Time{}, fmt.Errorf("invalid %s: %s is not in the future", option, value)
+	}
+	return t, nil
+}
+
+// GetDesk lists the desks, or gets the desk with the given name, in the
+// format of the --output option, sorted by the --sort-by field. With --watch
+// or --watch-only, changes of the desks are printed as they happen.
 func (c *WorkshopctlCommand) GetDesk(ctx *cli.Context) error {
+	printer, err := newDeskPrinter(ctx.String("output"), ctx.String("sort-by"), time.Now())
+	if err != nil {
+		return err
+	}
+	if ctx.Bool("watch") || ctx.Bool("watch-only") {
+		return c.watchDesks(os.Stdout, printer, ctx.Args().First(), ctx.Bool("watch-only"))
+	}
+
 	var desks []apiv1.Desk
-	if ctx.NArg() == 0 {
+	list := ctx.NArg() == 0
+	if list {
 		deskList, err := c.workshopClient.WorkshopV1().Desks().List(metav1.ListOptions{})
 		if err != nil {
 			return err
@@ -106,39 +179,267 @@ func (c *WorkshopctlCommand) GetDesk(ctx *cli.Context) error {
 		desks = append(desks, *desk)
 	}
 
-	if len(desks) == 0 {
+	if len(desks) == 0 && (printer.format == "" || printer.format == "wide") {
+		fmt.Fprintf(os.Stdout, "No resources found.\n")
+		return nil
+	}
+	return printer.print(os.Stdout, desks, list)
+}
+
+func (c *WorkshopctlCommand) GetDeskVersion(ctx *cli.Context) error {
+	var versions []apiv1.DeskVersion
+	if ctx.NArg() == 0 {
+		versionList, err := c.workshopClient.WorkshopV1().DeskVersions().List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		versions = versionList.Items
+	} else {
+		name := ctx.Args()[0]
+		version, err := c.workshopClient.WorkshopV1().DeskVersions().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		versions = append(versions, *version)
+	}
+
+	if len(versions) == 0 {
+		fmt.Fprintf(os.Stdout, "No resources found.\n")
+		return nil
+	}
+
+	var w tabwriter.Writer
+	w.Init(os.Stdout, 0, 4, 6, ' ', 0)
+	fmt.Fprintln(&w, "NAME\tIMAGE\tKUBECTL\tDESCRIPTION")
+	for _, version := range versions {
+		fmt.Fprintf(&w, "%s\t%s\t%s\t%s\n", version.ObjectMeta.Name, version.Spec.Image, version.Spec.KubectlVersion, version.Spec.Description)
+	}
+	return w.Flush()
+}
+
+func (c *WorkshopctlCommand) GetDeskClass(ctx *cli.Context) error {
+	var classes []apiv1.DeskClass
+	if ctx.NArg() == 0 {
+		classList, err := c.workshopClient.WorkshopV1().DeskClasses().List(metav1.ListOptions{})
+		if err != nil {
+			return err
+		}
+		classes = classList.Items
+	} else {
+		name := ctx.Args()[0]
+		class, err := c.workshopClient.WorkshopV1().DeskClasses().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		classes = append(classes, *class)
+	}
+
+	if len(classes) == 0 {
 		fmt.Fprintf(os.Stdout, "No resources found.\n")
 		return nil
 	}
 
 	var w tabwriter.Writer
 	w.Init(os.Stdout, 0, 4, 6, ' ', 0)
-	fmt.Fprintln(&w, "NAME\tOWNER\tVERSION\tEXPIRATION")
-	for _, desk := range desks {
-		fmt.Fprintf(&w, "%s\t%s\t%s\t%s\n", desk.ObjectMeta.Name, desk.Spec.Owner, desk.Spec.Version, desk.Spec.ExpirationTimestamp)
+	fmt.Fprintln(&w, "NAME\tDEFAULT\tNAMESPACES\tDESCRIPTION")
+	for _, class := range classes {
+		var namespaces []string
+		for _, namespace := range class.Spec.Namespaces {
+			namespaces = append(namespaces, namespace.Name)
+		}
+		fmt.Fprintf(&w, "%s\t%t\t%s\t%s\n", class.ObjectMeta.Name, class.IsDefault(), strings.Join(namespaces, ","), class.Spec.Description)
 	}
 	return w.Flush()
 }
 
 func (c *WorkshopctlCommand) DeleteDesk(ctx *cli.Context) error {
-	var names []string
+	names, err := c.selectDeskNames(ctx)
+	if err != nil {
+		return err
+	}
+	c.deleteDesksByName(names)
+	return nil
+}
 
-	if ctx.IsSet("all") {
-		deskList, err := c.workshopClient.WorkshopV1().Desks().List(metav1.ListOptions{})
+func (c *WorkshopctlCommand) SuspendDesk(ctx *cli.Context) error {
+	return c.setDesksSuspended(ctx, true)
+}
+
+func (c *WorkshopctlCommand) ResumeDesk(ctx *cli.Context) error {
+	return c.setDesksSuspended(ctx, false)
+}
+
+// RenewDesk extends the expiration of the desk by the duration of the --by
+// option or to the time of the --until option, and waits for the controller
+// to apply the expiration policy of the desk to the renewal.
+func (c *WorkshopctlCommand) RenewDesk(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("NAME is required")
+	}
+	name := ctx.Args()[0]
+	if ctx.IsSet("by") == ctx.IsSet("until") {
+		return errors.New("exactly one of --by and --until is required")
+	}
+
+	desk, err := c.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	current := desk.Spec.ExpirationTimestamp
+	var expiration time.Time
+	if ctx.IsSet("by") {
+		duration, err := apiv1.ParseDuration(ctx.String("by"))
+		if err != nil {
+			return fmt.Errorf("invalid --by: %s", err)
+		}
+		expiration = current.Add(duration)
+	} else {
+		expiration, err = parseExpirationTime("--until", ctx.String("until"), now)
 		if err != nil {
 			return err
 		}
+	}
+	if !expiration.After(current.Time) {
+		return fmt.Errorf("desk \"%s\" already expires at %s", name, current.UTC().Format(time.RFC3339))
+	}
+
+	previous := desk.Status.AcceptedExpirationTimestamp
+	desk.Spec.ExpirationTimestamp = metav1.NewTime(expiration)
+	desk, err = c.workshopClient.WorkshopV1().Desks().Update(desk)
+	if err != nil {
+		return err
+	}
 
-		for _, desk := range deskList.Items {
-			name := desk.Name
-			names = append(names, name)
+	// The controller accepts the renewal, shortens it to the limits of the
+	// expiration policy or rejects it by restoring the previous expiration.
+	requested := desk.Spec.ExpirationTimestamp
+	resourceVersion := desk.ResourceVersion
+	err = wait.Poll(500*time.Millisecond, renewalTimeout, func() (bool, error) {
+		desk, err = c.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
 		}
-	} else if ctx.NArg() > 0 {
-		names = ctx.Args()
-	} else {
-		return errors.New("NAME or --all option is required")
+		return desk.ResourceVersion != resourceVersion && desk.Spec.ExpirationTimestamp.Equal(desk.Status.AcceptedExpirationTimestamp), nil
+	})
+	if err == wait.ErrWaitTimeout {
+		fmt.Printf("desk \"%s\" renewal until %s requested\n", name, requested.UTC().Format(time.RFC3339))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	accepted := desk.Status.AcceptedExpirationTimestamp
+	switch {
+	case accepted.Equal(previous):
+		message := "rejected by the expiration policy"
+		if condition := desk.Status.Condition(apiv1.DeskConditionRenewalAccepted); condition != nil {
+			message = condition.Message
+		}
+		return fmt.Errorf("desk \"%s\" was not renewed: %s", name, message)
+	case accepted.Before(requested):
+		fmt.Printf("desk \"%s\" renewed until %s, the latest expiration its expiration policy allows\n", name, accepted.UTC().Format(time.RFC3339))
+	default:
+		fmt.Printf("desk \"%s\" renewed until %s\n", name, accepted.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// KubeconfigDesk prints the kubeconfig that the controller published for the
+// desk, or writes it to the file given by the --output option.
+func (c *WorkshopctlCommand) KubeconfigDesk(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("NAME is required")
+	}
+	name := ctx.Args()[0]
+	desk, err := c.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	ref := desk.Status.KubeconfigSecret
+	if ref == nil {
+		message := "it is not published yet"
+		if condition := desk.Status.Condition(apiv1.DeskConditionKubeconfigReady); condition != nil {
+			message = condition.Message
+		}
+		return fmt.Errorf("desk \"%s\" has no kubeconfig: %s", name, message)
+	}
+	secret, err := c.kubeClient.CoreV1().Secrets(ref.Namespace).Get(ref.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	kubeconfig, ok := secret.Data[apiv1.DeskKubeconfigSecretKey]
+	if !ok {
+		return fmt.Errorf("secret \"%s/%s\" of desk \"%s\" has no kubeconfig", ref.Namespace, ref.Name, name)
+	}
+
+	output := ctx.String("output")
+	if output == "" {
+		_, err := os.Stdout.Write(kubeconfig)
+		return err
+	}
+	// The kubeconfig holds the token of the desk.
+	if err := ioutil.WriteFile(output, kubeconfig, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("kubeconfig of desk \"%s\" written to %s\n", name, output)
+	return nil
+}
+
+// selectDeskNames returns the names of the desks given as arguments, of the
+// desks matching the --selector option or of all desks with the --all
+// option.
+func (c *WorkshopctlCommand) selectDeskNames(ctx *cli.Context) ([]string, error) {
+	if ctx.NArg() > 0 {
+		return ctx.Args(), nil
+	}
+	if !ctx.IsSet("all") && !ctx.IsSet("selector") {
+		return nil, errors.New("NAME, --selector or --all option is required")
+	}
+
+	deskList, err := c.workshopClient.WorkshopV1().Desks().List(metav1.ListOptions{LabelSelector: ctx.String("selector")})
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, desk := range deskList.Items {
+		names = append(names, desk.Name)
+	}
+	return names, nil
+}
+
+func (c *WorkshopctlCommand) setDesksSuspended(ctx *cli.Context, suspended bool) error {
+	names, err := c.selectDeskNames(ctx)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		fmt.Println("No resources found.")
+		return nil
+	}
+
+	verb := "resumed"
+	if suspended {
+		verb = "suspended"
+	}
+	for _, name := range names {
+		desk, err := c.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		if desk.Spec.Suspended == suspended {
+			fmt.Printf("desk \"%s\" is already %s\n", name, verb)
+			continue
+		}
+		desk.Spec.Suspended = suspended
+		if _, err := c.workshopClient.WorkshopV1().Desks().Update(desk); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		fmt.Printf("desk \"%s\" %s\n", name, verb)
 	}
-	c.deleteDesksByName(names)
 	return nil
 }
 
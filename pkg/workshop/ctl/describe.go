@@ -0,0 +1,405 @@
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+	rbacv1beta1 "k8s.io/client-go/pkg/apis/rbac/v1beta1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// Number of the most recent events that describe desk shows. Busy
+// namespaces can have a lot of events, most of them stale.
+const describedEventCount = 20
+
+// DescribeDesk shows the spec and status of the desk, the resources that the
+// controller built for it and the recent events of the desk and of the
+// resources in its namespaces.
+func (c *WorkshopctlCommand) DescribeDesk(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("NAME is required")
+	}
+	name := ctx.Args()[0]
+	desk, err := c.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	return c.describeDesk(os.Stdout, desk, time.Now())
+}
+
+// deskResources are the resources that are owned by a desk, found by the
+// owner references that the controller sets on them.
+type deskResources struct {
+	namespaces      []v1.Namespace
+	serviceAccounts []v1.ServiceAccount
+	roleBindings    []rbacv1beta1.RoleBinding
+	deployments     []extensionsv1beta1.Deployment
+	pods            []v1.Pod
+	services        []v1.Service
+	ingresses       []extensionsv1beta1.Ingress
+	resourceQuotas  []v1.ResourceQuota
+	events          []v1.Event
+}
+
+func (c *WorkshopctlCommand) describeDesk(out io.Writer, desk *apiv1.Desk, now time.Time) error {
+	resources, err := c.getDeskResources(desk)
+	if err != nil {
+		return err
+	}
+
+	var w tabwriter.Writer
+	w.Init(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(&w, "Name:\t%s\n", desk.Name)
+	fmt.Fprintf(&w, "Owner:\t%s\n", desk.Spec.Owner)
+	var collaborators []string
+	for _, collaborator := range desk.Spec.Collaborators {
+		collaborators = append(collaborators, fmt.Sprintf("%s %s", collaborator.Kind, collaborator.Name))
+	}
+	fmt.Fprintf(&w, "Collaborators:\t%s\n", strings.Join(collaborators, ", "))
+	fmt.Fprintf(&w, "Class:\t%s\n", desk.Spec.DeskClassName)
+	fmt.Fprintf(&w, "Version:\t%s\n", desk.Spec.Version)
+	fmt.Fprintf(&w, "Created:\t%s\n", desk.CreationTimestamp)
+	fmt.Fprintf(&w, "Suspended:\t%t\n", desk.Spec.Suspended)
+	fmt.Fprintf(&w, "Network Isolation:\t%t\n", !desk.Spec.DisableNetworkIsolation)
+	fmt.Fprintf(&w, "State:\t%s\n", desk.Status.State)
+	fmt.Fprintf(&w, "Message:\t%s\n", desk.Status.Message)
+	fmt.Fprintf(&w, "Last Activity:\t%s\n", desk.Status.LastActivityTime)
+	fmt.Fprintf(&w, "Expiration:\t%s\n", desk.Spec.ExpirationTimestamp)
+	fmt.Fprintf(&w, "Renewals:\t%d\n", len(desk.Status.Renewals))
+	if desk.Status.URL != "" {
+		fmt.Fprintf(&w, "URL:\t%s\n", desk.Status.URL)
+	}
+	if ref := desk.Status.KubeconfigSecret; ref != nil {
+		fmt.Fprintf(&w, "Kubeconfig:\tsecret %s/%s\n", ref.Namespace, ref.Name)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var rows [][]string
+	for _, condition := range desk.Status.Conditions {
+		rows = append(rows, []string{string(condition.Type), string(condition.Status), condition.Reason, condition.Message})
+	}
+	if err := printDescribeSection(out, "Conditions", []string{"TYPE", "STATUS", "REASON", "MESSAGE"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, namespace := range resources.namespaces {
+		rows = append(rows, []string{namespace.Name, string(namespace.Status.Phase)})
+	}
+	if err := printDescribeSection(out, "Namespaces", []string{"NAME", "STATUS"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, sa := range resources.serviceAccounts {
+		rows = append(rows, []string{sa.Namespace, sa.Name, strconv.Itoa(len(sa.Secrets))})
+	}
+	if err := printDescribeSection(out, "Service Accounts", []string{"NAMESPACE", "NAME", "SECRETS"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, binding := range resources.roleBindings {
+		var subjects []string
+		for _, subject := range binding.Subjects {
+			if subject.Kind == rbacv1beta1.ServiceAccountKind {
+				subjects = append(subjects, fmt.Sprintf("%s %s/%s", subject.Kind, subject.Namespace, subject.Name))
+			} else {
+				subjects = append(subjects, fmt.Sprintf("%s %s", subject.Kind, subject.Name))
+			}
+		}
+		role := fmt.Sprintf("%s/%s", binding.RoleRef.Kind, binding.RoleRef.Name)
+		rows = append(rows, []string{binding.Namespace, binding.Name, role, strings.Join(subjects, ", ")})
+	}
+	if err := printDescribeSection(out, "Role Bindings", []string{"NAMESPACE", "NAME", "ROLE", "SUBJECTS"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, deployment := range resources.deployments {
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		rows = append(rows, []string{deployment.Namespace, deployment.Name,
+			fmt.Sprint(desired), fmt.Sprint(deployment.Status.Replicas), fmt.Sprint(deployment.Status.UpdatedReplicas), fmt.Sprint(deployment.Status.AvailableReplicas)})
+	}
+	if err := printDescribeSection(out, "Deployments", []string{"NAMESPACE", "NAME", "DESIRED", "CURRENT", "UP-TO-DATE", "AVAILABLE"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, pod := range resources.pods {
+		ready, restarts := 0, int32(0)
+		for _, status := range pod.Status.ContainerStatuses {
+			if status.Ready {
+				ready++
+			}
+			restarts += status.RestartCount
+		}
+		rows = append(rows, []string{pod.Namespace, pod.Name,
+			fmt.Sprintf("%d/%d", ready, len(pod.Spec.Containers)), podStatus(&pod), fmt.Sprint(restarts), shortHumanDuration(now.Sub(pod.CreationTimestamp.Time))})
+	}
+	if err := printDescribeSection(out, "Pods", []string{"NAMESPACE", "NAME", "READY", "STATUS", "RESTARTS", "AGE"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, service := range resources.services {
+		var ports []string
+		for _, port := range service.Spec.Ports {
+			ports = append(ports, fmt.Sprintf("%d/%s", port.Port, port.Protocol))
+		}
+		rows = append(rows, []string{service.Namespace, service.Name, string(service.Spec.Type), service.Spec.ClusterIP, strings.Join(ports, ",")})
+	}
+	if err := printDescribeSection(out, "Services", []string{"NAMESPACE", "NAME", "TYPE", "CLUSTER-IP", "PORTS"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, ingress := range resources.ingresses {
+		var hosts, addresses []string
+		for _, rule := range ingress.Spec.Rules {
+			hosts = append(hosts, rule.Host)
+		}
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if lb.IP != "" {
+				addresses = append(addresses, lb.IP)
+			} else {
+				addresses = append(addresses, lb.Hostname)
+			}
+		}
+		rows = append(rows, []string{ingress.Namespace, ingress.Name, strings.Join(hosts, ","), strings.Join(addresses, ",")})
+	}
+	if err := printDescribeSection(out, "Ingresses", []string{"NAMESPACE", "NAME", "HOSTS", "ADDRESS"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, quota := range resources.resourceQuotas {
+		var names []string
+		for name := range quota.Status.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			hard := quota.Status.Hard[v1.ResourceName(name)]
+			used := quota.Status.Used[v1.ResourceName(name)]
+			rows = append(rows, []string{quota.Namespace, name, used.String(), hard.String()})
+		}
+	}
+	if err := printDescribeSection(out, "Resource Quotas", []string{"NAMESPACE", "RESOURCE", "USED", "HARD"}, rows); err != nil {
+		return err
+	}
+
+	rows = nil
+	for _, event := range resources.events {
+		object := fmt.Sprintf("%s/%s", strings.ToLower(event.InvolvedObject.Kind), event.InvolvedObject.Name)
+		if event.InvolvedObject.Namespace != "" {
+			object = event.InvolvedObject.Namespace + "/" + object
+		}
+		rows = append(rows, []string{shortHumanDuration(now.Sub(event.LastTimestamp.Time)), fmt.Sprint(event.Count), object, event.Type, event.Reason, event.Message})
+	}
+	return printDescribeSection(out, "Events", []string{"LAST SEEN", "COUNT", "OBJECT", "TYPE", "REASON", "MESSAGE"}, rows)
+}
+
+// printDescribeSection prints a titled table that is indented under its
+// title, or <none> if it has no rows.
+func printDescribeSection(out io.Writer, title string, header []string, rows [][]string) error {
+	fmt.Fprintf(out, "%s:\n", title)
+	if len(rows) == 0 {
+		fmt.Fprintln(out, "  <none>")
+		return nil
+	}
+	var w tabwriter.Writer
+	w.Init(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(&w, "  %s\n", strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintf(&w, "  %s\n", strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// getDeskResources returns the namespaces of the desk, the resources in them
+// that are owned by the desk, the pods of its deployments and the events of
+// the desk and of the objects in its namespaces, sorted by namespace and name
+// or, for events, by time. Only the most recent events are returned.
+func (c *WorkshopctlCommand) getDeskResources(desk *apiv1.Desk) (*deskResources, error) {
+	core := c.kubeClient.CoreV1()
+	rbac := c.kubeClient.RbacV1beta1()
+	extensions := c.kubeClient.ExtensionsV1beta1()
+	resources := &deskResources{}
+
+	selector := labels.SelectorFromSet(labels.Set{apiv1.DeskNamespaceLabel: desk.Name}).String()
+	namespaceList, err := core.Namespaces().List(metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	for _, namespace := range namespaceList.Items {
+		if isOwnedByDesk(&namespace, desk) {
+			resources.namespaces = append(resources.namespaces, namespace)
+		}
+	}
+	sort.Slice(resources.namespaces, func(i, j int) bool {
+		return resources.namespaces[i].Name < resources.namespaces[j].Name
+	})
+
+	eventList, err := core.Events(v1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fields.Set{"involvedObject.kind": apiv1.DeskKind, "involvedObject.name": desk.Name}.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, event := range eventList.Items {
+		if event.InvolvedObject.Kind == apiv1.DeskKind && event.InvolvedObject.Name == desk.Name {
+			resources.events = append(resources.events, event)
+		}
+	}
+
+	for _, namespace := range resources.namespaces {
+		saList, err := core.ServiceAccounts(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, sa := range saList.Items {
+			if isOwnedByDesk(&sa, desk) {
+				resources.serviceAccounts = append(resources.serviceAccounts, sa)
+			}
+		}
+
+		bindingList, err := rbac.RoleBindings(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, binding := range bindingList.Items {
+			if isOwnedByDesk(&binding, desk) {
+				resources.roleBindings = append(resources.roleBindings, binding)
+			}
+		}
+
+		deploymentList, err := extensions.Deployments(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, deployment := range deploymentList.Items {
+			if !isOwnedByDesk(&deployment, desk) {
+				continue
+			}
+			resources.deployments = append(resources.deployments, deployment)
+			if deployment.Spec.Selector == nil {
+				continue
+			}
+			podSelector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+			if err != nil {
+				return nil, err
+			}
+			podList, err := core.Pods(namespace.Name).List(metav1.ListOptions{LabelSelector: podSelector.String()})
+			if err != nil {
+				return nil, err
+			}
+			for _, pod := range podList.Items {
+				if podSelector.Matches(labels.Set(pod.Labels)) {
+					resources.pods = append(resources.pods, pod)
+				}
+			}
+		}
+
+		serviceList, err := core.Services(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, service := range serviceList.Items {
+			if isOwnedByDesk(&service, desk) {
+				resources.services = append(resources.services, service)
+			}
+		}
+
+		ingressList, err := extensions.Ingresses(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, ingress := range ingressList.Items {
+			if isOwnedByDesk(&ingress, desk) {
+				resources.ingresses = append(resources.ingresses, ingress)
+			}
+		}
+
+		quotaList, err := core.ResourceQuotas(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, quota := range quotaList.Items {
+			if isOwnedByDesk(&quota, desk) {
+				resources.resourceQuotas = append(resources.resourceQuotas, quota)
+			}
+		}
+
+		namespaceEventList, err := core.Events(namespace.Name).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		resources.events = append(resources.events, namespaceEventList.Items...)
+	}
+
+	sort.Slice(resources.pods, func(i, j int) bool {
+		if resources.pods[i].Namespace != resources.pods[j].Namespace {
+			return resources.pods[i].Namespace < resources.pods[j].Namespace
+		}
+		return resources.pods[i].Name < resources.pods[j].Name
+	})
+	sort.SliceStable(resources.events, func(i, j int) bool {
+		return resources.events[i].LastTimestamp.Before(resources.events[j].LastTimestamp)
+	})
+	if len(resources.events) > describedEventCount {
+		resources.events = resources.events[len(resources.events)-describedEventCount:]
+	}
+	return resources, nil
+}
+
+// isOwnedByDesk returns whether the object has an owner reference to the
+// desk.
+func isOwnedByDesk(object metav1.Object, desk *apiv1.Desk) bool {
+	for _, ownerRef := range object.GetOwnerReferences() {
+		if ownerRef.Kind == apiv1.DeskKind && ownerRef.UID == desk.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// podStatus returns the reason that a container of the pod is waiting or
+// terminated with, e.g. "CrashLoopBackOff", or else the phase of the pod.
+func podStatus(pod *v1.Pod) string {
+	if pod.DeletionTimestamp != nil {
+		return "Terminating"
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if waiting := status.State.Waiting; waiting != nil && waiting.Reason != "" {
+			return waiting.Reason
+		}
+		if terminated := status.State.Terminated; terminated != nil && terminated.Reason != "" {
+			return terminated.Reason
+		}
+	}
+	if pod.Status.Reason != "" {
+		return pod.Status.Reason
+	}
+	return string(pod.Status.Phase)
+}
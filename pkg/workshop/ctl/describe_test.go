@@ -0,0 +1,152 @@
+package ctl
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+	extensionsv1beta1 "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+func TestDescribeDesk(t *testing.T) {
+	now := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	desk := &apiv1.Desk{
+		ObjectMeta: metav1.ObjectMeta{Name: "alice-desk", UID: types.UID("alice-desk-uid")},
+		Spec:       apiv1.DeskSpec{Owner: "alice"},
+		Status: apiv1.DeskStatus{
+			State: apiv1.DeskStateReady,
+			URL:   "https://alice-desk.example.com",
+		},
+	}
+	owned := func(namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    map[string]string{"app": kubeshellName},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: apiv1.SchemeGroupVersion.String(),
+				Kind:       apiv1.DeskKind,
+				Name:       desk.Name,
+				UID:        desk.UID,
+			}},
+		}
+	}
+
+	namespace := &v1.Namespace{ObjectMeta: owned("", "alice-desk-shell"), Status: v1.NamespaceStatus{Phase: v1.NamespaceActive}}
+	namespace.Labels = map[string]string{apiv1.DeskNamespaceLabel: desk.Name}
+	kubeClient := kubefake.NewSimpleClientset(
+		namespace,
+		&v1.ServiceAccount{ObjectMeta: owned("alice-desk-shell", "desk")},
+		&v1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "alice-desk-shell", Name: "default"}},
+		&extensionsv1beta1.Deployment{
+			ObjectMeta: owned("alice-desk-shell", kubeshellName),
+			Spec: extensionsv1beta1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": kubeshellName}},
+			},
+			Status: extensionsv1beta1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1},
+		},
+		&v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "alice-desk-shell",
+				Name:              "kubeshell-1234",
+				Labels:            map[string]string{"app": kubeshellName},
+				CreationTimestamp: metav1.NewTime(now.Add(-5 * time.Minute)),
+			},
+			Spec: v1.PodSpec{Containers: []v1.Container{{Name: kubeshellName}}},
+			Status: v1.PodStatus{
+				Phase: v1.PodPending,
+				ContainerStatuses: []v1.ContainerStatus{{
+					Name:         kubeshellName,
+					RestartCount: 3,
+					State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: "CrashLoopBackOff"}},
+				}},
+			},
+		},
+		&v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "alice-desk-shell", Name: "kubeshell-1234.1"},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "alice-desk-shell", Name: "kubeshell-1234"},
+			Type:           v1.EventTypeWarning,
+			Reason:         "BackOff",
+			Message:        "Back-off restarting failed container",
+			Count:          3,
+			LastTimestamp:  metav1.NewTime(now.Add(-time.Minute)),
+		},
+		&v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "default", Name: "bob-desk.1"},
+			InvolvedObject: v1.ObjectReference{Kind: apiv1.DeskKind, Name: "bob-desk"},
+			Reason:         "Unrelated",
+		},
+	)
+
+	c := &WorkshopctlCommand{kubeClient: kubeClient}
+	var buf bytes.Buffer
+	if err := c.describeDesk(&buf, desk, now); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"URL:                https://alice-desk.example.com",
+		"Namespaces:\n  NAME              STATUS\n  alice-desk-shell  Active\n",
+		"Service Accounts:\n  NAMESPACE         NAME  SECRETS\n  alice-desk-shell  desk  0\n",
+		"alice-desk-shell  kubeshell  1        1        1           0",
+		"alice-desk-shell  kubeshell-1234  0/1    CrashLoopBackOff  3         5m",
+		"Ingresses:\n  <none>\n",
+		"60s        3      alice-desk-shell/pod/kubeshell-1234  Warning  BackOff",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Unrelated") {
+		t.Errorf("expected output not to contain events of other desks, got\n%s", out)
+	}
+}
+
+func TestDescribeDeskRecentEvents(t *testing.T) {
+	now := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	desk := &apiv1.Desk{ObjectMeta: metav1.ObjectMeta{Name: "alice-desk", UID: types.UID("alice-desk-uid")}}
+	objects := []runtime.Object{
+		&v1.Namespace{ObjectMeta: metav1.ObjectMeta{
+			Name:   "alice-desk-shell",
+			Labels: map[string]string{apiv1.DeskNamespaceLabel: desk.Name},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: apiv1.SchemeGroupVersion.String(),
+				Kind:       apiv1.DeskKind,
+				Name:       desk.Name,
+				UID:        desk.UID,
+			}},
+		}},
+	}
+	for i := 1; i <= describedEventCount+5; i++ {
+		objects = append(objects, &v1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Namespace: "alice-desk-shell", Name: fmt.Sprintf("kubeshell-1234.%d", i)},
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "alice-desk-shell", Name: "kubeshell-1234"},
+			Type:           v1.EventTypeNormal,
+			Reason:         fmt.Sprintf("Reason%d", i),
+			Count:          1,
+			LastTimestamp:  metav1.NewTime(now.Add(time.Duration(i) * time.Minute)),
+		})
+	}
+
+	c := &WorkshopctlCommand{kubeClient: kubefake.NewSimpleClientset(objects...)}
+	resources, err := c.getDeskResources(desk)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(resources.events) != describedEventCount {
+		t.Fatalf("expected %d events, got %d", describedEventCount, len(resources.events))
+	}
+	if first, last := resources.events[0].Reason, resources.events[describedEventCount-1].Reason; first != "Reason6" || last != fmt.Sprintf("Reason%d", describedEventCount+5) {
+		t.Errorf("expected the most recent events, got %s to %s", first, last)
+	}
+}
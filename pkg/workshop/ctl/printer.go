@@ -0,0 +1,348 @@
+package ctl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/util/jsonpath"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// deskStateDeleted is the state that the wide format shows for desks that
+// were deleted while they were watched.
+const deskStateDeleted apiv1.DeskState = "Deleted"
+
+// deskOutputFormats lists the formats of the --output option of get desk.
+// The formats that end with "=" take a template.
+var deskOutputFormats = []string{"json", "yaml", "wide", "name", "jsonpath=", "go-template=", "custom-columns="}
+
+// deskPrinter prints desks in one of the formats of the --output option,
+// sorted by the --sort-by field.
+type deskPrinter struct {
+	format   string
+	template string
+	sortBy   string
+	now      time.Time
+
+	// noHeaders is set once the headers of the table formats have been
+	// printed for a watch.
+	noHeaders bool
+}
+
+func newDeskPrinter(output, sortBy string, now time.Time) (*deskPrinter, error) {
+	p := &deskPrinter{format: output, sortBy: sortBy, now: now}
+	if i := strings.Index(output, "="); i >= 0 {
+		p.format, p.template = output[:i], output[i+1:]
+	}
+	switch p.format {
+	case "", "json", "yaml", "wide", "name":
+		if p.template != "" {
+			return nil, fmt.Errorf("output format \"%s\" takes no template", p.format)
+		}
+	case "jsonpath", "go-template", "custom-columns":
+		if p.template == "" {
+			return nil, fmt.Errorf("output format \"%s\" requires a template, e.g. -o %s=...", p.format, p.format)
+		}
+	default:
+		return nil, fmt.Errorf("unknown output format \"%s\", expected one of %s", output, strings.Join(deskOutputFormats, ", "))
+	}
+	return p, nil
+}
+
+// print prints the desks. A list of desks is printed as a list, even if it
+// has a single desk, while a desk that was asked for by name is printed as
+// an object.
+func (p *deskPrinter) print(w io.Writer, desks []apiv1.Desk, list bool) error {
+	desks = append([]apiv1.Desk(nil), desks...)
+	for i := range desks {
+		desks[i].APIVersion = apiv1.SchemeGroupVersion.String()
+		desks[i].Kind = apiv1.DeskKind
+	}
+	if err := p.sort(desks); err != nil {
+		return err
+	}
+
+	var obj interface{} = &deskOutputList{
+		TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "List"},
+		Items:    desks,
+	}
+	if !list && len(desks) == 1 {
+		obj = &desks[0]
+	}
+
+	switch p.format {
+	case "":
+		return p.printTable(w, desks, false)
+	case "wide":
+		return p.printTable(w, desks, true)
+	case "name":
+		for _, desk := range desks {
+			fmt.Fprintf(w, "desk/%s\n", desk.Name)
+		}
+		return nil
+	case "json":
+		data, err := json.MarshalIndent(obj, "", "    ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case "yaml":
+		data, err := yaml.Marshal(obj)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	case "jsonpath":
+		data, err := toGeneric(obj)
+		if err != nil {
+			return err
+		}
+		path := jsonpath.New("output")
+		if err := path.Parse(p.template); err != nil {
+			return fmt.Errorf("invalid jsonpath template: %s", err)
+		}
+		return path.Execute(w, data)
+	case "go-template":
+		data, err := toGeneric(obj)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New("output").Parse(p.template)
+		if err != nil {
+			return fmt.Errorf("invalid go-template: %s", err)
+		}
+		return tmpl.Execute(w, data)
+	case "custom-columns":
+		return p.printColumns(w, desks)
+	}
+	return nil
+}
+
+// printWatched prints a desk of an event of a watch. The headers of the table
+// formats are only printed with the first desk, and the wide format shows
+// deleted desks in the Deleted state. Ages and remaining times are computed at
+// the time of each event.
+func (p *deskPrinter) printWatched(w io.Writer, desk apiv1.Desk, eventType watch.EventType) error {
+	p.now = time.Now()
+	if eventType == watch.Deleted && p.format == "wide" {
+		desk.Status.State = deskStateDeleted
+	}
+	if err := p.print(w, []apiv1.Desk{desk}, false); err != nil {
+		return err
+	}
+	p.noHeaders = true
+	return nil
+}
+
+// deskOutputList is the list of desks printed by the json and yaml formats.
+type deskOutputList struct {
+	metav1.TypeMeta `json:",inline"`
+	Items           []apiv1.Desk `json:"items"`
+}
+
+func (p *deskPrinter) printTable(w io.Writer, desks []apiv1.Desk, wide bool) error {
+	var tw tabwriter.Writer
+	tw.Init(w, 0, 4, 6, ' ', 0)
+	header := "NAME\tOWNER\tVERSION\tEXPIRATION"
+	if wide {
+		header += "\tSTATE\tLAST ACTIVITY\tAGE\tREMAINING\tURL"
+	}
+	if !p.noHeaders {
+		fmt.Fprintln(&tw, header)
+	}
+	for _, desk := range desks {
+		fmt.Fprintf(&tw, "%s\t%s\t%s\t%s", desk.Name, desk.Spec.Owner, desk.Spec.Version, formatTime(desk.Spec.ExpirationTimestamp))
+		if wide {
+			remaining := "<expired>"
+			if expiration := desk.Spec.ExpirationTimestamp; expiration.After(p.now) {
+				remaining = shortHumanDuration(expiration.Sub(p.now))
+			}
+			url := desk.Status.URL
+			if url == "" {
+				url = "<none>"
+			}
+			fmt.Fprintf(&tw, "\t%s\t%s\t%s\t%s\t%s", desk.Status.State, formatTime(desk.Status.LastActivityTime), shortHumanDuration(p.now.Sub(desk.CreationTimestamp.Time)), remaining, url)
+		}
+		fmt.Fprintln(&tw)
+	}
+	return tw.Flush()
+}
+
+// printColumns prints the columns of the custom-columns template, which is a
+// comma separated list of HEADER:JSONPATH pairs, e.g.
+// "NAME:.metadata.name,OWNER:.spec.owner".
+func (p *deskPrinter) printColumns(w io.Writer, desks []apiv1.Desk) error {
+	var headers []string
+	var paths []*jsonpath.JSONPath
+	for _, column := range strings.Split(p.template, ",") {
+		parts := strings.SplitN(column, ":", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("invalid custom column \"%s\", expected HEADER:JSONPATH", column)
+		}
+		path, err := parseFieldPath(parts[1])
+		if err != nil {
+			return err
+		}
+		headers = append(headers, parts[0])
+		paths = append(paths, path)
+	}
+
+	var tw tabwriter.Writer
+	tw.Init(w, 0, 4, 6, ' ', 0)
+	if !p.noHeaders {
+		fmt.Fprintln(&tw, strings.Join(headers, "\t"))
+	}
+	for i := range desks {
+		data, err := toGeneric(&desks[i])
+		if err != nil {
+			return err
+		}
+		values := make([]string, len(paths))
+		for j, path := range paths {
+			var buf bytes.Buffer
+			if err := path.Execute(&buf, data); err != nil {
+				return err
+			}
+			values[j] = buf.String()
+			if values[j] == "" {
+				values[j] = "<none>"
+			}
+		}
+		fmt.Fprintln(&tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+// sort sorts the desks by the value of the --sort-by field. Desks that do not
+// have the field come first, and desks with equal values keep their order.
+func (p *deskPrinter) sort(desks []apiv1.Desk) error {
+	if p.sortBy == "" {
+		return nil
+	}
+	path, err := parseFieldPath(p.sortBy)
+	if err != nil {
+		return err
+	}
+	keys := make([]interface{}, len(desks))
+	for i := range desks {
+		data, err := toGeneric(&desks[i])
+		if err != nil {
+			return err
+		}
+		results, err := path.FindResults(data)
+		if err != nil {
+			return err
+		}
+		if len(results) > 0 && len(results[0]) > 0 {
+			keys[i] = results[0][0].Interface()
+		}
+	}
+
+	indexes := make([]int, len(desks))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return lessValue(keys[indexes[i]], keys[indexes[j]])
+	})
+	sorted := make([]apiv1.Desk, len(desks))
+	for i, index := range indexes {
+		sorted[i] = desks[index]
+	}
+	copy(desks, sorted)
+	return nil
+}
+
+// lessValue orders values decoded from JSON. Numbers and booleans are
+// compared by value, timestamps sort correctly as strings, and other values
+// are compared by their JSON representation.
+func lessValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b != nil
+	}
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			return a < b
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return a < b
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			return !a && b
+		}
+	}
+	aData, _ := json.Marshal(a)
+	bData, _ := json.Marshal(b)
+	return bytes.Compare(aData, bData) < 0
+}
+
+// parseFieldPath parses a field given as a jsonpath expression with or
+// without braces, e.g. ".spec.owner" or "{.spec.owner}".
+func parseFieldPath(field string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(field, "{") {
+		field = "{" + field + "}"
+	}
+	path := jsonpath.New("field").AllowMissingKeys(true)
+	if err := path.Parse(field); err != nil {
+		return nil, fmt.Errorf("invalid field \"%s\": %s", field, err)
+	}
+	return path, nil
+}
+
+// toGeneric returns the JSON representation of obj as maps and slices, so
+// that templates refer to fields by their JSON names.
+func toGeneric(obj interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// formatTime formats the time for the table formats, in which times that are
+// not set are shown as "<none>".
+func formatTime(t metav1.Time) string {
+	if t.IsZero() {
+		return "<none>"
+	}
+	return t.String()
+}
+
+// shortHumanDuration formats the duration in its largest unit, e.g. "45s",
+// "3h" or "12d".
+func shortHumanDuration(d time.Duration) string {
+	switch {
+	case d < 0:
+		return "<invalid>"
+	case d < time.Minute*2:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour*2:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < time.Hour*48:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	case d < time.Hour*24*365*2:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+	return fmt.Sprintf("%dy", int(d.Hours()/24/365))
+}
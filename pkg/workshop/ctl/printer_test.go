@@ -0,0 +1,140 @@
+package ctl
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+func TestDeskPrinter(t *testing.T) {
+	now := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	desks := []apiv1.Desk{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob-desk", CreationTimestamp: metav1.NewTime(now.Add(-3 * time.Hour))},
+			Spec:       apiv1.DeskSpec{Owner: "bob", ExpirationTimestamp: metav1.NewTime(now.Add(72 * time.Hour))},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice-desk", CreationTimestamp: metav1.NewTime(now.Add(-time.Hour))},
+			Spec:       apiv1.DeskSpec{Owner: "alice", ExpirationTimestamp: metav1.NewTime(now.Add(-time.Minute))},
+			Status:     apiv1.DeskStatus{URL: "https://alice-desk.example.com"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		output string
+		sortBy string
+		list   bool
+		want   string
+	}{
+		{
+			name:   "name sorted by owner",
+			output: "name",
+			sortBy: ".spec.owner",
+			list:   true,
+			want:   "desk/alice-desk\ndesk/bob-desk\n",
+		},
+		{
+			name:   "jsonpath of a list",
+			output: "jsonpath={.kind} {.items[*].metadata.name}",
+			list:   true,
+			want:   "List bob-desk alice-desk",
+		},
+		{
+			name:   "go-template of a desk",
+			output: "go-template={{.kind}} {{.metadata.name}}",
+			want:   "Desk bob-desk",
+		},
+		{
+			name:   "custom-columns sorted by creation",
+			output: "custom-columns=NAME:.metadata.name,URL:{.status.url}",
+			sortBy: "{.metadata.creationTimestamp}",
+			list:   true,
+			want:   "NAME            URL\nbob-desk        <none>\nalice-desk      https://alice-desk.example.com\n",
+		},
+	}
+	for _, test := range tests {
+		printer, err := newDeskPrinter(test.output, test.sortBy, now)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.name, err)
+		}
+		in := desks
+		if !test.list {
+			in = desks[:1]
+		}
+		var buf bytes.Buffer
+		if err := printer.print(&buf, in, test.list); err != nil {
+			t.Fatalf("%s: unexpected error: %s", test.name, err)
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s: expected output %q, got %q", test.name, test.want, got)
+		}
+	}
+}
+
+func TestDeskPrinterWide(t *testing.T) {
+	now := time.Date(2017, 8, 1, 12, 0, 0, 0, time.UTC)
+	desks := []apiv1.Desk{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob-desk", CreationTimestamp: metav1.NewTime(now.Add(-3 * time.Hour))},
+			Spec:       apiv1.DeskSpec{ExpirationTimestamp: metav1.NewTime(now.Add(72 * time.Hour))},
+			Status:     apiv1.DeskStatus{URL: "https://bob-desk.example.com"},
+		},
+	}
+	printer, err := newDeskPrinter("wide", "", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := printer.print(&buf, desks, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected a header and 1 row, got %q", buf.String())
+	}
+	for _, field := range []string{"STATE", "LAST ACTIVITY", "AGE", "REMAINING", "URL"} {
+		if !bytes.Contains(lines[0], []byte(field)) {
+			t.Errorf("expected header to contain %s, got %q", field, lines[0])
+		}
+	}
+	for _, field := range []string{"3h", "3d", "https://bob-desk.example.com", "<none>"} {
+		if !bytes.Contains(lines[1], []byte(field)) {
+			t.Errorf("expected row to contain %s, got %q", field, lines[1])
+		}
+	}
+}
+
+func TestDeskPrinterDefault(t *testing.T) {
+	desks := []apiv1.Desk{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "bob-desk"},
+			Spec:       apiv1.DeskSpec{Owner: "bob", Version: "1.0"},
+			Status:     apiv1.DeskStatus{State: apiv1.DeskStateReady},
+		},
+	}
+	printer, err := newDeskPrinter("", "", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var buf bytes.Buffer
+	if err := printer.print(&buf, desks, true); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	want := "NAME          OWNER      VERSION      EXPIRATION\nbob-desk      bob        1.0          <none>\n"
+	if got := buf.String(); got != want {
+		t.Errorf("expected output %q, got %q", want, got)
+	}
+}
+
+func TestNewDeskPrinterErrors(t *testing.T) {
+	for _, output := range []string{"table", "jsonpath=", "json=x", "custom-columns="} {
+		if _, err := newDeskPrinter(output, "", time.Now()); err == nil {
+			t.Errorf("expected error for output \"%s\"", output)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package ctl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/urfave/cli"
+	"golang.org/x/crypto/ssh/terminal"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	remotecommandconsts "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/util/exec"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Name of the kubeshell deployment of each desk, of the label value of
+	// its pods and of its container.
+	kubeshellName = "kubeshell"
+
+	// Command of interactive shells, which prefers bash when the shell
+	// image has it.
+	interactiveShell = "command -v bash >/dev/null && exec bash -l || exec sh -l"
+)
+
+// ShellDesk opens an interactive shell in the kubeshell of the desk, or runs
+// the command given by the --command option in it. The exit code of the
+// command is the exit code of workshopctl.
+func (c *WorkshopctlCommand) ShellDesk(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return errors.New("NAME is required")
+	}
+	name := ctx.Args()[0]
+
+	pod, err := c.getDeskShellPod(name)
+	if err != nil {
+		return err
+	}
+
+	var stdin io.Reader
+	command := []string{"sh", "-c", interactiveShell}
+	stdinFd := int(os.Stdin.Fd())
+	tty := false
+	if ctx.IsSet("command") {
+		command = []string{"sh", "-c", ctx.String("command")}
+	} else {
+		stdin = os.Stdin
+		tty = terminal.IsTerminal(stdinFd)
+	}
+
+	req := c.kubeClient.CoreV1().RESTClient().Post().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		Name(pod.Name).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: kubeshellName,
+			Command:   command,
+			Stdin:     stdin != nil,
+			Stdout:    true,
+			Stderr:    !tty,
+			TTY:       tty,
+		}, scheme.ParameterCodec)
+	executor, err := remotecommand.NewExecutor(c.config, "POST", req.URL())
+	if err != nil {
+		return err
+	}
+
+	options := remotecommand.StreamOptions{
+		SupportedProtocols: remotecommandconsts.SupportedStreamingProtocols,
+		Stdin:              stdin,
+		Stdout:             os.Stdout,
+		Tty:                tty,
+	}
+	if tty {
+		// In raw mode, keys such as Ctrl-C are sent to the shell instead
+		// of being handled by the local terminal.
+		state, err := terminal.MakeRaw(stdinFd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(stdinFd, state)
+
+		stop := make(chan struct{})
+		defer close(stop)
+		options.TerminalSizeQueue = watchTerminalSize(int(os.Stdout.Fd()), stop)
+	} else {
+		options.Stderr = os.Stderr
+	}
+
+	err = executor.Stream(options)
+	if exitErr, ok := err.(exec.CodeExitError); ok {
+		return cli.NewExitError("", exitErr.Code)
+	}
+	return err
+}
+
+// getDeskShellPod returns a running pod of the kubeshell of the desk.
+func (c *WorkshopctlCommand) getDeskShellPod(name string) (*v1.Pod, error) {
+	desk, err := c.workshopClient.WorkshopV1().Desks().Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	className := desk.Spec.DeskClassName
+	if className == "" {
+		className = apiv1.DeskDefaultClass
+	}
+	class, err := c.workshopClient.WorkshopV1().DeskClasses().Get(className, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	namespace := desk.NamespaceName(class.Spec.Shell.Namespace)
+	pods, err := c.kubeClient.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: "app=" + kubeshellName})
+	if err != nil {
+		return nil, err
+	}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.DeletionTimestamp == nil && pod.Status.Phase == v1.PodRunning {
+			return pod, nil
+		}
+	}
+	if desk.Spec.Suspended {
+		return nil, fmt.Errorf("desk \"%s\" is suspended, resume it to open a shell", name)
+	}
+	return nil, fmt.Errorf("desk \"%s\" has no running shell in namespace \"%s\"", name, namespace)
+}
+
+// terminalSizeQueue passes the sizes of the local terminal to the remote
+// terminal.
+type terminalSizeQueue struct {
+	sizes chan remotecommand.TerminalSize
+}
+
+func (q *terminalSizeQueue) Next() *remotecommand.TerminalSize {
+	size, ok := <-q.sizes
+	if !ok {
+		return nil
+	}
+	return &size
+}
+
+// watchTerminalSize returns a queue of the sizes of the terminal, starting
+// with its current size, until stop is closed.
+func watchTerminalSize(fd int, stop <-chan struct{}) remotecommand.TerminalSizeQueue {
+	queue := &terminalSizeQueue{sizes: make(chan remotecommand.TerminalSize, 1)}
+	resized := make(chan os.Signal, 1)
+	notifyTerminalResize(resized)
+	go func() {
+		defer close(queue.sizes)
+		defer stopTerminalResize(resized)
+		for {
+			if width, height, err := terminal.GetSize(fd); err == nil {
+				select {
+				case queue.sizes <- remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}:
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case <-resized:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return queue
+}
@@ -0,0 +1,146 @@
+package ctl
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/client/workshop/fake"
+)
+
+func TestGetDeskShellPod(t *testing.T) {
+	class := &apiv1.DeskClass{
+		ObjectMeta: metav1.ObjectMeta{Name: apiv1.DeskDefaultClass},
+		Spec:       apiv1.DeskClassSpec{Shell: apiv1.DeskShellTemplate{Namespace: "trusted"}},
+	}
+	newDesk := func(suspended bool) *apiv1.Desk {
+		return &apiv1.Desk{
+			ObjectMeta: metav1.ObjectMeta{Name: "alice"},
+			Spec:       apiv1.DeskSpec{Owner: "alice", Suspended: suspended},
+		}
+	}
+	newPod := func(name, app string, phase v1.PodPhase, terminating bool) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "alice-desk-trusted",
+				Name:      name,
+				Labels:    map[string]string{"app": app},
+			},
+			Status: v1.PodStatus{Phase: phase},
+		}
+		if terminating {
+			now := metav1.NewTime(time.Now())
+			pod.DeletionTimestamp = &now
+		}
+		return pod
+	}
+
+	tests := []struct {
+		name    string
+		desk    *apiv1.Desk
+		pods    []runtime.Object
+		wantPod string
+		wantErr string
+	}{
+		{
+			name: "running pod",
+			desk: newDesk(false),
+			pods: []runtime.Object{
+				newPod("kubeshell-1", kubeshellName, v1.PodPending, false),
+				newPod("kubeshell-2", kubeshellName, v1.PodRunning, false),
+			},
+			wantPod: "kubeshell-2",
+		},
+		{
+			name: "running pod replaces terminating pod",
+			desk: newDesk(false),
+			pods: []runtime.Object{
+				newPod("kubeshell-1", kubeshellName, v1.PodRunning, true),
+				newPod("kubeshell-2", kubeshellName, v1.PodRunning, false),
+			},
+			wantPod: "kubeshell-2",
+		},
+		{
+			name: "only terminating pod",
+			desk: newDesk(false),
+			pods: []runtime.Object{
+				newPod("kubeshell-1", kubeshellName, v1.PodRunning, true),
+				newPod("other-1", "other", v1.PodRunning, false),
+			},
+			wantErr: "desk \"alice\" has no running shell in namespace \"alice-desk-trusted\"",
+		},
+		{
+			name: "suspended desk",
+			desk: newDesk(true),
+			pods: []runtime.Object{
+				newPod("kubeshell-1", kubeshellName, v1.PodRunning, true),
+			},
+			wantErr: "desk \"alice\" is suspended, resume it to open a shell",
+		},
+		{
+			name:    "desk not found",
+			wantErr: "not found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			workshopObjects := []runtime.Object{class}
+			if test.desk != nil {
+				workshopObjects = append(workshopObjects, test.desk)
+			}
+			c := &WorkshopctlCommand{
+				kubeClient:     kubefake.NewSimpleClientset(test.pods...),
+				workshopClient: fake.NewSimpleClientset(workshopObjects...),
+			}
+
+			pod, err := c.getDeskShellPod("alice")
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("expected error %q, got %v", test.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if pod.Name != test.wantPod {
+				t.Errorf("expected pod %q, got %q", test.wantPod, pod.Name)
+			}
+		})
+	}
+}
+
+func TestWatchTerminalSize(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// The size of a pipe is unknown, so no size is queued and the queue
+	// ends once it is stopped.
+	stop := make(chan struct{})
+	queue := watchTerminalSize(int(w.Fd()), stop)
+	close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		if size := queue.Next(); size != nil {
+			t.Errorf("expected no terminal size, got %+v", size)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected queue to end when stopped")
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package ctl
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// notifyTerminalResize relays the resizes of the terminal to c.
+func notifyTerminalResize(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGWINCH)
+}
+
+func stopTerminalResize(c chan<- os.Signal) {
+	signal.Stop(c)
+}
@@ -0,0 +1,11 @@
+package ctl
+
+import (
+	"os"
+)
+
+// notifyTerminalResize does nothing, since Windows does not signal resizes of
+// the console. The remote terminal keeps the initial size of the console.
+func notifyTerminalResize(c chan<- os.Signal) {}
+
+func stopTerminalResize(c chan<- os.Signal) {}
@@ -0,0 +1,101 @@
+package ctl
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+// watchDesks prints the desks, or the desk with the given name, and then
+// each change of them until the watch fails. With watchOnly, only the
+// changes are printed. When the server expires the watch, the desks are
+// listed and printed again and the watch is restarted.
+func (c *WorkshopctlCommand) watchDesks(w io.Writer, printer *deskPrinter, name string, watchOnly bool) error {
+	resourceVersion, err := c.listWatchedDesks(w, printer, name, !watchOnly)
+	if err != nil {
+		return err
+	}
+	for {
+		resourceVersion, err = c.streamDeskEvents(w, printer, name, resourceVersion)
+		if isWatchExpired(err) {
+			resourceVersion, err = c.listWatchedDesks(w, printer, name, true)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// listWatchedDesks lists the watched desks, prints them if print is set and
+// returns the resource version to watch from.
+func (c *WorkshopctlCommand) listWatchedDesks(w io.Writer, printer *deskPrinter, name string, print bool) (string, error) {
+	deskList, err := c.workshopClient.WorkshopV1().Desks().List(metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+	var desks []apiv1.Desk
+	for _, desk := range deskList.Items {
+		if name == "" || desk.Name == name {
+			desks = append(desks, desk)
+		}
+	}
+	if name != "" && len(desks) == 0 {
+		return "", apierrors.NewNotFound(apiv1.Resource("desks"), name)
+	}
+
+	if print {
+		if err := printer.sort(desks); err != nil {
+			return "", err
+		}
+		for _, desk := range desks {
+			if err := printer.printWatched(w, desk, watch.Added); err != nil {
+				return "", err
+			}
+		}
+	}
+	return deskList.ResourceVersion, nil
+}
+
+// streamDeskEvents prints the events of the watched desks from the resource
+// version until the server closes the watch. It returns the resource version
+// of the last event.
+func (c *WorkshopctlCommand) streamDeskEvents(w io.Writer, printer *deskPrinter, name, resourceVersion string) (string, error) {
+	watcher, err := c.workshopClient.WorkshopV1().Desks().Watch(metav1.ListOptions{ResourceVersion: resourceVersion})
+	if err != nil {
+		return resourceVersion, err
+	}
+	defer watcher.Stop()
+
+	for event := range watcher.ResultChan() {
+		switch event.Type {
+		case watch.Added, watch.Modified, watch.Deleted:
+			desk, ok := event.Object.(*apiv1.Desk)
+			if !ok {
+				return resourceVersion, fmt.Errorf("unexpected object in watch of desks: %T", event.Object)
+			}
+			resourceVersion = desk.ResourceVersion
+			if name != "" && desk.Name != name {
+				continue
+			}
+			if err := printer.printWatched(w, *desk, event.Type); err != nil {
+				return resourceVersion, err
+			}
+		case watch.Error:
+			return resourceVersion, apierrors.FromObject(event.Object)
+		}
+	}
+	return resourceVersion, nil
+}
+
+// isWatchExpired returns whether the error is the server telling that the
+// resource version of a watch is too old to be watched from.
+func isWatchExpired(err error) bool {
+	status, ok := err.(apierrors.APIStatus)
+	return ok && status.Status().Code == http.StatusGone
+}
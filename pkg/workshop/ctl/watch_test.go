@@ -0,0 +1,126 @@
+package ctl
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	core "k8s.io/client-go/testing"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/client/workshop/fake"
+)
+
+func newWatchedDesk(name string, state apiv1.DeskState) *apiv1.Desk {
+	return &apiv1.Desk{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Status:     apiv1.DeskStatus{State: state},
+	}
+}
+
+func TestWatchDesks(t *testing.T) {
+	client := fake.NewSimpleClientset(newWatchedDesk("alice-desk", apiv1.DeskStateInitializing))
+
+	// The first watch streams events until the server expires it, after
+	// which the desks are listed again and the second watch fails.
+	watcher := watch.NewFakeWithChanSize(10, false)
+	watcher.Modify(newWatchedDesk("alice-desk", apiv1.DeskStateReady))
+	watcher.Add(newWatchedDesk("bob-desk", apiv1.DeskStateInitializing))
+	watcher.Delete(newWatchedDesk("bob-desk", apiv1.DeskStateReady))
+	watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: http.StatusGone, Reason: metav1.StatusReasonExpired})
+	watches := 0
+	client.PrependWatchReactor("desks", func(action core.Action) (bool, watch.Interface, error) {
+		watches++
+		if watches > 1 {
+			return true, nil, errors.New("watch failed")
+		}
+		return true, watcher, nil
+	})
+
+	printer, err := newDeskPrinter("custom-columns=NAME:.metadata.name,STATE:.status.state", "", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := &WorkshopctlCommand{workshopClient: client}
+	var buf bytes.Buffer
+	if err := c.watchDesks(&buf, printer, "", false); err == nil || err.Error() != "watch failed" {
+		t.Fatalf("expected watch to fail, got %v", err)
+	}
+
+	want := []string{
+		"NAME STATE",
+		"alice-desk Initializing",
+		"alice-desk Ready",
+		"bob-desk Initializing",
+		"bob-desk Ready",
+		"alice-desk Initializing",
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("expected %d lines, got %q", len(want), buf.String())
+	}
+	for i, line := range lines {
+		if got := strings.Join(strings.Fields(line), " "); got != want[i] {
+			t.Errorf("expected line %d to be %q, got %q", i, want[i], got)
+		}
+	}
+	if watches != 2 {
+		t.Errorf("expected 2 watches, got %d", watches)
+	}
+}
+
+func TestWatchDesksByName(t *testing.T) {
+	client := fake.NewSimpleClientset(newWatchedDesk("alice-desk", apiv1.DeskStateReady))
+	watcher := watch.NewFakeWithChanSize(10, false)
+	watcher.Add(newWatchedDesk("bob-desk", apiv1.DeskStateInitializing))
+	watcher.Delete(newWatchedDesk("alice-desk", apiv1.DeskStateReady))
+	watcher.Error(&metav1.Status{Status: metav1.StatusFailure, Code: http.StatusInternalServerError, Message: "watch failed"})
+	client.PrependWatchReactor("desks", func(action core.Action) (bool, watch.Interface, error) {
+		return true, watcher, nil
+	})
+
+	printer, err := newDeskPrinter("wide", "", time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	c := &WorkshopctlCommand{workshopClient: client}
+	var buf bytes.Buffer
+	if err := c.watchDesks(&buf, printer, "alice-desk", true); err == nil || err.Error() != "watch failed" {
+		t.Fatalf("expected watch to fail, got %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 || !bytes.HasPrefix(lines[0], []byte("NAME")) || !bytes.Contains(lines[1], []byte(deskStateDeleted)) {
+		t.Errorf("expected a header and the deleted desk, got %q", buf.String())
+	}
+
+	if _, err := c.listWatchedDesks(&buf, printer, "carol-desk", true); err == nil {
+		t.Errorf("expected error for missing desk")
+	}
+}
+
+func TestPrintWatchedRefreshesNow(t *testing.T) {
+	// The printer was created long before the event, as when a watch has
+	// been running for a while.
+	printer, err := newDeskPrinter("wide", "", time.Now().Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	desk := newWatchedDesk("alice-desk", apiv1.DeskStateReady)
+	desk.CreationTimestamp = metav1.NewTime(time.Now().Add(-time.Hour))
+	desk.Spec.ExpirationTimestamp = metav1.NewTime(time.Now().Add(-time.Minute))
+
+	var buf bytes.Buffer
+	if err := printer.printWatched(&buf, *desk, watch.Modified); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 || !bytes.Contains(lines[1], []byte("60m")) || !bytes.Contains(lines[1], []byte("<expired>")) {
+		t.Errorf("expected age and remaining time at the time of the event, got %q", buf.String())
+	}
+}
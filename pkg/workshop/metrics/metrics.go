@@ -0,0 +1,238 @@
+// Package metrics defines the Prometheus metrics exported by the
+// workshop-controller and hooks them up to the workqueue and REST client
+// instrumentation of client-go.
+package metrics
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	clientmetrics "k8s.io/client-go/tools/metrics"
+	"k8s.io/client-go/util/workqueue"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "workshop"
+
+var (
+	// ReconcileTotal counts reconciliations of desk resources by kind and
+	// desk class.
+	ReconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_total",
+		Help:      "Number of reconciliations of desk resources, partitioned by resource kind and desk class.",
+	}, []string{"kind", "class"})
+
+	// ReconcileErrors counts failed reconciliations of desk resources by
+	// kind and desk class.
+	ReconcileErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "reconcile_errors_total",
+		Help:      "Number of failed reconciliations of desk resources, partitioned by resource kind and desk class.",
+	}, []string{"kind", "class"})
+
+	// ReconcileDuration observes how long reconciliations of desk
+	// resources take by kind.
+	ReconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_duration_seconds",
+		Help:      "Duration of reconciliations of desk resources, partitioned by resource kind.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"kind"})
+
+	// DeskTimeToReady observes the time between the creation of a desk and
+	// the controller first reporting it as ready by desk class.
+	DeskTimeToReady = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "desk_time_to_ready_seconds",
+		Help:      "Time from desk creation until the desk is ready, partitioned by desk class.",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"class"})
+
+	// DesksExpired counts desks deleted because they expired.
+	DesksExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "desks_expired_total",
+		Help:      "Number of desks deleted after reaching their expiration time.",
+	})
+
+	// DesksIdleSuspended counts desks suspended because they were idle.
+	DesksIdleSuspended = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "desks_idle_suspended_total",
+		Help:      "Number of desks suspended after being idle for longer than the idle timeout.",
+	})
+
+	// DeskRenewals counts requests to extend the expiration of desks by
+	// their result, one of "renewed", "clamped" or "rejected".
+	DeskRenewals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "desk_renewals_total",
+		Help:      "Number of requests to extend the expiration of desks, partitioned by result.",
+	}, []string{"result"})
+
+	requestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "apiserver_client",
+		Name:      "request_latency_seconds",
+		Help:      "Latency of requests to the apiserver, partitioned by verb and path template.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"verb", "path"})
+
+	requestResult = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "apiserver_client",
+		Name:      "requests_total",
+		Help:      "Number of requests to the apiserver, partitioned by status code, method and host.",
+	}, []string{"code", "method", "host"})
+
+	queueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "depth",
+		Help:      "Current depth of the workqueue.",
+	}, []string{"queue"})
+
+	queueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "adds_total",
+		Help:      "Number of items added to the workqueue.",
+	}, []string{"queue"})
+
+	queueLatency = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "queue_latency_microseconds",
+		Help:      "How long items stay in the workqueue before being processed.",
+	}, []string{"queue"})
+
+	queueWorkDuration = prometheus.NewSummaryVec(prometheus.SummaryOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "work_duration_microseconds",
+		Help:      "How long processing an item from the workqueue takes.",
+	}, []string{"queue"})
+
+	queueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "workqueue",
+		Name:      "retries_total",
+		Help:      "Number of retries handled by the workqueue.",
+	}, []string{"queue"})
+)
+
+var registerOnce sync.Once
+
+// Register registers all metrics with the default Prometheus registry and
+// installs them as the metrics provider of client-go's workqueues and REST
+// clients. It must be called before any workqueue or client is created.
+func Register() {
+	registerOnce.Do(func() {
+		prometheus.MustRegister(
+			ReconcileTotal,
+			ReconcileErrors,
+			ReconcileDuration,
+			DeskTimeToReady,
+			DesksExpired,
+			DesksIdleSuspended,
+			DeskRenewals,
+			requestLatency,
+			requestResult,
+			queueDepth,
+			queueAdds,
+			queueLatency,
+			queueWorkDuration,
+			queueRetries,
+		)
+		workqueue.SetProvider(workqueueMetricsProvider{})
+		clientmetrics.Register(latencyAdapter{}, resultAdapter{})
+	})
+}
+
+// ObserveReconcile records a reconciliation of a resource of the given kind
+// for a desk of the given class that started at start and finished with
+// *err. It is meant to be deferred.
+func ObserveReconcile(kind, class string, start time.Time, err *error) {
+	ReconcileTotal.WithLabelValues(kind, class).Inc()
+	ReconcileDuration.WithLabelValues(kind).Observe(time.Since(start).Seconds())
+	if *err != nil {
+		ReconcileErrors.WithLabelValues(kind, class).Inc()
+	}
+}
+
+type latencyAdapter struct{}
+
+func (latencyAdapter) Observe(verb string, u url.URL, latency time.Duration) {
+	requestLatency.WithLabelValues(verb, pathTemplate(u.Path)).Observe(latency.Seconds())
+}
+
+// pathTemplate replaces the namespace and object names in the path of an
+// apiserver request with placeholders, so that the latency of requests is
+// partitioned by resource rather than by object, e.g.
+// "/api/v1/namespaces/alice-desk/secrets/desk" becomes
+// "/api/v1/namespaces/{namespace}/secrets/{name}".
+func pathTemplate(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var prefix int
+	switch {
+	case len(segments) > 2 && segments[0] == "api":
+		prefix = 2
+	case len(segments) > 3 && segments[0] == "apis":
+		prefix = 3
+	default:
+		return path
+	}
+
+	template := segments[:prefix]
+	rest := segments[prefix:]
+	if rest[0] == "watch" {
+		template = append(template, rest[0])
+		rest = rest[1:]
+	}
+	if len(rest) > 2 && rest[0] == "namespaces" {
+		template = append(template, rest[0], "{namespace}")
+		rest = rest[2:]
+	}
+	if len(rest) > 0 {
+		template = append(template, rest[0])
+	}
+	if len(rest) > 1 {
+		template = append(template, "{name}")
+	}
+	if len(rest) > 2 {
+		template = append(template, rest[2:]...)
+	}
+	return "/" + strings.Join(template, "/")
+}
+
+type resultAdapter struct{}
+
+func (resultAdapter) Increment(code, method, host string) {
+	requestResult.WithLabelValues(code, method, host).Inc()
+}
+
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return queueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return queueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.SummaryMetric {
+	return queueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.SummaryMetric {
+	return queueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return queueRetries.WithLabelValues(name)
+}
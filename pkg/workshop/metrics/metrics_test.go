@@ -0,0 +1,21 @@
+package metrics
+
+import "testing"
+
+func TestPathTemplate(t *testing.T) {
+	for path, want := range map[string]string{
+		"/api/v1/namespaces":                                                          "/api/v1/namespaces",
+		"/api/v1/namespaces/alice-desk":                                               "/api/v1/namespaces/{name}",
+		"/api/v1/namespaces/alice-desk/secrets":                                       "/api/v1/namespaces/{namespace}/secrets",
+		"/api/v1/namespaces/alice-desk/secrets/desk":                                  "/api/v1/namespaces/{namespace}/secrets/{name}",
+		"/api/v1/namespaces/alice-desk/pods/kubeshell-1234/exec":                      "/api/v1/namespaces/{namespace}/pods/{name}/exec",
+		"/api/v1/watch/namespaces/alice-desk/pods":                                    "/api/v1/watch/namespaces/{namespace}/pods",
+		"/apis/workshop.lanford.io/v1/desks/alice-desk":                               "/apis/workshop.lanford.io/v1/desks/{name}",
+		"/apis/extensions/v1beta1/namespaces/alice-desk/deployments/kubeshell/status": "/apis/extensions/v1beta1/namespaces/{namespace}/deployments/{name}/status",
+		"/version": "/version",
+	} {
+		if got := pathTemplate(path); got != want {
+			t.Errorf("expected template of %q to be %q, got %q", path, want, got)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package webhook
+
+import (
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/util/cert"
+
+	"github.com/golang/glog"
+)
+
+const (
+	caCertKey = "ca.crt"
+	caKeyKey  = "ca.key"
+)
+
+// ensureCA returns the webhook CA from its secret, generating the CA and
+// secret if they do not exist yet. Sharing the CA through a secret lets every
+// replica serve the webhook with the CA bundle that is registered.
+func (s *Server) ensureCA() (*x509.Certificate, *rsa.PrivateKey, []byte, error) {
+	secrets := s.config.KubeClient.CoreV1().Secrets(s.config.ServiceNamespace)
+	secretName := fmt.Sprintf("%s-webhook-ca", s.config.ServiceName)
+
+	secret, err := secrets.Get(secretName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret, err = s.createCASecret(secretName)
+		if apierrors.IsAlreadyExists(err) {
+			// Another replica created the CA first.
+			secret, err = secrets.Get(secretName, metav1.GetOptions{})
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	caCertPEM := secret.Data[caCertKey]
+	certs, err := cert.ParseCertsPEM(caCertPEM)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not parse CA certificate in secret \"%s\": %s", secretName, err)
+	}
+	key, err := cert.ParsePrivateKeyPEM(secret.Data[caKeyKey])
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("could not parse CA key in secret \"%s\": %s", secretName, err)
+	}
+	caKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("CA key in secret \"%s\" is not an RSA key", secretName)
+	}
+	return certs[0], caKey, caCertPEM, nil
+}
+
+func (s *Server) createCASecret(name string) (*v1.Secret, error) {
+	caKey, err := cert.NewPrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	caCert, err := cert.NewSelfSignedCACert(cert.Config{CommonName: fmt.Sprintf("%s-webhook-ca", s.config.ServiceName)}, caKey)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := s.config.KubeClient.CoreV1().Secrets(s.config.ServiceNamespace).Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.config.ServiceNamespace,
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			caCertKey: cert.EncodeCertPEM(caCert),
+			caKeyKey:  cert.EncodePrivateKeyPEM(caKey),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	glog.V(0).Infof("Generated webhook CA in secret \"%s/%s\"", s.config.ServiceNamespace, name)
+	return secret, nil
+}
+
+// newServingCert returns a certificate for the webhook service, signed by the
+// webhook CA.
+func (s *Server) newServingCert(caCert *x509.Certificate, caKey *rsa.PrivateKey) (tls.Certificate, error) {
+	key, err := cert.NewPrivateKey()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	host := fmt.Sprintf("%s.%s.svc", s.config.ServiceName, s.config.ServiceNamespace)
+	servingCert, err := cert.NewSignedCert(cert.Config{
+		CommonName: host,
+		AltNames: cert.AltNames{
+			DNSNames: []string{
+				s.config.ServiceName,
+				fmt.Sprintf("%s.%s", s.config.ServiceName, s.config.ServiceNamespace),
+				host,
+				host + ".cluster.local",
+			},
+		},
+		Usages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, key, caCert, caKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(cert.EncodeCertPEM(servingCert), cert.EncodePrivateKeyPEM(key))
+}
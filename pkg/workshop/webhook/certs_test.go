@@ -0,0 +1,59 @@
+package webhook
+
+import (
+	"crypto/x509"
+	"testing"
+
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	workshopfake "github.com/joelanford/workshop/pkg/client/workshop/fake"
+)
+
+func TestServingCertIsSignedBySharedCA(t *testing.T) {
+	kubeClient := kubefake.NewSimpleClientset()
+	newServer := func() *Server {
+		s, err := NewServer(Config{
+			KubeClient:         kubeClient,
+			WorkshopClient:     workshopfake.NewSimpleClientset(),
+			ServiceNamespace:   "workshop",
+			ServiceName:        "workshop-controller",
+			ControllerUsername: "system:serviceaccount:workshop:workshop-controller",
+		})
+		if err != nil {
+			t.Fatalf("Could not create server: %s", err)
+		}
+		return s
+	}
+
+	// Two replicas must end up with the same CA.
+	_, _, firstBundle, err := newServer().ensureCA()
+	if err != nil {
+		t.Fatalf("Could not create CA: %s", err)
+	}
+	s := newServer()
+	caCert, caKey, caBundle, err := s.ensureCA()
+	if err != nil {
+		t.Fatalf("Could not load CA: %s", err)
+	}
+	if string(caBundle) != string(firstBundle) {
+		t.Errorf("Expected replicas to share the CA")
+	}
+
+	servingCert, err := s.newServingCert(caCert, caKey)
+	if err != nil {
+		t.Fatalf("Could not create serving certificate: %s", err)
+	}
+	leaf, err := x509.ParseCertificate(servingCert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Could not parse serving certificate: %s", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(caCert)
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		DNSName:   "workshop-controller.workshop.svc",
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		t.Errorf("Serving certificate does not verify against the CA: %s", err)
+	}
+}
@@ -0,0 +1,107 @@
+package webhook
+
+import (
+	"encoding/json"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	admissionregistrationv1alpha1 "k8s.io/client-go/pkg/apis/admissionregistration/v1alpha1"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Name of the validating webhook configuration and of its webhook.
+	WebhookName = "desks." + apiv1.GroupName
+
+	// Path at which desk writes are validated.
+	ValidateDesksPath = "/validate-desks"
+)
+
+// newWebhookConfiguration returns the validating webhook configuration for
+// desks. Deletions are only reviewed for the self-service group, so they are
+// only sent to the webhook if the group is set.
+func (s *Server) newWebhookConfiguration(caBundle []byte) *ValidatingWebhookConfiguration {
+	path := ValidateDesksPath
+	failurePolicy := admissionregistrationv1alpha1.Fail
+	operations := []admissionregistrationv1alpha1.OperationType{
+		admissionregistrationv1alpha1.Create,
+		admissionregistrationv1alpha1.Update,
+	}
+	if s.config.SelfServiceGroup != "" {
+		operations = append(operations, admissionregistrationv1alpha1.Delete)
+	}
+	return &ValidatingWebhookConfiguration{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "admissionregistration.k8s.io/v1beta1",
+			Kind:       "ValidatingWebhookConfiguration",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: WebhookName,
+		},
+		Webhooks: []Webhook{
+			{
+				Name: WebhookName,
+				ClientConfig: WebhookClientConfig{
+					Service: &ServiceReference{
+						Namespace: s.config.ServiceNamespace,
+						Name:      s.config.ServiceName,
+						Path:      &path,
+					},
+					CABundle: caBundle,
+				},
+				Rules: []admissionregistrationv1alpha1.RuleWithOperations{
+					{
+						Operations: operations,
+						Rule: admissionregistrationv1alpha1.Rule{
+							APIGroups:   []string{apiv1.GroupName},
+							APIVersions: []string{apiv1.Version},
+							Resources:   []string{apiv1.DeskResourcePlural},
+						},
+					},
+				},
+				FailurePolicy: &failurePolicy,
+			},
+		},
+	}
+}
+
+// register creates or updates the validating webhook configuration for
+// desks. The typed admissionregistration client of the vendored client-go
+// does not know this API version, so it is written through the REST client.
+func (s *Server) register(caBundle []byte) error {
+	restClient := s.config.KubeClient.AdmissionregistrationV1alpha1().RESTClient()
+	config := s.newWebhookConfiguration(caBundle)
+
+	body, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	err = restClient.Post().AbsPath(validatingWebhookConfigurationsPath).Body(body).Do().Error()
+	if err == nil {
+		glog.V(0).Infof("Registered validating webhook \"%s\"", config.Name)
+		return nil
+	}
+	if !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	raw, err := restClient.Get().AbsPath(validatingWebhookConfigurationsPath, config.Name).Do().Raw()
+	if err != nil {
+		return err
+	}
+	var current ValidatingWebhookConfiguration
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return err
+	}
+	config.ResourceVersion = current.ResourceVersion
+	if body, err = json.Marshal(config); err != nil {
+		return err
+	}
+	if err := restClient.Put().AbsPath(validatingWebhookConfigurationsPath, config.Name).Body(body).Do().Error(); err != nil {
+		return err
+	}
+	glog.V(0).Infof("Updated validating webhook \"%s\"", config.Name)
+	return nil
+}
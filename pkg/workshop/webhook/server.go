@@ -0,0 +1,158 @@
+// Package webhook implements a validating admission webhook for desks. It
+// enforces the rules that cannot be expressed in the desk CRD schema and
+// registers itself with the apiserver using a self-generated CA.
+package webhook
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/golang/glog"
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	"github.com/joelanford/workshop/pkg/client/workshop"
+)
+
+type Config struct {
+	KubeClient     kubernetes.Interface
+	WorkshopClient workshop.Interface
+
+	// Namespace and name of the service through which the apiserver
+	// reaches the webhook.
+	ServiceNamespace string
+	ServiceName      string
+
+	// Port on which the webhook is served over TLS.
+	Port int
+
+	// Username as which the controller writes desks. Its writes are not
+	// reviewed, so that the webhook never blocks the controller from
+	// initializing, renewing and tearing down desks.
+	ControllerUsername string
+
+	// Limits of the active desks of each owner, the same as those of the
+	// controller.
+	OwnerLimits apiv1.DeskOwnerLimits
+
+	// Resource limits of every desk namespace, the same as those of the
+	// controller, from which the resource footprint of desks is computed.
+	ResourceLimits apiv1.DeskResourceLimits
+
+	// Group whose members may only create, change and delete the desks
+	// whose owner is their username, if it is not empty.
+	SelfServiceGroup string
+
+	// Expiration policy of desks whose class does not override it, the same
+	// as that of the controller.
+	ExpirationPolicy apiv1.DeskExpirationPolicy
+}
+
+type Server struct {
+	config Config
+	now    func() time.Time
+}
+
+func NewServer(config Config) (*Server, error) {
+	if config.KubeClient == nil || config.WorkshopClient == nil {
+		return nil, fmt.Errorf("kube and workshop clients must be set")
+	}
+	if config.ServiceNamespace == "" || config.ServiceName == "" {
+		return nil, fmt.Errorf("service namespace and name must be set")
+	}
+	if config.ControllerUsername == "" {
+		return nil, fmt.Errorf("controller username must be set")
+	}
+	if err := apiv1.ValidateDeskOwnerLimits(&config.OwnerLimits); err != nil {
+		return nil, fmt.Errorf("invalid desk owner limits: %s", err)
+	}
+	if err := apiv1.ValidateDeskExpirationPolicy(&config.ExpirationPolicy); err != nil {
+		return nil, fmt.Errorf("invalid desk expiration policy: %s", err)
+	}
+	return &Server{config: config, now: time.Now}, nil
+}
+
+// Run sets up the serving certificate, registers the webhook and serves it
+// until ctx is cancelled.
+func (s *Server) Run(ctx context.Context) error {
+	caCert, caKey, caBundle, err := s.ensureCA()
+	if err != nil {
+		return fmt.Errorf("could not set up webhook CA: %s", err)
+	}
+	servingCert, err := s.newServingCert(caCert, caKey)
+	if err != nil {
+		return fmt.Errorf("could not generate webhook serving certificate: %s", err)
+	}
+	if err := s.register(caBundle); err != nil {
+		return fmt.Errorf("could not register webhook: %s", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(ValidateDesksPath, s)
+	server := &http.Server{
+		Addr:      fmt.Sprintf(":%d", s.config.Port),
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{servingCert}},
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		glog.V(0).Infof("Starting webhook server at %v with desk validation at \"%s\"", s.config.Port, ValidateDesksPath)
+		errCh <- server.ListenAndServeTLS("", "")
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		server.Close()
+	}
+	return ctx.Err()
+}
+
+// ServeHTTP reviews a desk write sent by the apiserver.
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var review AdmissionReview
+	if err := json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("could not decode admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	response := &AdmissionResponse{UID: review.Request.UID, Allowed: true}
+	if err := s.review(review.Request); err != nil {
+		glog.V(1).Infof("Denied %s of desk \"%s\" by \"%s\": %s", review.Request.Operation, review.Request.Name, review.Request.UserInfo.Username, err)
+		response.Allowed = false
+		response.Result = &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Message: err.Error(),
+			Reason:  metav1.StatusReasonForbidden,
+			Code:    http.StatusForbidden,
+		}
+	}
+
+	out, err := json.Marshal(&AdmissionReview{
+		TypeMeta: metav1.TypeMeta{APIVersion: admissionReviewAPIVersion, Kind: "AdmissionReview"},
+		Response: response,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(out)
+}
@@ -0,0 +1,74 @@
+package webhook
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	admissionregistrationv1alpha1 "k8s.io/client-go/pkg/apis/admissionregistration/v1alpha1"
+	authenticationv1 "k8s.io/client-go/pkg/apis/authentication/v1"
+)
+
+// The vendored client-go predates the admission.k8s.io/v1beta1 and
+// admissionregistration.k8s.io/v1beta1 APIs, so the subset of their types
+// used by the webhook is defined here, with the same JSON encoding.
+
+const (
+	admissionReviewAPIVersion string = "admission.k8s.io/v1beta1"
+
+	validatingWebhookConfigurationsPath string = "/apis/admissionregistration.k8s.io/v1beta1/validatingwebhookconfigurations"
+)
+
+// AdmissionReview describes an admission review request and response.
+type AdmissionReview struct {
+	metav1.TypeMeta `json:",inline"`
+	Request         *AdmissionRequest  `json:"request,omitempty"`
+	Response        *AdmissionResponse `json:"response,omitempty"`
+}
+
+// AdmissionRequest describes the object write that is being admitted.
+type AdmissionRequest struct {
+	UID       types.UID                   `json:"uid"`
+	Kind      metav1.GroupVersionKind     `json:"kind"`
+	Resource  metav1.GroupVersionResource `json:"resource"`
+	Name      string                      `json:"name,omitempty"`
+	Operation string                      `json:"operation"`
+	UserInfo  authenticationv1.UserInfo   `json:"userInfo"`
+	Object    runtime.RawExtension        `json:"object,omitempty"`
+	OldObject runtime.RawExtension        `json:"oldObject,omitempty"`
+}
+
+// AdmissionResponse tells the apiserver whether the write is allowed.
+type AdmissionResponse struct {
+	UID     types.UID      `json:"uid"`
+	Allowed bool           `json:"allowed"`
+	Result  *metav1.Status `json:"status,omitempty"`
+}
+
+// ValidatingWebhookConfiguration registers validating webhooks with the
+// apiserver.
+type ValidatingWebhookConfiguration struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Webhooks          []Webhook `json:"webhooks,omitempty"`
+}
+
+// Webhook describes a webhook and the writes it is called for.
+type Webhook struct {
+	Name          string                                             `json:"name"`
+	ClientConfig  WebhookClientConfig                                `json:"clientConfig"`
+	Rules         []admissionregistrationv1alpha1.RuleWithOperations `json:"rules,omitempty"`
+	FailurePolicy *admissionregistrationv1alpha1.FailurePolicyType   `json:"failurePolicy,omitempty"`
+}
+
+// WebhookClientConfig tells the apiserver how to reach the webhook.
+type WebhookClientConfig struct {
+	Service  *ServiceReference `json:"service"`
+	CABundle []byte            `json:"caBundle"`
+}
+
+// ServiceReference references the service in front of the webhook.
+type ServiceReference struct {
+	Namespace string  `json:"namespace"`
+	Name      string  `json:"name"`
+	Path      *string `json:"path,omitempty"`
+}
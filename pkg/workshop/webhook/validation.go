@@ -0,0 +1,290 @@
+package webhook
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1 "k8s.io/client-go/pkg/api/v1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+)
+
+const (
+	// Allowance for the clocks of clients that compute expirations
+	// relative to their own time.
+	expirationClockSkew = time.Minute
+)
+
+// review returns an error describing why the desk write must be denied, or
+// nil if it is allowed.
+func (s *Server) review(req *AdmissionRequest) error {
+	if req.Resource.Group != apiv1.GroupName || req.Resource.Resource != apiv1.DeskResourcePlural {
+		return nil
+	}
+	if req.UserInfo.Username == s.config.ControllerUsername {
+		return nil
+	}
+
+	if req.Operation == "DELETE" {
+		return s.reviewDelete(req)
+	}
+
+	var desk apiv1.Desk
+	if err := json.Unmarshal(req.Object.Raw, &desk); err != nil {
+		return fmt.Errorf("could not decode desk: %s", err)
+	}
+	if err := s.validateSelfService(req, &desk); err != nil {
+		return err
+	}
+
+	switch req.Operation {
+	case "CREATE":
+		if err := s.validateSelfServiceSpec(req, &desk, nil); err != nil {
+			return err
+		}
+		if err := s.validateDesk(&desk); err != nil {
+			return err
+		}
+		if err := s.validateExpiration(&desk); err != nil {
+			return err
+		}
+		return s.validateOwnerLimits(&desk)
+
+	case "UPDATE":
+		var oldDesk apiv1.Desk
+		if err := json.Unmarshal(req.OldObject.Raw, &oldDesk); err != nil {
+			return fmt.Errorf("could not decode existing desk: %s", err)
+		}
+		// Only the controller, whose writes are not reviewed, records
+		// the state, accepted expiration and renewals of desks.
+		if !equality.Semantic.DeepEqual(desk.Status, oldDesk.Status) {
+			return fmt.Errorf("status: may only be changed by the workshop controller")
+		}
+		if desk.DeletionTimestamp != nil {
+			return nil
+		}
+		if desk.Spec.Owner != oldDesk.Spec.Owner {
+			return fmt.Errorf("spec.owner: field is immutable, desk is owned by \"%s\"", oldDesk.Spec.Owner)
+		}
+		// The controller sets the class of desks created without one.
+		if oldDesk.Spec.DeskClassName != "" && desk.Spec.DeskClassName != oldDesk.Spec.DeskClassName {
+			return fmt.Errorf("spec.deskClassName: field is immutable, desk is of class \"%s\"", oldDesk.Spec.DeskClassName)
+		}
+		if equality.Semantic.DeepEqual(desk.Spec, oldDesk.Spec) {
+			// Metadata and finalizer updates.
+			return nil
+		}
+		if err := s.validateSelfServiceSpec(req, &desk, &oldDesk); err != nil {
+			return err
+		}
+		if err := s.validateDesk(&desk); err != nil {
+			return err
+		}
+		if desk.Spec.ExpirationTimestamp.After(oldDesk.Spec.ExpirationTimestamp.Time) {
+			return s.validateRenewal(&desk, &oldDesk)
+		}
+	}
+	return nil
+}
+
+// validateDesk applies the rules of the desk schema. The version is
+// defaulted first, as the controller does, but the expiration is not, so
+// that expirations beyond the expiration policy are denied rather than
+// silently shortened.
+func (s *Server) validateDesk(desk *apiv1.Desk) error {
+	defaulted := desk.DeepCopyObject().(*apiv1.Desk)
+	if defaulted.Spec.Version == "" {
+		defaulted.Spec.Version = apiv1.DeskDefaultVersion
+	}
+	return apiv1.ValidateDesk(defaulted)
+}
+
+// validateExpiration denies new desks that expire later than their
+// expiration policy allows.
+func (s *Server) validateExpiration(desk *apiv1.Desk) error {
+	expiration := desk.Spec.ExpirationTimestamp
+	if expiration.IsZero() {
+		return nil
+	}
+	policy, err := s.expirationPolicy(desk)
+	if err != nil {
+		return err
+	}
+	max := policy.MaxExpiration(desk, s.now())
+	if !max.IsZero() && expiration.Time.After(max.Add(expirationClockSkew)) {
+		return fmt.Errorf("spec.expirationTimestamp: %s is after %s, the latest expiration the expiration policy allows", expiration.UTC().Format(time.RFC3339), max.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// validateRenewal denies extensions of the expiration of desks that cannot
+// be renewed at all. Renewals beyond the limits of the expiration policy are
+// allowed, since the controller shortens them to the limits.
+func (s *Server) validateRenewal(desk, oldDesk *apiv1.Desk) error {
+	policy, err := s.expirationPolicy(desk)
+	if err != nil {
+		return err
+	}
+	if _, err := policy.Renew(oldDesk, desk.Spec.ExpirationTimestamp.Time, s.now()); err != nil {
+		return fmt.Errorf("spec.expirationTimestamp: %s", err)
+	}
+	return nil
+}
+
+// expirationPolicy returns the expiration policy of the desk, which the
+// controller resolves in the same way. Desks without a known class get the
+// configured policy.
+func (s *Server) expirationPolicy(desk *apiv1.Desk) (*apiv1.DeskExpirationPolicy, error) {
+	policy := &s.config.ExpirationPolicy
+	if desk.Spec.DeskClassName == "" {
+		return policy.DeepCopy(), nil
+	}
+	class, err := s.config.WorkshopClient.WorkshopV1().DeskClasses().Get(desk.Spec.DeskClassName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return policy.DeepCopy(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not get desk class \"%s\": %s", desk.Spec.DeskClassName, err)
+	}
+	return class.ExpirationPolicy(policy, desk.Spec.Owner), nil
+}
+
+// reviewDelete returns an error describing why the deletion of the desk
+// must be denied, or nil if it is allowed. The apiserver does not send the
+// desk along with deletions, so it is looked up.
+func (s *Server) reviewDelete(req *AdmissionRequest) error {
+	if !s.isSelfServiceUser(req) {
+		return nil
+	}
+	desk, err := s.config.WorkshopClient.WorkshopV1().Desks().Get(req.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get desk \"%s\": %s", req.Name, err)
+	}
+	return s.validateSelfService(req, desk)
+}
+
+// isSelfServiceUser returns whether the user making the request is a member
+// of the self-service group.
+func (s *Server) isSelfServiceUser(req *AdmissionRequest) bool {
+	if s.config.SelfServiceGroup == "" {
+		return false
+	}
+	for _, group := range req.UserInfo.Groups {
+		if group == s.config.SelfServiceGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// validateSelfService denies members of the self-service group writes to
+// desks that they do not own, i.e. whose owner is not their username.
+func (s *Server) validateSelfService(req *AdmissionRequest, desk *apiv1.Desk) error {
+	if !s.isSelfServiceUser(req) || desk.Spec.Owner == req.UserInfo.Username {
+		return nil
+	}
+	return fmt.Errorf("spec.owner: members of group \"%s\" may only manage desks owned by themselves, \"%s\"", s.config.SelfServiceGroup, req.UserInfo.Username)
+}
+
+// validateSelfServiceSpec denies members of the self-service group the fields
+// of desks that widen what a desk may use or who may use it: resource limits,
+// which override the limits of the controller, disabled network isolation and
+// collaborating groups, which could be any group such as
+// system:authenticated. On updates, the fields may be kept as they were set
+// by others, e.g. by instructors, so that such desks can still be renewed.
+func (s *Server) validateSelfServiceSpec(req *AdmissionRequest, desk, oldDesk *apiv1.Desk) error {
+	if !s.isSelfServiceUser(req) {
+		return nil
+	}
+	if oldDesk == nil {
+		oldDesk = &apiv1.Desk{}
+	}
+	group := s.config.SelfServiceGroup
+	if limits := desk.Spec.Limits; limits != nil && (limits.HasQuota() || limits.HasLimitRange()) && !equality.Semantic.DeepEqual(desk.Spec.Limits, oldDesk.Spec.Limits) {
+		return fmt.Errorf("spec.limits: members of group \"%s\" may not set the resource limits of desks", group)
+	}
+	if desk.Spec.DisableNetworkIsolation && !oldDesk.Spec.DisableNetworkIsolation {
+		return fmt.Errorf("spec.disableNetworkIsolation: members of group \"%s\" may not disable the network isolation of desks", group)
+	}
+	for i, collaborator := range desk.Spec.Collaborators {
+		if collaborator.Kind != apiv1.DeskSubjectUser && !hasDeskSubject(oldDesk.Spec.Collaborators, collaborator) {
+			return fmt.Errorf("spec.collaborators[%d]: members of group \"%s\" may only add users as collaborators, not %s \"%s\"", i, group, strings.ToLower(collaborator.Kind), collaborator.Name)
+		}
+	}
+	return nil
+}
+
+// hasDeskSubject returns whether subject is one of subjects.
+func hasDeskSubject(subjects []apiv1.DeskSubject, subject apiv1.DeskSubject) bool {
+	for _, s := range subjects {
+		if s == subject {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOwnerLimits denies a new desk if its owner already has the maximum
+// number of active desks or if its resource footprint would exceed the
+// resources of its owner.
+func (s *Server) validateOwnerLimits(desk *apiv1.Desk) error {
+	limits := &s.config.OwnerLimits
+	if limits.IsZero() {
+		return nil
+	}
+	desks, err := s.config.WorkshopClient.WorkshopV1().Desks().List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("could not count desks of owner \"%s\": %s", desk.Spec.Owner, err)
+	}
+	var namespaces map[string]int
+	if len(limits.MaxResources) > 0 {
+		if namespaces, err = s.classNamespaceCounts(); err != nil {
+			return err
+		}
+	}
+
+	active := 0
+	used := corev1.ResourceList{}
+	for i := range desks.Items {
+		d := &desks.Items[i]
+		if d.Spec.Owner == desk.Spec.Owner && d.IsActive() {
+			active++
+			apiv1.AddResourceLists(used, s.deskFootprint(d, namespaces))
+		}
+	}
+	return limits.Check(desk.Spec.Owner, active, used, s.deskFootprint(desk, namespaces))
+}
+
+// deskFootprint returns the total of the hard limits of the resource quotas
+// of the namespaces of the desk, given the number of namespaces of each desk
+// class.
+func (s *Server) deskFootprint(desk *apiv1.Desk, namespaces map[string]int) corev1.ResourceList {
+	return s.config.ResourceLimits.Merge(desk.Spec.Limits).Footprint(namespaces[desk.Spec.DeskClassName])
+}
+
+// classNamespaceCounts returns the number of namespaces of the desks of each
+// desk class by name. Desks without a class get the default desk class, so
+// its count is also returned for the empty name.
+func (s *Server) classNamespaceCounts() (map[string]int, error) {
+	classes, err := s.config.WorkshopClient.WorkshopV1().DeskClasses().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list desk classes: %s", err)
+	}
+	counts := make(map[string]int, len(classes.Items)+1)
+	for i := range classes.Items {
+		class := &classes.Items[i]
+		counts[class.Name] = len(class.Spec.Namespaces)
+		if class.IsDefault() {
+			counts[""] = len(class.Spec.Namespaces)
+		}
+	}
+	return counts, nil
+}
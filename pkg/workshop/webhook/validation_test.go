@@ -0,0 +1,402 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	corev1 "k8s.io/client-go/pkg/api/v1"
+	admissionregistrationv1alpha1 "k8s.io/client-go/pkg/apis/admissionregistration/v1alpha1"
+	authenticationv1 "k8s.io/client-go/pkg/apis/authentication/v1"
+
+	apiv1 "github.com/joelanford/workshop/pkg/apis/workshop/v1"
+	workshopfake "github.com/joelanford/workshop/pkg/client/workshop/fake"
+)
+
+func TestReview(t *testing.T) {
+	now := time.Date(2017, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	newDesk := func(name, owner string, expiresIn time.Duration) *apiv1.Desk {
+		return &apiv1.Desk{
+			ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(now)},
+			Spec: apiv1.DeskSpec{
+				Owner:               owner,
+				Version:             apiv1.DeskDefaultVersion,
+				ExpirationTimestamp: metav1.NewTime(now.Add(expiresIn)),
+			},
+		}
+	}
+	expiredDesk := newDesk("bob-2", "bob", -time.Hour)
+	expiredDesk.Status.State = apiv1.DeskStateExpired
+	existing := []runtime.Object{
+		newDesk("alice-1", "alice", time.Hour),
+		newDesk("alice-2", "alice", time.Hour),
+		newDesk("bob-1", "bob", time.Hour),
+		expiredDesk,
+	}
+	deleting := newDesk("alice-1", "alice", time.Hour)
+	deleting.DeletionTimestamp = &metav1.Time{Time: now}
+	renewed := newDesk("bob-1", "bob", 2*time.Hour)
+	tooLate := newDesk("bob-1", "bob", apiv1.DeskMaxLifespan+time.Hour)
+	renewedTwice := newDesk("bob-1", "bob", time.Hour)
+	renewedTwice.Status.AcceptedExpirationTimestamp = renewedTwice.Spec.ExpirationTimestamp
+	renewedTwice.Status.Renewals = make([]apiv1.DeskRenewal, 2)
+	renewedThrice := newDesk("bob-1", "bob", 2*time.Hour)
+	renewedThrice.Status = renewedTwice.Status
+	withStatus := newDesk("bob-1", "bob", time.Hour)
+	withStatus.Status.State = apiv1.DeskStateReady
+	withLimits := func(desk *apiv1.Desk) *apiv1.Desk {
+		desk.Spec.Limits = &apiv1.DeskResourceLimits{Quota: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1000")}}
+		return desk
+	}
+	withoutIsolation := func(desk *apiv1.Desk) *apiv1.Desk {
+		desk.Spec.DisableNetworkIsolation = true
+		return desk
+	}
+	withCollaborator := func(desk *apiv1.Desk, kind, name string) *apiv1.Desk {
+		desk.Spec.Collaborators = append(desk.Spec.Collaborators, apiv1.DeskSubject{Kind: kind, Name: name})
+		return desk
+	}
+	attendee := authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated", "attendees"}}
+	withClass := func(name, class string) *apiv1.Desk {
+		desk := newDesk(name, "bob", time.Hour)
+		desk.Spec.DeskClassName = class
+		return desk
+	}
+
+	tests := []struct {
+		name      string
+		operation string
+		desk      *apiv1.Desk
+		oldDesk   *apiv1.Desk
+		user      authenticationv1.UserInfo
+		wantDeny  string
+	}{
+		{
+			name:      "valid create",
+			operation: "CREATE",
+			desk:      newDesk("carol", "carol", time.Hour),
+		},
+		{
+			name:      "create with empty owner",
+			operation: "CREATE",
+			desk:      newDesk("carol", "", time.Hour),
+			wantDeny:  "spec.owner: Required value",
+		},
+		{
+			name:      "create expiring too late",
+			operation: "CREATE",
+			desk:      newDesk("carol", "carol", apiv1.DeskMaxLifespan+time.Hour),
+			wantDeny:  "spec.expirationTimestamp",
+		},
+		{
+			name:      "create over owner limit",
+			operation: "CREATE",
+			desk:      newDesk("alice-3", "alice", time.Hour),
+			wantDeny:  "owner \"alice\" already has 2 active desks",
+		},
+		{
+			name:      "create does not count expired desks",
+			operation: "CREATE",
+			desk:      newDesk("bob-3", "bob", time.Hour),
+		},
+		{
+			name:      "self-service create of own desk",
+			operation: "CREATE",
+			desk:      newDesk("bob-3", "bob", time.Hour),
+			user:      authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated", "attendees"}},
+		},
+		{
+			name:      "self-service create of desk of other owner",
+			operation: "CREATE",
+			desk:      newDesk("carol", "carol", time.Hour),
+			user:      authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated", "attendees"}},
+			wantDeny:  "spec.owner: members of group \"attendees\" may only manage desks owned by themselves, \"bob\"",
+		},
+		{
+			name:      "self-service delete of own desk",
+			operation: "DELETE",
+			desk:      newDesk("bob-1", "bob", time.Hour),
+			user:      authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated", "attendees"}},
+		},
+		{
+			name:      "self-service delete of desk of other owner",
+			operation: "DELETE",
+			desk:      newDesk("alice-1", "alice", time.Hour),
+			user:      authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated", "attendees"}},
+			wantDeny:  "may only manage desks owned by themselves",
+		},
+		{
+			name:      "self-service create with limits",
+			operation: "CREATE",
+			desk:      withLimits(newDesk("bob-3", "bob", time.Hour)),
+			user:      attendee,
+			wantDeny:  "spec.limits: members of group \"attendees\" may not set the resource limits of desks",
+		},
+		{
+			name:      "self-service create without network isolation",
+			operation: "CREATE",
+			desk:      withoutIsolation(newDesk("bob-3", "bob", time.Hour)),
+			user:      attendee,
+			wantDeny:  "spec.disableNetworkIsolation: members of group \"attendees\" may not disable the network isolation of desks",
+		},
+		{
+			name:      "self-service create with collaborating group",
+			operation: "CREATE",
+			desk:      withCollaborator(newDesk("bob-3", "bob", time.Hour), apiv1.DeskSubjectGroup, "system:authenticated"),
+			user:      attendee,
+			wantDeny:  "spec.collaborators[0]: members of group \"attendees\" may only add users as collaborators, not group \"system:authenticated\"",
+		},
+		{
+			name:      "self-service create with collaborating user",
+			operation: "CREATE",
+			desk:      withCollaborator(newDesk("bob-3", "bob", time.Hour), apiv1.DeskSubjectUser, "carol"),
+			user:      attendee,
+		},
+		{
+			name:      "create with limits outside of group",
+			operation: "CREATE",
+			desk:      withoutIsolation(withLimits(newDesk("bob-3", "bob", time.Hour))),
+		},
+		{
+			name:      "self-service update setting limits",
+			operation: "UPDATE",
+			desk:      withLimits(newDesk("bob-1", "bob", time.Hour)),
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+			user:      attendee,
+			wantDeny:  "spec.limits: members of group \"attendees\"",
+		},
+		{
+			name:      "self-service update disabling network isolation",
+			operation: "UPDATE",
+			desk:      withoutIsolation(newDesk("bob-1", "bob", time.Hour)),
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+			user:      attendee,
+			wantDeny:  "spec.disableNetworkIsolation: members of group \"attendees\"",
+		},
+		{
+			name:      "self-service update adding collaborating group",
+			operation: "UPDATE",
+			desk:      withCollaborator(newDesk("bob-1", "bob", time.Hour), apiv1.DeskSubjectGroup, "system:authenticated"),
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+			user:      attendee,
+			wantDeny:  "spec.collaborators[0]: members of group \"attendees\"",
+		},
+		{
+			// Instructors may have provisioned the desk for its owner.
+			name:      "self-service renewal of desk with limits set by others",
+			operation: "UPDATE",
+			desk:      withCollaborator(withoutIsolation(withLimits(newDesk("bob-1", "bob", 2*time.Hour))), apiv1.DeskSubjectGroup, "instructors"),
+			oldDesk:   withCollaborator(withoutIsolation(withLimits(newDesk("bob-1", "bob", time.Hour))), apiv1.DeskSubjectGroup, "instructors"),
+			user:      attendee,
+		},
+		{
+			name:      "delete of desk of other owner outside of group",
+			operation: "DELETE",
+			desk:      newDesk("alice-1", "alice", time.Hour),
+			user:      authenticationv1.UserInfo{Username: "bob"},
+		},
+		{
+			name:      "change owner",
+			operation: "UPDATE",
+			desk:      newDesk("bob-1", "alice", time.Hour),
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+			wantDeny:  "spec.owner: field is immutable",
+		},
+		{
+			name:      "change class",
+			operation: "UPDATE",
+			desk:      withClass("bob-1", "course"),
+			oldDesk:   withClass("bob-1", apiv1.DeskDefaultClass),
+			wantDeny:  "spec.deskClassName: field is immutable",
+		},
+		{
+			name:      "default class",
+			operation: "UPDATE",
+			desk:      withClass("bob-1", apiv1.DeskDefaultClass),
+			oldDesk:   withClass("bob-1", ""),
+		},
+		{
+			name:      "renew within lifespan",
+			operation: "UPDATE",
+			desk:      renewed,
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+		},
+		{
+			// The controller shortens the renewal to the lifespan.
+			name:      "renew beyond lifespan",
+			operation: "UPDATE",
+			desk:      tooLate,
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+		},
+		{
+			name:      "renew beyond max renewals",
+			operation: "UPDATE",
+			desk:      renewedThrice,
+			oldDesk:   renewedTwice,
+			wantDeny:  "spec.expirationTimestamp: desk was renewed 2 times, which is the maximum",
+		},
+		{
+			name:      "status update",
+			operation: "UPDATE",
+			desk:      withStatus,
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+			wantDeny:  "status: may only be changed by the workshop controller",
+		},
+		{
+			name:      "self-service reset of renewals",
+			operation: "UPDATE",
+			desk:      newDesk("bob-1", "bob", time.Hour),
+			oldDesk:   renewedTwice,
+			user:      authenticationv1.UserInfo{Username: "bob", Groups: []string{"system:authenticated", "attendees"}},
+			wantDeny:  "status: may only be changed by the workshop controller",
+		},
+		{
+			name:      "controller status update",
+			operation: "UPDATE",
+			desk:      withStatus,
+			oldDesk:   newDesk("bob-1", "bob", time.Hour),
+			user:      authenticationv1.UserInfo{Username: "system:serviceaccount:workshop:workshop-controller"},
+		},
+		{
+			name:      "controller update of desk of other owner",
+			operation: "UPDATE",
+			desk:      withClass("alice-1", apiv1.DeskDefaultClass),
+			oldDesk:   withClass("alice-1", ""),
+			user:      authenticationv1.UserInfo{Username: "system:serviceaccount:workshop:workshop-controller", Groups: []string{"attendees"}},
+		},
+		{
+			name:      "update of deleting desk",
+			operation: "UPDATE",
+			desk:      deleting,
+			oldDesk:   newDesk("alice-1", "alice", time.Hour),
+		},
+	}
+
+	maxRenewals := int32(2)
+	policy := apiv1.DefaultDeskExpirationPolicy()
+	policy.MaxRenewals = &maxRenewals
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s, err := NewServer(Config{
+				KubeClient:         kubefake.NewSimpleClientset(),
+				WorkshopClient:     workshopfake.NewSimpleClientset(existing...),
+				ServiceNamespace:   "workshop",
+				ServiceName:        "workshop-controller",
+				ControllerUsername: "system:serviceaccount:workshop:workshop-controller",
+				OwnerLimits:        apiv1.DeskOwnerLimits{MaxDesks: 2},
+				SelfServiceGroup:   "attendees",
+				ExpirationPolicy:   *policy,
+			})
+			if err != nil {
+				t.Fatalf("Could not create server: %s", err)
+			}
+			s.now = func() time.Time { return now }
+
+			request := &AdmissionRequest{
+				UID:       "review-uid",
+				Resource:  metav1.GroupVersionResource{Group: apiv1.GroupName, Version: apiv1.Version, Resource: apiv1.DeskResourcePlural},
+				Name:      test.desk.Name,
+				Operation: test.operation,
+				UserInfo:  test.user,
+			}
+			if test.operation != "DELETE" {
+				request.Object = runtime.RawExtension{Raw: mustMarshal(t, test.desk)}
+			}
+			if test.oldDesk != nil {
+				request.OldObject = runtime.RawExtension{Raw: mustMarshal(t, test.oldDesk)}
+			}
+			body := mustMarshal(t, &AdmissionReview{Request: request})
+
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, httptest.NewRequest("POST", ValidateDesksPath, bytes.NewReader(body)))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var review AdmissionReview
+			if err := json.Unmarshal(w.Body.Bytes(), &review); err != nil {
+				t.Fatalf("Could not decode response: %s", err)
+			}
+			response := review.Response
+			if response == nil || response.UID != "review-uid" {
+				t.Fatalf("Expected response for request \"review-uid\", got %+v", response)
+			}
+			if test.wantDeny == "" {
+				if !response.Allowed {
+					t.Errorf("Expected write to be allowed, got denied: %s", response.Result.Message)
+				}
+				return
+			}
+			if response.Allowed {
+				t.Fatalf("Expected write to be denied with %q, got allowed", test.wantDeny)
+			}
+			if !strings.Contains(response.Result.Message, test.wantDeny) {
+				t.Errorf("Expected denial containing %q, got %q", test.wantDeny, response.Result.Message)
+			}
+		})
+	}
+}
+
+func TestWebhookConfigurationOperations(t *testing.T) {
+	for _, test := range []struct {
+		selfServiceGroup string
+		want             []admissionregistrationv1alpha1.OperationType
+	}{
+		{"", []admissionregistrationv1alpha1.OperationType{admissionregistrationv1alpha1.Create, admissionregistrationv1alpha1.Update}},
+		{"attendees", []admissionregistrationv1alpha1.OperationType{admissionregistrationv1alpha1.Create, admissionregistrationv1alpha1.Update, admissionregistrationv1alpha1.Delete}},
+	} {
+		s, err := NewServer(Config{
+			KubeClient:         kubefake.NewSimpleClientset(),
+			WorkshopClient:     workshopfake.NewSimpleClientset(),
+			ServiceNamespace:   "workshop",
+			ServiceName:        "workshop-controller",
+			ControllerUsername: "system:serviceaccount:workshop:workshop-controller",
+			SelfServiceGroup:   test.selfServiceGroup,
+		})
+		if err != nil {
+			t.Fatalf("Could not create server: %s", err)
+		}
+		config := s.newWebhookConfiguration(nil)
+		if got := config.Webhooks[0].Rules[0].Operations; !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Expected operations %v with self-service group %q, got %v", test.want, test.selfServiceGroup, got)
+		}
+	}
+}
+
+func TestServeHTTPRejectsMalformedReview(t *testing.T) {
+	s, err := NewServer(Config{
+		KubeClient:         kubefake.NewSimpleClientset(),
+		WorkshopClient:     workshopfake.NewSimpleClientset(),
+		ServiceNamespace:   "workshop",
+		ServiceName:        "workshop-controller",
+		ControllerUsername: "system:serviceaccount:workshop:workshop-controller",
+	})
+	if err != nil {
+		t.Fatalf("Could not create server: %s", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", ValidateDesksPath, strings.NewReader("{}")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400, got %d", w.Code)
+	}
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("Could not marshal %T: %s", v, err)
+	}
+	return data
+}